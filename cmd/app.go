@@ -2,25 +2,57 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pressly/goose/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"go.uber.org/zap"
 
 	"effectiveMobileTest/config"
 	"effectiveMobileTest/pkg/api"
+	"effectiveMobileTest/pkg/api/middlewares"
+	"effectiveMobileTest/pkg/auth"
+	"effectiveMobileTest/pkg/health"
+	"effectiveMobileTest/pkg/metrics"
+	"effectiveMobileTest/pkg/ratelimit"
 	"effectiveMobileTest/pkg/repository"
+	"effectiveMobileTest/pkg/service/apikeys"
+	"effectiveMobileTest/pkg/service/details"
+	"effectiveMobileTest/pkg/service/enrichment"
 	"effectiveMobileTest/pkg/service/music"
+	"effectiveMobileTest/pkg/service/similarity"
+	"effectiveMobileTest/pkg/tracing"
 	"effectiveMobileTest/utils"
 )
 
+const (
+	// metricsScrapeTimeout bounds the queries run for one scrape of /metrics.
+	metricsScrapeTimeout = 5 * time.Second
+	// songStatsMaxAge is how long the song counters are reused across scrapes,
+	// about a usual scrape interval.
+	songStatsMaxAge = 15 * time.Second
+
+	serviceName = "music-api"
+
+	migrationsDir = "./migrations"
+)
+
 type App struct {
-	ctx    utils.MyContext
-	server *api.Server
-	db     *sqlx.DB
-	config config.Config
+	ctx        utils.MyContext
+	server     *api.Server
+	metrics    *http.Server
+	db         *sqlx.DB
+	config     config.Config
+	enrichment *enrichment.Pool
+	refresh    *enrichment.Scheduler
+	health     *health.Checker
+
+	shutdownTracing func(context.Context) error
 }
 
 func NewApp(ctx context.Context, logger *zap.SugaredLogger, config config.Config) *App {
@@ -58,7 +90,7 @@ func (a *App) InitDatabase() error {
 func (a *App) RunMigrations() error {
 	a.ctx.Logger.Info("running database migrations")
 
-	if err := goose.Up(a.db.DB, "./migrations"); err != nil {
+	if err := goose.Up(a.db.DB, migrationsDir); err != nil {
 		return fmt.Errorf("failed to apply migrations: %w", err)
 	}
 
@@ -66,14 +98,302 @@ func (a *App) RunMigrations() error {
 	return nil
 }
 
-func (a *App) InitService() {
+// InitTracing sets up the export of trace spans and the propagation of W3C
+// trace context.
+func (a *App) InitTracing() error {
+	tracingConfig := a.config.Tracing
+
+	shutdown, err := tracing.Init(a.ctx.Ctx, tracing.Config{
+		ServiceName:  serviceName,
+		Exporter:     tracingConfig.Exporter,
+		OTLPEndpoint: tracingConfig.OTLPEndpoint,
+		OTLPInsecure: tracingConfig.OTLPInsecure,
+		File:         tracingConfig.File,
+		SampleRatio:  tracingConfig.SampleRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize tracing: %w", err)
+	}
+	a.shutdownTracing = shutdown
+
+	a.ctx.Logger.Infof("tracing exporter: %s", tracingConfig.Exporter)
+	return nil
+}
+
+func (a *App) InitService() error {
 	a.ctx.Logger.Info("initializing services")
 
-	s := music.NewMusicService(repository.NewPostgres(a.db), a.config.SongDetailsAPIUrl)
-	a.server = api.NewServer(a.ctx, a.config)
+	index := similarity.NewIndex(similarity.Weights{
+		Text:      a.config.Similarity.TextWeight,
+		Group:     a.config.Similarity.GroupWeight,
+		Era:       a.config.Similarity.EraWeight,
+		EraWindow: a.config.Similarity.EraWindowYears,
+	})
+
+	transport, err := a.newDetailsTransport()
+	if err != nil {
+		return fmt.Errorf("failed to configure details HTTP client: %w", err)
+	}
+
+	resilience := a.config.DetailsResilience
+	var providers []details.Provider
+	for _, provider := range a.config.DetailsProviders {
+		limiter := details.NewLimiter(details.LimiterConfig{
+			Rate:        resilience.RateLimit,
+			Burst:       resilience.RateBurst,
+			MaxInFlight: resilience.MaxInFlight,
+			MaxQueue:    resilience.MaxQueue,
+			MaxWait:     resilience.MaxQueueWait,
+		})
+		providerTransport, err := newProviderTransport(transport, provider)
+		if err != nil {
+			return fmt.Errorf("failed to configure details provider %s: %w", provider.Name, err)
+		}
+		providers = append(providers, details.NewLimitedProvider(
+			details.NewBreakerProvider(
+				details.NewHTTPProvider(provider.Name, provider.URL, a.newDetailsClient(providerTransport, limiter, provider.Name)),
+				details.NewBreaker(resilience.BreakerFailureThreshold, resilience.BreakerOpenTimeout),
+			),
+			limiter,
+		))
+	}
+
+	repo := repository.NewPostgres(a.db)
+	s := music.NewMusicService(repo, details.NewChain(providers...), index, music.Options{
+		SimilarLimit:            a.config.Similarity.Limit,
+		EnrichmentPolicy:        a.config.Enrichment.Policy,
+		AsyncEnrichment:         a.config.Enrichment.Async,
+		EnrichmentLease:         a.config.Enrichment.Lease,
+		EnrichmentMaxAttempts:   a.config.Enrichment.MaxAttempts,
+		EnrichmentRetryDelay:    a.config.Enrichment.RetryDelay,
+		DetailsCacheTTL:         a.config.DetailsCache.TTL,
+		DetailsCacheNegativeTTL: a.config.DetailsCache.NegativeTTL,
+		RefreshBatchSize:        a.config.Refresh.BatchSize,
+		RefreshStaleAfter:       time.Duration(a.config.Refresh.StaleDays) * 24 * time.Hour,
+	})
+	if err := s.RebuildSearchKeys(a.ctx); err != nil {
+		a.ctx.Logger.Warnf("failed to rebuild search keys: %v", err)
+	}
+	if err := s.BuildSimilarityIndex(a.ctx); err != nil {
+		a.ctx.Logger.Warnf("failed to build similarity index: %v", err)
+	}
+	if err := s.PurgeDetailsCache(a.ctx); err != nil {
+		a.ctx.Logger.Warnf("failed to purge details cache: %v", err)
+	}
+
+	if a.config.Enrichment.Async {
+		a.enrichment = enrichment.NewPool(s, a.config.Enrichment.Workers, a.config.Enrichment.PollInterval)
+	}
+	if a.config.Refresh.Interval > 0 {
+		a.refresh = enrichment.NewScheduler(s, a.config.Refresh.Interval)
+	}
+
+	keys := apikeys.NewAPIKeyService(repo)
+	credentials := middlewares.Credentials{APIKeys: keys}
+	if jwtConfig := a.config.Auth.JWT; jwtConfig.Secret != "" || jwtConfig.JWKSFile != "" {
+		tokens, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+			Secret:      []byte(jwtConfig.Secret),
+			JWKSFile:    jwtConfig.JWKSFile,
+			Issuer:      jwtConfig.Issuer,
+			Audience:    jwtConfig.Audience,
+			RolesClaim:  jwtConfig.RolesClaim,
+			RoleMapping: jwtConfig.RoleMapping,
+			Leeway:      jwtConfig.Leeway,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to configure JWT authentication: %w", err)
+		}
+		credentials.Tokens = tokens
+		a.ctx.Logger.Info("JWT authentication is enabled")
+	}
+	if !a.config.Auth.Enabled {
+		a.ctx.Logger.Warn("authentication is disabled, every endpoint is public")
+	}
+	if tls := a.config.TLS; (tls.CertFile == "") != (tls.KeyFile == "") {
+		return errors.New("only one of SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE is set, set both to serve HTTPS or neither")
+	}
+	if origins := a.config.CORS.AllowedOrigins; len(origins) > 0 {
+		a.ctx.Logger.Infof("CORS is enabled for origins %v", origins)
+	}
+
+	limiter, clientIP, err := a.initRateLimit(repo)
+	if err != nil {
+		return fmt.Errorf("failed to set up rate limiting: %w", err)
+	}
+
+	a.server = api.NewServer(a.ctx, a.config, credentials, limiter, clientIP)
 	a.server.HandleMusic(a.ctx, s)
+	a.server.HandleAPIKeys(a.ctx, keys)
+
+	if err = a.initHealth(s); err != nil {
+		return fmt.Errorf("failed to set up health checks: %w", err)
+	}
+	a.server.HandleHealth(a.ctx, a.health)
+
+	if err = a.initMetrics(s); err != nil {
+		return fmt.Errorf("failed to register metrics: %w", err)
+	}
 
 	a.ctx.Logger.Info("services initialized successfully")
+	return nil
+}
+
+// initRateLimit sets up the limiter of client requests, nil when rate
+// limiting is disabled.
+func (a *App) initRateLimit(repo ratelimit.Repository) (*ratelimit.Limiter, *ratelimit.ClientIP, error) {
+	rateLimit := a.config.RateLimit
+	if !rateLimit.Enabled {
+		a.ctx.Logger.Warn("rate limiting is disabled")
+		return nil, nil, nil
+	}
+
+	clientIP, err := ratelimit.NewClientIP(rateLimit.TrustedProxies)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if rateLimit.Store == "postgres" {
+		store = ratelimit.NewPostgresStore(repo)
+	}
+
+	limiter := ratelimit.NewLimiter(store, map[string]ratelimit.Limit{
+		ratelimit.ClassRead:        {Requests: rateLimit.Read.Requests, Window: rateLimit.Read.Window},
+		ratelimit.ClassWrite:       {Requests: rateLimit.Write.Requests, Window: rateLimit.Write.Window},
+		ratelimit.ClassImport:      {Requests: rateLimit.Import.Requests, Window: rateLimit.Import.Window},
+		ratelimit.ClassAuthFailure: {Requests: rateLimit.AuthFailures.Requests, Window: rateLimit.AuthFailures.Window},
+	})
+	a.ctx.Logger.Infof("rate limiting with %s store", rateLimit.Store)
+
+	return limiter, clientIP, nil
+}
+
+// initHealth sets up the readiness checks: the DB answers, its schema is at
+// the latest migration shipped with the app and, unless turned off, some
+// details provider is not cut off by its circuit breaker.
+func (a *App) initHealth(s *music.ImplMusic) error {
+	migrations, err := goose.CollectMigrations(migrationsDir, 0, goose.MaxVersion)
+	if err != nil {
+		return err
+	}
+	latest, err := migrations.Last()
+	if err != nil {
+		return err
+	}
+
+	checks := []health.Check{
+		{Name: "database", Func: a.db.PingContext},
+		{Name: "migrations", Func: func(ctx context.Context) error {
+			version, err := goose.GetDBVersionContext(ctx, a.db.DB)
+			if err != nil {
+				return err
+			}
+			if version != latest.Version {
+				return fmt.Errorf("database is at migration %d, expected %d", version, latest.Version)
+			}
+			return nil
+		}},
+	}
+	if detailsCheck := a.config.Health.DetailsCheck; detailsCheck != "off" {
+		checks = append(checks, health.Check{
+			Name:     "details",
+			Optional: detailsCheck == "optional",
+			Func: func(ctx context.Context) error {
+				return s.CheckDetailsProviders(utils.NewMyContext(ctx, a.ctx.Logger))
+			},
+		})
+	}
+
+	a.health = health.NewChecker(a.config.Health.CheckTimeout, checks...)
+	return nil
+}
+
+// initMetrics registers the DB pool and song metrics and sets up the server
+// exposing /metrics on the metrics port.
+func (a *App) initMetrics(s *music.ImplMusic) error {
+	if err := prometheus.Register(collectors.NewDBStatsCollector(a.db.DB, "songs")); err != nil {
+		return err
+	}
+
+	songStats := func(ctx context.Context) (metrics.SongStats, error) {
+		stats, err := s.GetSongStats(utils.NewMyContext(ctx, a.ctx.Logger))
+		return metrics.SongStats{Total: stats.Total, Pending: stats.Pending}, err
+	}
+	if err := prometheus.Register(metrics.NewSongStatsCollector(songStats, metricsScrapeTimeout, songStatsMaxAge)); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	a.metrics = &http.Server{
+		Addr:              a.config.MetricsPort,
+		Handler:           mux,
+		ReadHeaderTimeout: metricsScrapeTimeout,
+	}
+
+	return nil
+}
+
+// newDetailsTransport builds the transport shared by the details providers:
+// the configured connection settings.
+func (a *App) newDetailsTransport() (http.RoundTripper, error) {
+	httpConfig := a.config.DetailsHTTP
+
+	transport, err := details.NewTransport(details.TransportConfig{
+		ProxyURL:            httpConfig.ProxyURL,
+		CAFile:              httpConfig.CAFile,
+		ClientCertFile:      httpConfig.ClientCertFile,
+		ClientKeyFile:       httpConfig.ClientKeyFile,
+		ConnectTimeout:      httpConfig.ConnectTimeout,
+		TLSHandshakeTimeout: httpConfig.TLSHandshakeTimeout,
+		ResponseTimeout:     httpConfig.ResponseTimeout,
+		MaxIdleConns:        httpConfig.MaxIdleConns,
+		MaxIdleConnsPerHost: httpConfig.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     httpConfig.MaxConnsPerHost,
+		IdleConnTimeout:     httpConfig.IdleConnTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transport, nil
+}
+
+// newProviderTransport adds the headers of one details provider on top of the
+// shared transport, so that its credentials are not sent to the others.
+func newProviderTransport(transport http.RoundTripper, provider config.DetailsProviderConfig) (http.RoundTripper, error) {
+	if len(provider.Headers) == 0 {
+		return transport, nil
+	}
+
+	headers := make([]details.Header, 0, len(provider.Headers))
+	for _, header := range provider.Headers {
+		headers = append(headers, details.Header{Name: header.Name, Value: header.Value, File: header.File, Prefix: header.Prefix})
+	}
+
+	headerTransport, err := details.NewHeaderTransport(transport, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return headerTransport, nil
+}
+
+// newDetailsClient builds the HTTP client of one details provider: retries
+// over the shared transport, bounded by the overall timeout. The limiter sits
+// below the retries, so that every attempt counts against the provider limits.
+func (a *App) newDetailsClient(transport http.RoundTripper, limiter *details.Limiter, provider string) *http.Client {
+	resilience := a.config.DetailsResilience
+
+	return &http.Client{
+		Timeout: a.config.DetailsHTTP.Timeout,
+		Transport: details.NewRetryTransport(details.NewLimitedTransport(transport, limiter, provider), details.RetryPolicy{
+			MaxAttempts:    resilience.RetryMaxAttempts,
+			InitialBackoff: resilience.RetryInitialBackoff,
+			MaxBackoff:     resilience.RetryMaxBackoff,
+			MaxRetryAfter:  resilience.RetryMaxRetryAfter,
+		}),
+	}
 }
 
 func (a *App) Run() error {
@@ -86,10 +406,34 @@ func (a *App) Run() error {
 	}()
 
 	a.ctx.Logger.Info("HTTP server is running")
+
+	go func() {
+		a.ctx.Logger.Infof("serving metrics on %s", a.config.MetricsPort)
+		if err := a.metrics.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.ctx.Logger.Errorf("metrics server stopped: %v", err)
+		}
+	}()
+
+	if a.enrichment != nil {
+		a.enrichment.Start(a.ctx)
+	}
+	if a.refresh != nil {
+		a.refresh.Start(a.ctx)
+	}
+
 	return nil
 }
 
 func (a *App) Shutdown(ctx context.Context) error {
+	// report unready first, so that load balancers stop routing new requests
+	// before the server stops accepting them
+	a.health.Drain()
+	a.ctx.Logger.Infof("draining for %s before shutdown", a.config.Health.DrainDelay)
+	select {
+	case <-time.After(a.config.Health.DrainDelay):
+	case <-ctx.Done():
+	}
+
 	a.ctx.Logger.Info("shutting down HTTP server")
 
 	err := a.server.Shutdown(ctx)
@@ -98,11 +442,29 @@ func (a *App) Shutdown(ctx context.Context) error {
 		return err
 	}
 
+	if err = a.metrics.Shutdown(ctx); err != nil {
+		a.ctx.Logger.Warnf("failed to shut down metrics server: %v", err)
+	}
+
+	if a.enrichment != nil {
+		a.ctx.Logger.Info("stopping enrichment workers")
+		a.enrichment.Stop()
+	}
+	if a.refresh != nil {
+		a.refresh.Stop()
+	}
+
 	err = a.db.Close()
 	if err != nil {
 		a.ctx.Logger.Errorf("failed to disconnect from BD: %v", err)
 	}
 
+	if a.shutdownTracing != nil {
+		if err = a.shutdownTracing(ctx); err != nil {
+			a.ctx.Logger.Warnf("failed to flush trace spans: %v", err)
+		}
+	}
+
 	a.ctx.Logger.Info("server shut down successfully")
 	return nil
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/pkg/repository"
+	"effectiveMobileTest/pkg/service/apikeys"
+)
+
+const keysUsage = `usage:
+  app keys create -name NAME -scopes SCOPE[,SCOPE...] [-expires DURATION]
+  app keys list
+  app keys revoke ID`
+
+// RunKeysCommand issues, lists and revokes API keys from the command line,
+// so that the first admin key can be created before any exists.
+func (a *App) RunKeysCommand(args []string) error {
+	service := apikeys.NewAPIKeyService(repository.NewPostgres(a.db))
+
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		name := flags.String("name", "", "name of the key owner")
+		scopes := flags.String("scopes", "", "comma-separated scopes: songs:read, songs:write, songs:delete, admin")
+		expires := flags.Duration("expires", 0, "lifetime of the key, 0 for a key that never expires")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		req := models.CreateAPIKeyRequest{Name: *name}
+		if *scopes != "" {
+			req.Scopes = strings.Split(*scopes, ",")
+		}
+		if *expires > 0 {
+			expiresAt := time.Now().Add(*expires)
+			req.ExpiresAt = &expiresAt
+		}
+
+		key, err := service.Create(a.ctx, req)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("id:     %s\nscopes: %s\nkey:    %s\n", key.Id, strings.Join(key.Scopes, ","), key.Key)
+		fmt.Println("store the key now, it cannot be shown again")
+		return nil
+	case "list":
+		keys, err := service.List(a.ctx)
+		if err != nil {
+			return err
+		}
+
+		printAPIKeys(os.Stdout, keys)
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(keysUsage)
+		}
+
+		if err := service.Revoke(a.ctx, args[1]); err != nil {
+			return err
+		}
+
+		fmt.Printf("API key %s revoked\n", args[1])
+		return nil
+	default:
+		return errors.New(keysUsage)
+	}
+}
+
+func printAPIKeys(w io.Writer, keys []models.APIKey) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES\tLAST USED\tREVOKED")
+
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	}
+	for _, key := range keys {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.Id, key.Name, key.Prefix, strings.Join(key.Scopes, ","),
+			formatTime(key.ExpiresAt), formatTime(key.LastUsedAt), formatTime(key.RevokedAt))
+	}
+
+	table.Flush()
+}
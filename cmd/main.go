@@ -19,6 +19,13 @@ import (
 // @description Music API that allows you to add, get, update and delete songs
 // @host localhost:81
 // @BasePath /api
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT issued by the SSO, as "Bearer <token>"
 func main() {
 	mainCtx := context.Background()
 	ctx, cancel := context.WithCancel(mainCtx)
@@ -37,6 +44,10 @@ func main() {
 
 	app := NewApp(ctx, logger, cfg)
 
+	if err = app.InitTracing(); err != nil {
+		logger.Fatalf("failed to initialize tracing: %s", err.Error())
+	}
+
 	if err = app.InitDatabase(); err != nil {
 		logger.Fatalf("failed to initialize db: %s", err.Error())
 	}
@@ -45,7 +56,16 @@ func main() {
 		logger.Fatalf("failed to run migrations: %s", err.Error())
 	}
 
-	app.InitService()
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		if err = app.RunKeysCommand(os.Args[2:]); err != nil {
+			logger.Fatalf("keys command failed: %s", err.Error())
+		}
+		return
+	}
+
+	if err = app.InitService(); err != nil {
+		logger.Fatalf("failed to initialize services: %s", err.Error())
+	}
 
 	if err = app.Run(); err != nil {
 		logger.Errorf(err.Error())
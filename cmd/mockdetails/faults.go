@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault modes selected with the X-Mock-Fault header, the fault query parameter,
+// the -fault flag or the faults field of a fixture. Several modes are separated
+// by commas.
+const (
+	// FaultLatency delays the answer by X-Mock-Latency (default 2s).
+	FaultLatency = "latency"
+	// FaultError answers with X-Mock-Status (default 500).
+	FaultError = "error"
+	// FaultMalformed answers with a truncated JSON body.
+	FaultMalformed = "malformed"
+	// FaultPartial leaves out the fields not listed in X-Mock-Fields (default
+	// everything but text).
+	FaultPartial = "partial"
+	// FaultDateFormat formats the release date as X-Mock-Date-Format: iso,
+	// us, text or unix (default iso).
+	FaultDateFormat = "date-format"
+	// FaultNotFound answers 404 even if the song has a fixture.
+	FaultNotFound = "notfound"
+)
+
+const (
+	faultHeader      = "X-Mock-Fault"
+	latencyHeader    = "X-Mock-Latency"
+	statusHeader     = "X-Mock-Status"
+	fieldsHeader     = "X-Mock-Fields"
+	dateFormatHeader = "X-Mock-Date-Format"
+)
+
+// Faults is the set of fault modes applied to one request and their settings.
+type Faults struct {
+	modes      map[string]bool
+	Latency    time.Duration
+	Status     int
+	Fields     []string
+	DateFormat string
+}
+
+func newFaults() Faults {
+	return Faults{
+		modes:      make(map[string]bool),
+		Latency:    2 * time.Second,
+		Status:     http.StatusInternalServerError,
+		Fields:     []string{"text"},
+		DateFormat: "iso",
+	}
+}
+
+// ValidateModes checks that every mode is a known fault mode.
+func ValidateModes(modes []string) error {
+	faults := newFaults()
+	for _, mode := range modes {
+		if err := faults.Add(mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseFaults collects the fault modes of a request: the defaults, then those
+// from the X-Mock-Fault header and the fault query parameter.
+func ParseFaults(r *http.Request, defaults []string) (Faults, error) {
+	faults := newFaults()
+
+	var modes []string
+	modes = append(modes, defaults...)
+	modes = append(modes, splitList(r.Header.Get(faultHeader))...)
+	modes = append(modes, splitList(r.URL.Query().Get("fault"))...)
+	for _, mode := range modes {
+		if err := faults.Add(mode); err != nil {
+			return Faults{}, err
+		}
+	}
+
+	if value := r.Header.Get(latencyHeader); value != "" {
+		latency, err := time.ParseDuration(value)
+		if err != nil {
+			return Faults{}, fmt.Errorf("invalid %s: %s", latencyHeader, value)
+		}
+		faults.Latency = latency
+	}
+	if value := r.Header.Get(statusHeader); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 100 || status > 599 {
+			return Faults{}, fmt.Errorf("invalid %s: %s", statusHeader, value)
+		}
+		faults.Status = status
+	}
+	if value := r.Header.Get(fieldsHeader); value != "" {
+		faults.Fields = splitList(value)
+	}
+	if value := r.Header.Get(dateFormatHeader); value != "" {
+		faults.DateFormat = value
+	}
+
+	return faults, nil
+}
+
+// Add enables a fault mode.
+func (f *Faults) Add(mode string) error {
+	switch mode {
+	case FaultLatency, FaultError, FaultMalformed, FaultPartial, FaultDateFormat, FaultNotFound:
+		f.modes[mode] = true
+		return nil
+	default:
+		return fmt.Errorf("unknown fault mode: %s", mode)
+	}
+}
+
+func (f *Faults) Has(mode string) bool {
+	return f.modes[mode]
+}
+
+// FormatDate rewrites a DD.MM.YYYY release date in the selected format.
+func (f *Faults) FormatDate(date string) (string, error) {
+	parsed, err := time.Parse("02.01.2006", date)
+	if err != nil {
+		return date, nil
+	}
+
+	switch f.DateFormat {
+	case "iso":
+		return parsed.Format("2006-01-02"), nil
+	case "us":
+		return parsed.Format("01/02/2006"), nil
+	case "text":
+		return parsed.Format("January 2, 2006"), nil
+	case "unix":
+		return strconv.FormatInt(parsed.Unix(), 10), nil
+	default:
+		return "", fmt.Errorf("invalid %s: %s", dateFormatHeader, f.DateFormat)
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is the canned answer for one song. Faults, if set, are applied to
+// every request for the song on top of those selected by the request.
+type Fixture struct {
+	Group       string   `json:"group" yaml:"group"`
+	Song        string   `json:"song" yaml:"song"`
+	ReleaseDate string   `json:"releaseDate" yaml:"releaseDate"`
+	Text        string   `json:"text" yaml:"text"`
+	Link        string   `json:"link" yaml:"link"`
+	Faults      []string `json:"faults,omitempty" yaml:"faults,omitempty"`
+}
+
+// Fixtures indexes fixtures by case-insensitive group and song.
+type Fixtures map[string]Fixture
+
+// LoadFixtures reads every .json, .yaml and .yml file in dir. A file holds
+// either a single fixture or a list of them.
+func LoadFixtures(dir string) (Fixtures, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures directory: %w", err)
+	}
+
+	fixtures := make(Fixtures)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		var list []Fixture
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json":
+			list, err = decodeFixtures(path, json.Unmarshal)
+		case ".yaml", ".yml":
+			list, err = decodeFixtures(path, yaml.Unmarshal)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fixture := range list {
+			if fixture.Group == "" || fixture.Song == "" {
+				return nil, fmt.Errorf("fixture in %s is missing group or song", path)
+			}
+			fixtures[fixtureKey(fixture.Group, fixture.Song)] = fixture
+		}
+	}
+
+	return fixtures, nil
+}
+
+func (f Fixtures) Find(group, song string) (Fixture, bool) {
+	fixture, ok := f[fixtureKey(group, song)]
+	return fixture, ok
+}
+
+func decodeFixtures(path string, unmarshal func([]byte, any) error) ([]Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture file: %w", err)
+	}
+
+	var list []Fixture
+	if err = unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+
+	var single Fixture
+	if err = unmarshal(data, &single); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture file %s: %w", path, err)
+	}
+
+	return []Fixture{single}, nil
+}
+
+func fixtureKey(group, song string) string {
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	}
+
+	return normalize(group) + "\x00" + normalize(song)
+}
@@ -0,0 +1,44 @@
+// Command mockdetails is a stand-in for the song details API used by the app
+// during local development and tests. It serves /info?group=&song= from a
+// directory of JSON or YAML fixtures and injects faults on request, see
+// faults.go for the available modes.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"go.uber.org/zap/zapcore"
+
+	"effectiveMobileTest/utils"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	fixturesDir := flag.String("fixtures", "./cmd/mockdetails/fixtures", "directory with JSON or YAML fixtures")
+	fault := flag.String("fault", "", "comma-separated fault modes applied to every request")
+	flag.Parse()
+
+	logger, err := utils.NewLogger(zapcore.InfoLevel)
+	if err != nil {
+		log.Fatalf("failed to initialize logger: %v", err)
+	}
+	defer logger.Sync()
+
+	fixtures, err := LoadFixtures(*fixturesDir)
+	if err != nil {
+		logger.Fatalf("failed to load fixtures: %v", err)
+	}
+
+	defaults := splitList(*fault)
+	if err = ValidateModes(defaults); err != nil {
+		logger.Fatalf("invalid -fault: %v", err)
+	}
+
+	logger.Infof("serving %d fixtures on %s", len(fixtures), *addr)
+
+	if err = http.ListenAndServe(*addr, NewServer(fixtures, defaults, logger).Handler()); err != nil {
+		logger.Fatalf("server stopped: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Server answers /info?group=&song= like the song details API, from fixtures
+// and with the requested faults injected.
+type Server struct {
+	fixtures Fixtures
+	defaults []string
+	logger   *zap.SugaredLogger
+}
+
+func NewServer(fixtures Fixtures, defaults []string, logger *zap.SugaredLogger) *Server {
+	return &Server{
+		fixtures: fixtures,
+		defaults: defaults,
+		logger:   logger,
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", s.info)
+
+	return mux
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	group, song := r.URL.Query().Get("group"), r.URL.Query().Get("song")
+	if group == "" || song == "" {
+		http.Error(w, "missing group or song", http.StatusBadRequest)
+		return
+	}
+
+	faults, err := ParseFaults(r, s.defaults)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fixture, found := s.fixtures.Find(group, song)
+	for _, mode := range fixture.Faults {
+		if err = faults.Add(mode); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.logger.Infof("GET /info group=%q song=%q found=%t faults=%v", group, song, found, faults.modes)
+
+	if faults.Has(FaultLatency) {
+		select {
+		case <-time.After(faults.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if faults.Has(FaultError) {
+		http.Error(w, "injected fault", faults.Status)
+		return
+	}
+	if !found || faults.Has(FaultNotFound) {
+		http.Error(w, "song not found", http.StatusNotFound)
+		return
+	}
+
+	details := map[string]string{
+		"releaseDate": fixture.ReleaseDate,
+		"text":        fixture.Text,
+		"link":        fixture.Link,
+	}
+
+	if faults.Has(FaultDateFormat) {
+		if details["releaseDate"], err = faults.FormatDate(fixture.ReleaseDate); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if faults.Has(FaultPartial) {
+		for field := range details {
+			if !slices.Contains(faults.Fields, field) {
+				delete(details, field)
+			}
+		}
+	}
+
+	body, err := json.Marshal(details)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if faults.Has(FaultMalformed) {
+		body = body[:len(body)/2]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
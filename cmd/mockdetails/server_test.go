@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func testServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	fixtures, err := LoadFixtures("fixtures")
+	if err != nil {
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+
+	return NewServer(fixtures, nil, zap.NewNop().Sugar()).Handler()
+}
+
+func get(handler http.Handler, group, song string, headers map[string]string) *httptest.ResponseRecorder {
+	query := url.Values{"group": {group}, "song": {song}}
+	r := httptest.NewRequest(http.MethodGet, "/info?"+query.Encode(), nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestInfo(t *testing.T) {
+	handler := testServer(t)
+
+	w := get(handler, "muse", "supermassive  black hole", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var details map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &details); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if details["releaseDate"] != "16.07.2006" || details["text"] == "" || details["link"] == "" {
+		t.Errorf("unexpected details: %v", details)
+	}
+
+	if w = get(handler, "Unknown", "Song", nil); w.Code != http.StatusNotFound {
+		t.Errorf("status for unknown song = %d, want 404", w.Code)
+	}
+}
+
+func TestInfoFaults(t *testing.T) {
+	handler := testServer(t)
+
+	w := get(handler, "Muse", "Supermassive Black Hole", map[string]string{faultHeader: "error", statusHeader: "503"})
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("error fault status = %d, want 503", w.Code)
+	}
+
+	w = get(handler, "Muse", "Supermassive Black Hole", map[string]string{faultHeader: "malformed"})
+	if json.Valid(w.Body.Bytes()) {
+		t.Errorf("malformed fault returned valid JSON: %s", w.Body.String())
+	}
+
+	var details map[string]string
+
+	w = get(handler, "Muse", "Supermassive Black Hole", map[string]string{faultHeader: "partial,date-format", fieldsHeader: "releaseDate", dateFormatHeader: "us"})
+	if err := json.Unmarshal(w.Body.Bytes(), &details); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(details) != 1 || details["releaseDate"] != "07/16/2006" {
+		t.Errorf("partial and date-format faults returned %v", details)
+	}
+
+	details = nil
+	w = get(handler, "Partial Band", "No Link", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &details); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if _, ok := details["link"]; ok || details["text"] == "" {
+		t.Errorf("fixture fault was not applied: %v", details)
+	}
+
+	if w = get(handler, "Muse", "Supermassive Black Hole", map[string]string{faultHeader: "explode"}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown fault status = %d, want 400", w.Code)
+	}
+}
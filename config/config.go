@@ -4,27 +4,343 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.uber.org/zap/zapcore"
 )
 
 const (
-	serverPortEnv     = "SERVER_PORT"
-	dbHostEnv         = "DB_HOST"
-	dbPortEnv         = "DB_PORT"
-	dbUserEnv         = "DB_USER"
-	dbNameEnv         = "DB_NAME"
-	dbPasswordEnv     = "DB_PASSWORD"
-	dbSSLModeEnv      = "DB_SSLMODE"
-	externalAPIUrlEnv = "EXTERNAL_API_URL"
+	serverPortEnv       = "SERVER_PORT"
+	metricsPortEnv      = "METRICS_PORT"
+	dbHostEnv           = "DB_HOST"
+	dbPortEnv           = "DB_PORT"
+	dbUserEnv           = "DB_USER"
+	dbNameEnv           = "DB_NAME"
+	dbPasswordEnv       = "DB_PASSWORD"
+	dbSSLModeEnv        = "DB_SSLMODE"
+	externalAPIUrlEnv   = "EXTERNAL_API_URL"
+	detailsProvidersEnv = "DETAILS_PROVIDERS"
+
+	detailsRetryMaxAttemptsEnv        = "DETAILS_RETRY_MAX_ATTEMPTS"
+	detailsRetryInitialBackoffEnv     = "DETAILS_RETRY_INITIAL_BACKOFF"
+	detailsRetryMaxBackoffEnv         = "DETAILS_RETRY_MAX_BACKOFF"
+	detailsRetryMaxRetryAfterEnv      = "DETAILS_RETRY_MAX_RETRY_AFTER"
+	detailsBreakerThresholdEnv        = "DETAILS_BREAKER_FAILURE_THRESHOLD"
+	detailsBreakerOpenTimeoutEnv      = "DETAILS_BREAKER_OPEN_TIMEOUT"
+	detailsRateLimitEnv               = "DETAILS_RATE_LIMIT"
+	detailsRateBurstEnv               = "DETAILS_RATE_BURST"
+	detailsMaxInFlightEnv             = "DETAILS_MAX_IN_FLIGHT"
+	detailsMaxQueueEnv                = "DETAILS_MAX_QUEUE"
+	detailsMaxQueueWaitEnv            = "DETAILS_MAX_QUEUE_WAIT"
+	detailsHTTPProxyEnv               = "DETAILS_HTTP_PROXY"
+	detailsHTTPCAFileEnv              = "DETAILS_HTTP_CA_FILE"
+	detailsHTTPClientCertFileEnv      = "DETAILS_HTTP_CLIENT_CERT_FILE"
+	detailsHTTPClientKeyFileEnv       = "DETAILS_HTTP_CLIENT_KEY_FILE"
+	detailsHTTPHeadersEnv             = "DETAILS_HTTP_HEADERS"
+	detailsHTTPBearerTokenFileEnv     = "DETAILS_HTTP_BEARER_TOKEN_FILE"
+	detailsHTTPTimeoutEnv             = "DETAILS_HTTP_TIMEOUT"
+	detailsHTTPConnectTimeoutEnv      = "DETAILS_HTTP_CONNECT_TIMEOUT"
+	detailsHTTPTLSTimeoutEnv          = "DETAILS_HTTP_TLS_TIMEOUT"
+	detailsHTTPResponseTimeoutEnv     = "DETAILS_HTTP_RESPONSE_TIMEOUT"
+	detailsHTTPMaxIdleConnsEnv        = "DETAILS_HTTP_MAX_IDLE_CONNS"
+	detailsHTTPMaxIdleConnsPerHostEnv = "DETAILS_HTTP_MAX_IDLE_CONNS_PER_HOST"
+	detailsHTTPMaxConnsPerHostEnv     = "DETAILS_HTTP_MAX_CONNS_PER_HOST"
+	detailsHTTPIdleConnTimeoutEnv     = "DETAILS_HTTP_IDLE_CONN_TIMEOUT"
+	detailsCacheTTLEnv                = "DETAILS_CACHE_TTL"
+	detailsCacheNegativeTTLEnv        = "DETAILS_CACHE_NEGATIVE_TTL"
+
+	similarLimitEnv       = "SIMILAR_LIMIT"
+	similarTextWeightEnv  = "SIMILAR_TEXT_WEIGHT"
+	similarGroupWeightEnv = "SIMILAR_GROUP_WEIGHT"
+	similarEraWeightEnv   = "SIMILAR_ERA_WEIGHT"
+	similarEraWindowEnv   = "SIMILAR_ERA_WINDOW_YEARS"
+
+	enrichmentModeEnv         = "ENRICHMENT_MODE"
+	enrichmentPolicyEnv       = "ENRICHMENT_POLICY"
+	enrichmentWorkersEnv      = "ENRICHMENT_WORKERS"
+	enrichmentPollIntervalEnv = "ENRICHMENT_POLL_INTERVAL"
+	enrichmentLeaseEnv        = "ENRICHMENT_LEASE"
+	enrichmentMaxAttemptsEnv  = "ENRICHMENT_MAX_ATTEMPTS"
+	enrichmentRetryDelayEnv   = "ENRICHMENT_RETRY_DELAY"
+
+	refreshIntervalEnv  = "REFRESH_INTERVAL"
+	refreshStaleDaysEnv = "REFRESH_STALE_DAYS"
+	refreshBatchSizeEnv = "REFRESH_BATCH_SIZE"
+
+	tracingExporterEnv     = "TRACING_EXPORTER"
+	tracingOTLPEndpointEnv = "TRACING_OTLP_ENDPOINT"
+	tracingOTLPInsecureEnv = "TRACING_OTLP_INSECURE"
+	tracingFileEnv         = "TRACING_FILE"
+	tracingSampleRatioEnv  = "TRACING_SAMPLE_RATIO"
+
+	healthCheckTimeoutEnv = "HEALTH_CHECK_TIMEOUT"
+	healthDetailsCheckEnv = "HEALTH_DETAILS_CHECK"
+	shutdownDrainDelayEnv = "SHUTDOWN_DRAIN_DELAY"
+
+	authEnabledEnv     = "AUTH_ENABLED"
+	authPublicReadsEnv = "AUTH_PUBLIC_READS"
+	jwtSecretEnv       = "JWT_SECRET"
+	jwtJWKSFileEnv     = "JWT_JWKS_FILE"
+	jwtIssuerEnv       = "JWT_ISSUER"
+	jwtAudienceEnv     = "JWT_AUDIENCE"
+	jwtRolesClaimEnv   = "JWT_ROLES_CLAIM"
+	jwtRoleMappingEnv  = "JWT_ROLE_MAPPING"
+	jwtLeewayEnv       = "JWT_LEEWAY"
+
+	rateLimitEnabledEnv        = "RATE_LIMIT_ENABLED"
+	rateLimitStoreEnv          = "RATE_LIMIT_STORE"
+	rateLimitReadEnv           = "RATE_LIMIT_READ"
+	rateLimitWriteEnv          = "RATE_LIMIT_WRITE"
+	rateLimitImportEnv         = "RATE_LIMIT_IMPORT"
+	rateLimitAuthFailuresEnv   = "RATE_LIMIT_AUTH_FAILURES"
+	rateLimitTrustedProxiesEnv = "RATE_LIMIT_TRUSTED_PROXIES"
+
+	serverTLSCertFileEnv = "SERVER_TLS_CERT_FILE"
+	serverTLSKeyFileEnv  = "SERVER_TLS_KEY_FILE"
+
+	corsAllowedOriginsEnv   = "CORS_ALLOWED_ORIGINS"
+	corsAllowedMethodsEnv   = "CORS_ALLOWED_METHODS"
+	corsAllowedHeadersEnv   = "CORS_ALLOWED_HEADERS"
+	corsExposedHeadersEnv   = "CORS_EXPOSED_HEADERS"
+	corsAllowCredentialsEnv = "CORS_ALLOW_CREDENTIALS"
+	corsMaxAgeEnv           = "CORS_MAX_AGE"
+
+	securityCSPEnv            = "SECURITY_CSP"
+	securityCSPRoutesEnv      = "SECURITY_CSP_ROUTES"
+	securityReferrerPolicyEnv = "SECURITY_REFERRER_POLICY"
+	securityHSTSMaxAgeEnv     = "SECURITY_HSTS_MAX_AGE"
+
+	compressionEnabledEnv        = "COMPRESSION_ENABLED"
+	compressionEncodingsEnv      = "COMPRESSION_ENCODINGS"
+	compressionMinSizeEnv        = "COMPRESSION_MIN_SIZE"
+	compressionContentTypesEnv   = "COMPRESSION_CONTENT_TYPES"
+	compressionMaxDecodedSizeEnv = "COMPRESSION_MAX_DECODED_SIZE"
+)
+
+const (
+	defaultCSP        = "default-src 'none'; frame-ancestors 'none'"
+	defaultSwaggerCSP = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; " +
+		"img-src 'self' data:; frame-ancestors 'none'"
 )
 
 type Config struct {
 	ServerPort         string
+	MetricsPort        string
 	DBConnectionString string
 	SongDetailsAPIUrl  string
+	DetailsProviders   []DetailsProviderConfig
+	DetailsResilience  DetailsResilienceConfig
+	DetailsHTTP        DetailsHTTPConfig
+	DetailsCache       DetailsCacheConfig
 	LoggerLevel        zapcore.Level
+	Similarity         SimilarityConfig
+	Enrichment         EnrichmentConfig
+	Refresh            RefreshConfig
+	Tracing            TracingConfig
+	Health             HealthConfig
+	Auth               AuthConfig
+	RateLimit          RateLimitConfig
+	TLS                TLSConfig
+	CORS               CORSConfig
+	Security           SecurityConfig
+	Compression        CompressionConfig
+}
+
+// DetailsProviderConfig describes one song details API. URL is either a base
+// URL of an API serving /info?group=&song=, or a template with {group} and
+// {song} placeholders. Headers, such as credentials, are sent to this API only.
+type DetailsProviderConfig struct {
+	Name    string
+	URL     string
+	Headers []HeaderConfig
+}
+
+// DetailsResilienceConfig controls retries of failed requests to the details
+// providers, the circuit breaker that stops calling a provider while it is down,
+// and the per-provider limits on request rate and requests in flight.
+type DetailsResilienceConfig struct {
+	RetryMaxAttempts        int
+	RetryInitialBackoff     time.Duration
+	RetryMaxBackoff         time.Duration
+	RetryMaxRetryAfter      time.Duration
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+	RateLimit               float64
+	RateBurst               int
+	MaxInFlight             int
+	MaxQueue                int
+	MaxQueueWait            time.Duration
+}
+
+// DetailsHTTPConfig configures the HTTP client used for the details
+// providers: proxy, TLS, timeouts and the connection pool. Timeout bounds a whole lookup including retries, the other
+// timeouts bound single phases of one attempt.
+type DetailsHTTPConfig struct {
+	ProxyURL            string
+	CAFile              string
+	ClientCertFile      string
+	ClientKeyFile       string
+	Timeout             time.Duration
+	ConnectTimeout      time.Duration
+	TLSHandshakeTimeout time.Duration
+	ResponseTimeout     time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+}
+
+// HeaderConfig is a header sent to a details provider. The value is read from
+// File when it is set.
+type HeaderConfig struct {
+	Name   string
+	Value  string
+	File   string
+	Prefix string
+}
+
+// DetailsCacheConfig sets how long song details answers are cached. A zero
+// TTL disables the cache, a zero NegativeTTL disables caching of "not found".
+type DetailsCacheConfig struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+// SimilarityConfig tunes the "similar songs" ranking: the default number of
+// results and the weights of lyrics, group and era similarity.
+type SimilarityConfig struct {
+	Limit          int
+	TextWeight     float64
+	GroupWeight    float64
+	EraWeight      float64
+	EraWindowYears float64
+}
+
+// EnrichmentConfig selects whether song details are fetched for new songs, if
+// so whether while the song is being added or later by background workers,
+// and tunes those workers.
+type EnrichmentConfig struct {
+	Policy       string
+	Async        bool
+	Workers      int
+	PollInterval time.Duration
+	Lease        time.Duration
+	MaxAttempts  int
+	RetryDelay   time.Duration
+}
+
+// RefreshConfig controls the scheduled refresh of song details older than
+// StaleDays. A zero Interval disables the schedule.
+type RefreshConfig struct {
+	Interval  time.Duration
+	StaleDays int
+	BatchSize int
+}
+
+// TracingConfig selects the exporter of OpenTelemetry spans: none, otlp to an
+// OTLP/HTTP collector at OTLPEndpoint, or stdout, written to File when it is
+// set. SampleRatio is the share of traces started here that are sampled.
+type TracingConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	OTLPInsecure bool
+	File         string
+	SampleRatio  float64
+}
+
+// HealthConfig tunes the readiness and health checks. DetailsCheck is off,
+// optional (reported without affecting readiness) or required. DrainDelay is
+// how long the app reports unready before the server shuts down.
+type HealthConfig struct {
+	CheckTimeout time.Duration
+	DetailsCheck string
+	DrainDelay   time.Duration
+}
+
+// AuthConfig turns authentication with API keys and JWTs on. With
+// PublicReads, endpoints that only read songs need no credentials.
+type AuthConfig struct {
+	Enabled     bool
+	PublicReads bool
+	JWT         JWTConfig
+}
+
+// JWTConfig configures bearer JWTs issued by an SSO. They are accepted when a
+// Secret (HS256) or a JWKSFile (RS256, ES256) is set. RoleMapping translates
+// SSO role names to viewer, editor or admin.
+type JWTConfig struct {
+	Secret      string
+	JWKSFile    string
+	Issuer      string
+	Audience    string
+	RolesClaim  string
+	RoleMapping map[string]string
+	Leeway      time.Duration
+}
+
+// RateLimitConfig limits the requests of each client per route class and the
+// failed authentications of each address. Store is memory, counting per
+// instance, or postgres, shared by all instances.
+// X-Forwarded-For is only trusted from TrustedProxies, given as addresses or
+// CIDR prefixes.
+type RateLimitConfig struct {
+	Enabled        bool
+	Store          string
+	Read           RateLimitRule
+	Write          RateLimitRule
+	Import         RateLimitRule
+	AuthFailures   RateLimitRule
+	TrustedProxies []string
+}
+
+// RateLimitRule allows Requests per Window. Zero Requests disables the limit.
+type RateLimitRule struct {
+	Requests int64
+	Window   time.Duration
+}
+
+// TLSConfig makes the server serve HTTPS with the certificate and key in
+// these files when both are set.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CORSConfig allows browsers on other origins to call the API. CORS is off
+// while AllowedOrigins is empty.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// SecurityConfig sets the security headers of responses. RouteCSP overrides
+// the ContentSecurityPolicy under path prefixes. HSTS is sent over TLS only,
+// a zero HSTSMaxAge disables it.
+type SecurityConfig struct {
+	ContentSecurityPolicy string
+	RouteCSP              map[string]string
+	ReferrerPolicy        string
+	HSTSMaxAge            time.Duration
+}
+
+// CompressionConfig controls compression of responses with the Encodings
+// accepted by the client, in preference order. Responses shorter than MinSize
+// bytes or of other ContentTypes are not compressed. Compressed request bodies
+// may decode to at most MaxDecodedSize bytes.
+type CompressionConfig struct {
+	Enabled        bool
+	Encodings      []string
+	MinSize        int
+	ContentTypes   []string
+	MaxDecodedSize int
 }
 
 func NewConfig() (Config, error) {
@@ -41,11 +357,447 @@ func NewConfig() (Config, error) {
 	}
 
 	return Config{
-		ServerPort: fmt.Sprintf(":%s", os.Getenv(serverPortEnv)),
+		ServerPort:  fmt.Sprintf(":%s", os.Getenv(serverPortEnv)),
+		MetricsPort: fmt.Sprintf(":%d", getEnvInt(metricsPortEnv, 9091)),
 		DBConnectionString: fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s",
 			os.Getenv(dbHostEnv), os.Getenv(dbPortEnv), os.Getenv(dbUserEnv),
 			os.Getenv(dbNameEnv), os.Getenv(dbPasswordEnv), os.Getenv(dbSSLModeEnv)),
 		SongDetailsAPIUrl: os.Getenv(externalAPIUrlEnv),
-		LoggerLevel:       loggerLevel,
+		DetailsProviders: parseProviderHeaders(
+			parseDetailsProviders(os.Getenv(detailsProvidersEnv), os.Getenv(externalAPIUrlEnv)),
+			os.Getenv(detailsHTTPHeadersEnv), os.Getenv(detailsHTTPBearerTokenFileEnv)),
+		DetailsResilience: DetailsResilienceConfig{
+			RetryMaxAttempts:        getEnvInt(detailsRetryMaxAttemptsEnv, 3),
+			RetryInitialBackoff:     getEnvDuration(detailsRetryInitialBackoffEnv, 200*time.Millisecond),
+			RetryMaxBackoff:         getEnvDuration(detailsRetryMaxBackoffEnv, 2*time.Second),
+			RetryMaxRetryAfter:      getEnvDuration(detailsRetryMaxRetryAfterEnv, 5*time.Second),
+			BreakerFailureThreshold: getEnvInt(detailsBreakerThresholdEnv, 5),
+			BreakerOpenTimeout:      getEnvDuration(detailsBreakerOpenTimeoutEnv, 30*time.Second),
+			RateLimit:               getEnvFloat(detailsRateLimitEnv, 5),
+			RateBurst:               getEnvInt(detailsRateBurstEnv, 5),
+			MaxInFlight:             getEnvInt(detailsMaxInFlightEnv, 10),
+			MaxQueue:                getEnvInt(detailsMaxQueueEnv, 100),
+			MaxQueueWait:            getEnvDuration(detailsMaxQueueWaitEnv, 5*time.Second),
+		},
+		DetailsHTTP: DetailsHTTPConfig{
+			ProxyURL:            os.Getenv(detailsHTTPProxyEnv),
+			CAFile:              os.Getenv(detailsHTTPCAFileEnv),
+			ClientCertFile:      os.Getenv(detailsHTTPClientCertFileEnv),
+			ClientKeyFile:       os.Getenv(detailsHTTPClientKeyFileEnv),
+			Timeout:             getEnvDuration(detailsHTTPTimeoutEnv, 10*time.Second),
+			ConnectTimeout:      getEnvDuration(detailsHTTPConnectTimeoutEnv, 5*time.Second),
+			TLSHandshakeTimeout: getEnvDuration(detailsHTTPTLSTimeoutEnv, 5*time.Second),
+			ResponseTimeout:     getEnvDuration(detailsHTTPResponseTimeoutEnv, 5*time.Second),
+			MaxIdleConns:        getEnvInt(detailsHTTPMaxIdleConnsEnv, 100),
+			MaxIdleConnsPerHost: getEnvInt(detailsHTTPMaxIdleConnsPerHostEnv, 10),
+			MaxConnsPerHost:     getEnvInt(detailsHTTPMaxConnsPerHostEnv, 0),
+			IdleConnTimeout:     getEnvDuration(detailsHTTPIdleConnTimeoutEnv, 90*time.Second),
+		},
+		DetailsCache: DetailsCacheConfig{
+			TTL:         getEnvDuration(detailsCacheTTLEnv, 24*time.Hour),
+			NegativeTTL: getEnvDuration(detailsCacheNegativeTTLEnv, time.Hour),
+		},
+		LoggerLevel: loggerLevel,
+		Similarity: SimilarityConfig{
+			Limit:          getEnvInt(similarLimitEnv, 5),
+			TextWeight:     getEnvFloat(similarTextWeightEnv, 0.7),
+			GroupWeight:    getEnvFloat(similarGroupWeightEnv, 0.2),
+			EraWeight:      getEnvFloat(similarEraWeightEnv, 0.1),
+			EraWindowYears: getEnvFloat(similarEraWindowEnv, 10),
+		},
+		Enrichment: EnrichmentConfig{
+			Policy:       parseEnrichmentPolicy(os.Getenv(enrichmentPolicyEnv)),
+			Async:        parseEnrichmentMode(os.Getenv(enrichmentModeEnv)),
+			Workers:      getEnvInt(enrichmentWorkersEnv, 2),
+			PollInterval: getEnvDuration(enrichmentPollIntervalEnv, 2*time.Second),
+			Lease:        getEnvDuration(enrichmentLeaseEnv, time.Minute),
+			MaxAttempts:  getEnvInt(enrichmentMaxAttemptsEnv, 5),
+			RetryDelay:   getEnvDuration(enrichmentRetryDelayEnv, 30*time.Second),
+		},
+		Refresh: RefreshConfig{
+			Interval:  getEnvDuration(refreshIntervalEnv, 24*time.Hour),
+			StaleDays: getEnvInt(refreshStaleDaysEnv, 30),
+			BatchSize: getEnvInt(refreshBatchSizeEnv, 50),
+		},
+		Tracing: TracingConfig{
+			Exporter:     parseTracingExporter(os.Getenv(tracingExporterEnv)),
+			OTLPEndpoint: getEnvString(tracingOTLPEndpointEnv, "localhost:4318"),
+			OTLPInsecure: getEnvBool(tracingOTLPInsecureEnv, false),
+			File:         os.Getenv(tracingFileEnv),
+			SampleRatio:  getEnvFloat(tracingSampleRatioEnv, 1),
+		},
+		Health: HealthConfig{
+			CheckTimeout: getEnvDuration(healthCheckTimeoutEnv, 2*time.Second),
+			DetailsCheck: parseHealthDetailsCheck(os.Getenv(healthDetailsCheckEnv)),
+			DrainDelay:   getEnvDuration(shutdownDrainDelayEnv, 5*time.Second),
+		},
+		Auth: AuthConfig{
+			Enabled:     getEnvBool(authEnabledEnv, true),
+			PublicReads: getEnvBool(authPublicReadsEnv, false),
+			JWT: JWTConfig{
+				Secret:      os.Getenv(jwtSecretEnv),
+				JWKSFile:    os.Getenv(jwtJWKSFileEnv),
+				Issuer:      os.Getenv(jwtIssuerEnv),
+				Audience:    os.Getenv(jwtAudienceEnv),
+				RolesClaim:  getEnvString(jwtRolesClaimEnv, "roles"),
+				RoleMapping: parseRoleMapping(os.Getenv(jwtRoleMappingEnv)),
+				Leeway:      getEnvDuration(jwtLeewayEnv, 30*time.Second),
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:        getEnvBool(rateLimitEnabledEnv, true),
+			Store:          parseRateLimitStore(os.Getenv(rateLimitStoreEnv)),
+			Read:           getEnvRateLimit(rateLimitReadEnv, RateLimitRule{Requests: 300, Window: time.Minute}),
+			Write:          getEnvRateLimit(rateLimitWriteEnv, RateLimitRule{Requests: 60, Window: time.Minute}),
+			Import:         getEnvRateLimit(rateLimitImportEnv, RateLimitRule{Requests: 10, Window: time.Minute}),
+			AuthFailures:   getEnvRateLimit(rateLimitAuthFailuresEnv, RateLimitRule{Requests: 20, Window: time.Minute}),
+			TrustedProxies: parseList(os.Getenv(rateLimitTrustedProxiesEnv)),
+		},
+		TLS: TLSConfig{
+			CertFile: os.Getenv(serverTLSCertFileEnv),
+			KeyFile:  os.Getenv(serverTLSKeyFileEnv),
+		},
+		CORS: parseCORS(),
+		Security: SecurityConfig{
+			ContentSecurityPolicy: getEnvString(securityCSPEnv, defaultCSP),
+			RouteCSP:              parseRouteCSP(getEnvString(securityCSPRoutesEnv, "/swagger/="+defaultSwaggerCSP)),
+			ReferrerPolicy:        getEnvString(securityReferrerPolicyEnv, "no-referrer"),
+			HSTSMaxAge:            getEnvDuration(securityHSTSMaxAgeEnv, 365*24*time.Hour),
+		},
+		Compression: CompressionConfig{
+			Enabled:   getEnvBool(compressionEnabledEnv, true),
+			Encodings: parseCompressionEncodings(getEnvString(compressionEncodingsEnv, "zstd,gzip")),
+			MinSize:   getEnvInt(compressionMinSizeEnv, 1024),
+			ContentTypes: parseList(getEnvString(compressionContentTypesEnv,
+				"application/json,application/problem+json,application/x-ndjson,application/javascript,text/*")),
+			MaxDecodedSize: getEnvInt(compressionMaxDecodedSizeEnv, 10<<20),
+		},
 	}, nil
 }
+
+// parseProviderHeaders reads the headers sent to the details providers: a
+// comma-separated list of provider:Name=value pairs, where a value starting
+// with @ is a path to a file holding the value, and a comma-separated list of
+// provider=path bearer token files, each adding an Authorization header. The
+// provider may be left out when there is only one.
+func parseProviderHeaders(providers []DetailsProviderConfig, value, bearerTokenFile string) []DetailsProviderConfig {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, headerValue, ok := strings.Cut(entry, "=")
+		provider, name, scoped := strings.Cut(name, ":")
+		if !scoped {
+			provider, name = "", provider
+		}
+		if !ok || name == "" {
+			fmt.Printf("invalid %s entry: %s. Skipping\n", detailsHTTPHeadersEnv, entry)
+			continue
+		}
+
+		header := HeaderConfig{Name: name, Value: headerValue}
+		if file, isFile := strings.CutPrefix(headerValue, "@"); isFile {
+			header = HeaderConfig{Name: name, File: file}
+		}
+		addProviderHeader(providers, provider, header, detailsHTTPHeadersEnv, entry)
+	}
+
+	for _, entry := range strings.Split(bearerTokenFile, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		provider, file, scoped := strings.Cut(entry, "=")
+		if !scoped {
+			provider, file = "", entry
+		}
+		addProviderHeader(providers, provider, HeaderConfig{Name: "Authorization", File: file, Prefix: "Bearer "},
+			detailsHTTPBearerTokenFileEnv, entry)
+	}
+
+	return providers
+}
+
+// addProviderHeader adds header to the named provider. A header that names
+// no provider is accepted only when there is a single one, so that
+// credentials are never sent to several hosts.
+func addProviderHeader(providers []DetailsProviderConfig, provider string, header HeaderConfig, env, entry string) {
+	if provider == "" {
+		if len(providers) != 1 {
+			fmt.Printf("invalid %s entry: %s. Name the provider with several details providers. Skipping\n", env, entry)
+			return
+		}
+		provider = providers[0].Name
+	}
+
+	for i := range providers {
+		if providers[i].Name == provider {
+			providers[i].Headers = append(providers[i].Headers, header)
+			return
+		}
+	}
+
+	fmt.Printf("invalid %s entry: %s. Unknown details provider %s. Skipping\n", env, entry, provider)
+}
+
+// parseEnrichmentPolicy reads the policy deciding whether song details are
+// fetched when a song is added.
+func parseEnrichmentPolicy(value string) string {
+	switch value {
+	case "":
+		return "required"
+	case "required", "best-effort", "disabled", "fill-missing-only":
+		return value
+	default:
+		fmt.Printf("invalid %s: %s. Defaulting to required\n", enrichmentPolicyEnv, value)
+		return "required"
+	}
+}
+
+// parseEnrichmentMode reports whether songs are enriched asynchronously.
+func parseEnrichmentMode(value string) bool {
+	switch value {
+	case "async":
+		return true
+	case "", "sync":
+		return false
+	default:
+		fmt.Printf("invalid %s: %s. Defaulting to sync\n", enrichmentModeEnv, value)
+		return false
+	}
+}
+
+// parseTracingExporter reads the exporter of trace spans.
+func parseTracingExporter(value string) string {
+	switch value {
+	case "":
+		return "none"
+	case "none", "otlp", "stdout":
+		return value
+	default:
+		fmt.Printf("invalid %s: %s. Defaulting to none\n", tracingExporterEnv, value)
+		return "none"
+	}
+}
+
+// parseRoleMapping reads a comma-separated list of ssoRole=role pairs.
+func parseRoleMapping(value string) map[string]string {
+	mapping := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		ssoRole, role, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || ssoRole == "" || role == "" {
+			fmt.Printf("invalid %s entry: %s. Skipping\n", jwtRoleMappingEnv, entry)
+			continue
+		}
+		mapping[ssoRole] = role
+	}
+
+	return mapping
+}
+
+// parseRateLimitStore reads where rate limit counters are kept.
+func parseRateLimitStore(value string) string {
+	switch value {
+	case "":
+		return "memory"
+	case "memory", "postgres":
+		return value
+	default:
+		fmt.Printf("invalid %s: %s. Defaulting to memory\n", rateLimitStoreEnv, value)
+		return "memory"
+	}
+}
+
+// parseCORS reads the CORS settings. Credentials cannot be allowed for any
+// origin, browsers reject such responses.
+func parseCORS() CORSConfig {
+	cors := CORSConfig{
+		AllowedOrigins:   parseList(os.Getenv(corsAllowedOriginsEnv)),
+		AllowedMethods:   parseList(getEnvString(corsAllowedMethodsEnv, "GET,POST,PUT,DELETE")),
+		AllowedHeaders:   parseList(getEnvString(corsAllowedHeadersEnv, "Content-Type,Authorization,X-API-Key,X-Request-ID")),
+		ExposedHeaders:   parseList(getEnvString(corsExposedHeadersEnv, "X-Request-ID,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,Retry-After")),
+		AllowCredentials: getEnvBool(corsAllowCredentialsEnv, false),
+		MaxAge:           getEnvDuration(corsMaxAgeEnv, 10*time.Minute),
+	}
+
+	if cors.AllowCredentials && slices.Contains(cors.AllowedOrigins, "*") {
+		fmt.Printf("invalid %s: credentials cannot be allowed for origin *. Defaulting to false\n", corsAllowCredentialsEnv)
+		cors.AllowCredentials = false
+	}
+
+	return cors
+}
+
+// parseRouteCSP reads prefix=policy pairs separated by |, as policies contain
+// commas and semicolons.
+func parseRouteCSP(value string) map[string]string {
+	routes := make(map[string]string)
+	for _, entry := range strings.Split(value, "|") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		prefix, policy, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			fmt.Printf("invalid %s entry: %s. Skipping\n", securityCSPRoutesEnv, entry)
+			continue
+		}
+		routes[prefix] = strings.TrimSpace(policy)
+	}
+
+	return routes
+}
+
+// parseCompressionEncodings reads the supported response encodings in
+// preference order.
+func parseCompressionEncodings(value string) []string {
+	var encodings []string
+	for _, encoding := range parseList(value) {
+		if encoding != "zstd" && encoding != "gzip" {
+			fmt.Printf("invalid %s entry: %s. Skipping\n", compressionEncodingsEnv, encoding)
+			continue
+		}
+		encodings = append(encodings, encoding)
+	}
+
+	return encodings
+}
+
+// parseList reads a comma-separated list, skipping empty entries.
+func parseList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+
+	return list
+}
+
+// parseHealthDetailsCheck reads whether the details providers are checked
+// for readiness.
+func parseHealthDetailsCheck(value string) string {
+	switch value {
+	case "":
+		return "optional"
+	case "off", "optional", "required":
+		return value
+	default:
+		fmt.Printf("invalid %s: %s. Defaulting to optional\n", healthDetailsCheckEnv, value)
+		return "optional"
+	}
+}
+
+// parseDetailsProviders reads a comma-separated list of name=url pairs in
+// priority order. Without it the single EXTERNAL_API_URL provider is used.
+func parseDetailsProviders(value, defaultUrl string) []DetailsProviderConfig {
+	if value == "" {
+		return []DetailsProviderConfig{{Name: "default", URL: defaultUrl}}
+	}
+
+	var providers []DetailsProviderConfig
+	for _, entry := range strings.Split(value, ",") {
+		name, providerUrl, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || providerUrl == "" {
+			fmt.Printf("invalid %s entry: %s. Skipping\n", detailsProvidersEnv, entry)
+			continue
+		}
+		providers = append(providers, DetailsProviderConfig{Name: name, URL: providerUrl})
+	}
+
+	return providers
+}
+
+func getEnvString(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		fmt.Printf("invalid %s: %s. Defaulting to %d\n", key, valueStr, defaultValue)
+		return defaultValue
+	}
+
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		fmt.Printf("invalid %s: %s. Defaulting to %t\n", key, valueStr, defaultValue)
+		return defaultValue
+	}
+
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		fmt.Printf("invalid %s: %s. Defaulting to %g\n", key, valueStr, defaultValue)
+		return defaultValue
+	}
+
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		fmt.Printf("invalid %s: %s. Defaulting to %s\n", key, valueStr, defaultValue)
+		return defaultValue
+	}
+
+	return value
+}
+
+// getEnvRateLimit reads a limit written as requests/window, e.g. 60/1m.
+func getEnvRateLimit(key string, defaultValue RateLimitRule) RateLimitRule {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	requestsStr, windowStr, ok := strings.Cut(valueStr, "/")
+	requests, requestsErr := strconv.ParseInt(requestsStr, 10, 64)
+	window, windowErr := time.ParseDuration(windowStr)
+	if !ok || requestsErr != nil || windowErr != nil || requests < 0 || window <= 0 {
+		fmt.Printf("invalid %s: %s. Defaulting to %d/%s\n", key, valueStr, defaultValue.Requests, defaultValue.Window)
+		return defaultValue
+	}
+
+	return RateLimitRule{Requests: requests, Window: window}
+}
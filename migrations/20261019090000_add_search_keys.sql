@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE songs
+    ADD COLUMN group_search TEXT NOT NULL DEFAULT '',
+    ADD COLUMN title_search TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE songs
+    DROP COLUMN group_search,
+    DROP COLUMN title_search;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE lyrics_revisions (
+    song_id UUID NOT NULL REFERENCES songs (id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    text TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (song_id, revision)
+);
+
+INSERT INTO lyrics_revisions (song_id, revision, text)
+SELECT id, 1, COALESCE(text, '') FROM songs;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE lyrics_revisions;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE annotations (
+    id UUID PRIMARY KEY,
+    song_id UUID NOT NULL REFERENCES songs (id) ON DELETE CASCADE,
+    verse INT NOT NULL,
+    line INT NOT NULL,
+    start_char INT NOT NULL,
+    end_char INT NOT NULL,
+    quote TEXT NOT NULL,
+    author TEXT NOT NULL,
+    body TEXT NOT NULL,
+    orphaned BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX annotations_song_id_idx ON annotations (song_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE annotations;
+-- +goose StatementEnd
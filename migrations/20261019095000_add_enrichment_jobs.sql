@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE songs
+    ADD COLUMN enrichment_status TEXT NOT NULL DEFAULT 'enriched',
+    ADD COLUMN enrichment_error TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE enrichment_jobs (
+    song_id UUID PRIMARY KEY REFERENCES songs (id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    run_after TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE enrichment_jobs;
+
+ALTER TABLE songs
+    DROP COLUMN enrichment_status,
+    DROP COLUMN enrichment_error;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE details_cache (
+    group_key TEXT NOT NULL,
+    title_key TEXT NOT NULL,
+    release_date TEXT NOT NULL DEFAULT '',
+    text TEXT NOT NULL DEFAULT '',
+    link TEXT NOT NULL DEFAULT '',
+    details_sources JSONB NOT NULL DEFAULT '{}',
+    not_found BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (group_key, title_key)
+);
+
+CREATE INDEX details_cache_expires_at_idx ON details_cache (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE details_cache;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE songs
+    ADD COLUMN enriched_details JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN enriched_at TIMESTAMPTZ;
+
+-- the values fetched for existing songs are unknown, so their current values
+-- are taken as fetched and the songs are due for a refresh
+UPDATE songs
+SET enriched_details = jsonb_build_object(
+        'releaseDate', COALESCE(to_char(release_date, 'YYYY-MM-DD'), ''),
+        'text', COALESCE(text, ''),
+        'link', COALESCE(link, ''))
+WHERE enrichment_status = 'enriched';
+
+CREATE INDEX songs_enriched_at_idx ON songs (enriched_at NULLS FIRST);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX songs_enriched_at_idx;
+
+ALTER TABLE songs
+    DROP COLUMN enriched_details,
+    DROP COLUMN enriched_at;
+-- +goose StatementEnd
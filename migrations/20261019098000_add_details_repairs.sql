@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE details_repairs (
+    id BIGSERIAL PRIMARY KEY,
+    provider TEXT NOT NULL,
+    group_name TEXT NOT NULL,
+    title TEXT NOT NULL,
+    field TEXT NOT NULL,
+    action TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    original TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX details_repairs_provider_created_at_idx ON details_repairs (provider, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE details_repairs;
+-- +goose StatementEnd
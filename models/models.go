@@ -7,27 +7,174 @@ import (
 )
 
 type Song struct {
-	Id          string    `json:"id"`
-	Group       string    `json:"group"`
-	Title       string    `json:"title"`
-	ReleaseDate time.Time `json:"releaseDate"`
-	Text        string    `json:"text"`
-	Link        string    `json:"link"`
+	Id               string            `json:"id"`
+	Group            string            `json:"group"`
+	Title            string            `json:"title"`
+	ReleaseDate      time.Time         `json:"releaseDate"`
+	Text             string            `json:"text"`
+	Link             string            `json:"link"`
+	DetailsSources   map[string]string `json:"detailsSources,omitempty"`
+	EnrichmentStatus string            `json:"enrichmentStatus" example:"enriched"`
+	EnrichmentError  string            `json:"enrichmentError,omitempty"`
+	EnrichedAt       *time.Time        `json:"enrichedAt,omitempty"`
 }
 
+// Enrichment statuses of a song: details are being fetched, were fetched,
+// could not be fetched and enrichmentError holds the last error, or were not
+// fetched because the enrichment policy did not call for it.
+const (
+	EnrichmentPending  = "pending"
+	EnrichmentEnriched = "enriched"
+	EnrichmentFailed   = "failed"
+	EnrichmentSkipped  = "skipped"
+)
+
+// DetailsSourceClient is recorded in detailsSources for fields supplied by the
+// client when the song was added.
+const DetailsSourceClient = "client"
+
+// AddSongRequest may carry song details known to the client. They take
+// precedence over the details fetched from the providers.
 type AddSongRequest struct {
-	Group string `json:"group"`
-	Title string `json:"song"`
+	Group       string `json:"group"`
+	Title       string `json:"song"`
+	ReleaseDate string `json:"releaseDate,omitempty" example:"yyyy-mm-dd"`
+	Text        string `json:"text,omitempty"`
+	Link        string `json:"link,omitempty"`
 }
 
 type AddSongResponse struct {
-	Id string `json:"id"`
+	Id                  string `json:"id"`
+	EnrichmentStatus    string `json:"enrichmentStatus" example:"enriched"`
+	EnrichmentErrorCode string `json:"enrichmentErrorCode,omitempty" example:"details_upstream_error"`
+	EnrichmentError     string `json:"enrichmentError,omitempty" example:"song details providers failed"`
+}
+
+type EnrichSongResponse struct {
+	EnrichmentStatus string `json:"enrichmentStatus" example:"pending"`
+}
+
+// RefreshSongsRequest selects enriched songs whose details are fetched again.
+// Without filters the songs enriched longest ago are refreshed first.
+type RefreshSongsRequest struct {
+	Ids           []string `json:"ids,omitempty"`
+	Group         string   `json:"group,omitempty"`
+	Title         string   `json:"title,omitempty"`
+	OlderThanDays int      `json:"olderThanDays,omitempty"`
+	Limit         int      `json:"limit,omitempty"`
+	DryRun        bool     `json:"dryRun"`
+}
+
+type RefreshSongsResponse struct {
+	DryRun bool          `json:"dryRun"`
+	Songs  []SongRefresh `json:"songs"`
+}
+
+// SongRefresh lists the fields of a song that were (or in a dry run would be)
+// updated. Fields edited manually since the last enrichment are never
+// overwritten and are listed in skipped.
+type SongRefresh struct {
+	Id        string        `json:"id"`
+	Group     string        `json:"group"`
+	Title     string        `json:"title"`
+	Changes   []FieldChange `json:"changes"`
+	Skipped   []FieldChange `json:"skipped,omitempty"`
+	ErrorCode string        `json:"errorCode,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+type FieldChange struct {
+	Field string `json:"field" example:"releaseDate"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+	// Diff is a unified diff of the lyrics, set for the text field only.
+	Diff string `json:"diff,omitempty"`
 }
 
 type SongDetails struct {
 	ReleaseDate string `json:"releaseDate"`
 	Text        string `json:"text"`
 	Link        string `json:"link"`
+	// Sources records which details provider supplied each field.
+	Sources map[string]string `json:"-"`
+	// Repairs lists the fields the providers returned invalid or in a
+	// non-canonical form.
+	Repairs []DetailsRepair `json:"-"`
+}
+
+// DetailsRepair records a song details field that a provider returned in a
+// form that had to be repaired, or that was rejected.
+type DetailsRepair struct {
+	Provider  string    `json:"provider"`
+	Group     string    `json:"group"`
+	Title     string    `json:"title"`
+	Field     string    `json:"field" example:"releaseDate"`
+	Action    string    `json:"action" example:"repaired"`
+	Reason    string    `json:"reason" example:"date format 2006-01-02"`
+	Original  string    `json:"original" example:"2006-07-16"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type SongStats struct {
+	Total   int64 `json:"total"`
+	Pending int64 `json:"pending"`
+}
+
+// CreateAPIKeyRequest describes a new API key. Without expiresAt the key
+// never expires.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes" example:"songs:read,songs:write"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type APIKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" example:"mk_Xq3v9T"`
+	Scopes     []string   `json:"scopes" example:"songs:read,songs:write"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreateAPIKeyResponse carries the key itself, which is not stored and
+// cannot be shown again.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// HealthReport is the status of the app and of each of its dependencies. The
+// app is down while draining before shutdown.
+type HealthReport struct {
+	Status   string        `json:"status"`
+	Draining bool          `json:"draining,omitempty"`
+	Checks   []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the result of one dependency check. Failing optional checks
+// leave the app ready. Error is only logged, as it may name hosts and URLs of
+// the dependencies.
+type HealthCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Optional  bool    `json:"optional,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"-"`
+}
+
+// ReadinessStatus tells whether the app accepts traffic and names the
+// required checks that failed.
+type ReadinessStatus struct {
+	Status string   `json:"status"`
+	Failed []string `json:"failed,omitempty"`
+}
+
+type DetailsRepairFilter struct {
+	Provider string `json:"provider"`
+	Limit    int    `json:"limit"`
 }
 
 type UpdateSongRequest struct {
@@ -87,5 +234,155 @@ type LyricsFilter struct {
 }
 
 type SongLyricsResponse struct {
-	Lyrics string `json:"lyrics"`
+	Lyrics      string             `json:"lyrics"`
+	Annotations []AnnotationAnchor `json:"annotations,omitempty"`
+}
+
+type LyricsRevision struct {
+	Revision  int       `json:"revision"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type LyricsDiffFilter struct {
+	SongId string `json:"songId"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+}
+
+type LyricsDiff struct {
+	SongId  string           `json:"songId"`
+	From    int              `json:"from"`
+	To      int              `json:"to"`
+	Lines   []LyricsDiffLine `json:"lines"`
+	Unified string           `json:"unified"`
+}
+
+// LyricsDiffLine is one step of a line-level edit script. Op is one of equal,
+// delete, insert or replace; replaced lines carry a word-level diff in Words.
+type LyricsDiffLine struct {
+	Op      string           `json:"op" example:"replace"`
+	OldLine int              `json:"oldLine,omitempty"`
+	NewLine int              `json:"newLine,omitempty"`
+	OldText string           `json:"oldText,omitempty"`
+	Text    string           `json:"text"`
+	Words   []LyricsDiffWord `json:"words,omitempty"`
+}
+
+type LyricsDiffWord struct {
+	Op   string `json:"op" example:"insert"`
+	Text string `json:"text"`
+}
+
+type LyricsLookupFilter struct {
+	Query string `json:"q"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+type LyricsLookupResult struct {
+	SongId string      `json:"songId"`
+	Group  string      `json:"group"`
+	Title  string      `json:"title"`
+	Hits   []LyricsHit `json:"hits"`
+}
+
+// LyricsHit locates a matched fragment. Verse is the page number of the verse
+// in GetLyrics with limit=1, Line is the 1-based line within that verse.
+type LyricsHit struct {
+	Verse int    `json:"verse"`
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+}
+
+type SimilarFilter struct {
+	SongId string `json:"songId"`
+	Limit  int    `json:"limit"`
+}
+
+type SimilarSong struct {
+	Id          string    `json:"id"`
+	Group       string    `json:"group"`
+	Title       string    `json:"title"`
+	ReleaseDate time.Time `json:"releaseDate"`
+	Score       float64   `json:"score"`
+}
+
+// Annotation explains a character range of a lyrics line. Verse and Line are
+// 1-based and match lyrics pagination, Start and End are character offsets in
+// the line with End exclusive. Orphaned annotations lost their text after the
+// lyrics were edited.
+type Annotation struct {
+	Id        string    `json:"id"`
+	SongId    string    `json:"songId"`
+	Verse     int       `json:"verse"`
+	Line      int       `json:"line"`
+	Start     int       `json:"start"`
+	End       int       `json:"end"`
+	Quote     string    `json:"quote"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	Orphaned  bool      `json:"orphaned"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type AddAnnotationRequest struct {
+	Verse  int    `json:"verse"`
+	Line   int    `json:"line"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Author string `json:"author"`
+	Body   string `json:"body" example:"Markdown text"`
+}
+
+type AddAnnotationResponse struct {
+	Id string `json:"id"`
+}
+
+type UpdateAnnotationRequest struct {
+	Author string `json:"author"`
+	Body   string `json:"body" example:"Markdown text"`
+}
+
+type AnnotationAnchor struct {
+	Id    string `json:"id"`
+	Verse int    `json:"verse"`
+	Line  int    `json:"line"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type DetailsStatus struct {
+	Providers []ProviderStatus   `json:"providers"`
+	Cache     DetailsCacheStatus `json:"cache"`
+}
+
+// DetailsCacheStatus counts song details lookups answered from the cache since
+// startup. Negative hits are cached "not found" answers.
+type DetailsCacheStatus struct {
+	Enabled      bool  `json:"enabled"`
+	Hits         int64 `json:"hits"`
+	NegativeHits int64 `json:"negativeHits"`
+	Misses       int64 `json:"misses"`
+	Bypassed     int64 `json:"bypassed"`
+}
+
+type ProviderStatus struct {
+	Name    string         `json:"name"`
+	Breaker BreakerStatus  `json:"breaker"`
+	Limiter *LimiterStatus `json:"limiter,omitempty"`
+}
+
+// LimiterStatus shows the outbound requests to a provider that are being sent
+// or wait for their turn, and how many were turned away since startup.
+type LimiterStatus struct {
+	InFlight int   `json:"inFlight"`
+	Queued   int   `json:"queued"`
+	Rejected int64 `json:"rejected"`
+}
+
+type BreakerStatus struct {
+	State               string     `json:"state" example:"closed"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"`
 }
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -9,49 +11,66 @@ import (
 	"github.com/gorilla/mux"
 
 	"effectiveMobileTest/models"
+	"effectiveMobileTest/pkg/auth"
+	"effectiveMobileTest/pkg/health"
+	"effectiveMobileTest/pkg/service/apikeys"
 	"effectiveMobileTest/pkg/service/music"
 	"effectiveMobileTest/utils"
 )
 
 // AddSong godoc
 // @Summary Create a new song
-// @Description Create a new song in the database with the provided details
+// @Description Create a new song in the database with the provided details. Release date, lyrics and link given
+// @Description in the request are kept; the rest is fetched from the details providers according to the enrichment
+// @Description policy. In asynchronous enrichment mode the song is stored as pending and its details are fetched
+// @Description in the background.
 // @Tags songs
 // @Accept json
 // @Produce json
 // @Param song body models.AddSongRequest true "Song Data"
+// @Param X-Cache-Bypass header bool false "Fetch song details from the providers instead of the cache, admins only"
 // @Success 200 {object} models.AddSongResponse "id of the created song"
+// @Success 202 {object} models.AddSongResponse "id of the song accepted for enrichment"
 // @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Failure 502 {object} utils.ErrorResponse "Details providers failed"
+// @Failure 503 {object} utils.ErrorResponse "Details providers are unavailable, retry after the Retry-After header if present"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /songs [post]
 func AddSong(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
 		ctx.Logger.Debugf("AddSong handler invoked")
 
 		var req models.AddSongRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+		if err := decodeBody(r, &req); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
-		if req.Group == "" || req.Title == "" {
-			utils.NewErrorResponse(ctx, w, "missing required fields: group or song")
+		if fields := utils.MissingFields(map[string]string{"group": req.Group, "song": req.Title}); len(fields) > 0 {
+			utils.NewErrorResponse(ctx, w, utils.NewValidationError("missing required fields: group or song", fields...))
 			return
 		}
 
 		ctx.Logger.Debugf("creating song: %+v", req)
-		id, err := service.Create(ctx, req)
+		response, err := service.Create(detailsContext(ctx, r), req)
 		if err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
-		ctx.Logger.Infof("song created successfully with id=%s", id)
+		ctx.Logger.Infof("song created successfully with id=%s, enrichment status=%s", response.Id, response.EnrichmentStatus)
 
-		response := models.AddSongResponse{Id: id}
+		status := http.StatusOK
+		if response.EnrichmentStatus == models.EnrichmentPending {
+			status = http.StatusAccepted
+		}
 
-		if err = utils.WriteResponse(w, http.StatusOK, response); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+		if err = utils.WriteResponse(w, status, response); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
@@ -65,8 +84,8 @@ func AddSong(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
 // @Tags songs
 // @Accept  json
 // @Produce  json
-// @Param group query string false "Group name"
-// @Param title query string false "Song title"
+// @Param group query string false "Group name, matched in Cyrillic and Latin spelling"
+// @Param title query string false "Song title, matched in Cyrillic and Latin spelling"
 // @Param releaseDate query string false "Release date (YYYY-MM-DD)"
 // @Param text query string false "Text"
 // @Param link query string false "Link"
@@ -74,10 +93,14 @@ func AddSong(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
 // @Param limit query int false "Number of songs per page" default(10)
 // @Success 200 {array} models.Song "List of songs"
 // @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /songs [get]
 func GetSongs(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
 		ctx.Logger.Debugf("GetSongs handler invoked")
 
 		var (
@@ -90,7 +113,8 @@ func GetSongs(ctx utils.MyContext, service music.MusicService) http.HandlerFunc
 			ctx.Logger.Debugf("parsing releaseDate: %s", releaseDateStr)
 			releaseDate, err = time.Parse("2006-01-02", releaseDateStr)
 			if err != nil {
-				utils.NewErrorResponse(ctx, w, "invalid releaseDate format")
+				utils.NewErrorResponse(ctx, w, utils.NewValidationError("invalid releaseDate format",
+					utils.FieldError{Field: "releaseDate", Message: "must be in yyyy-mm-dd format"}))
 				return
 			}
 		}
@@ -109,7 +133,7 @@ func GetSongs(ctx utils.MyContext, service music.MusicService) http.HandlerFunc
 
 		songs, err := service.GetSongs(ctx, filter)
 		if err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
@@ -120,7 +144,7 @@ func GetSongs(ctx utils.MyContext, service music.MusicService) http.HandlerFunc
 		}
 
 		if err = utils.WriteResponse(w, http.StatusOK, songs); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
@@ -137,12 +161,17 @@ func GetSongs(ctx utils.MyContext, service music.MusicService) http.HandlerFunc
 // @Param songId path string true "Song ID"
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Number of couplets per page" default(10)
+// @Param annotations query bool false "Include anchors of annotations on the returned verses"
 // @Success 200 {object} models.SongLyricsResponse "Song lyrics"
 // @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /songs/{songId}/lyrics [get]
 func GetLyrics(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
 		ctx.Logger.Debugf("GetLyrics handler invoked")
 
 		songId := mux.Vars(r)["songId"]
@@ -159,7 +188,7 @@ func GetLyrics(ctx utils.MyContext, service music.MusicService) http.HandlerFunc
 
 		lyrics, err := service.GetLyrics(ctx, filter)
 		if err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
@@ -167,8 +196,16 @@ func GetLyrics(ctx utils.MyContext, service music.MusicService) http.HandlerFunc
 
 		response := models.SongLyricsResponse{Lyrics: lyrics}
 
+		if r.URL.Query().Get("annotations") == "true" {
+			response.Annotations, err = service.GetAnnotationAnchors(ctx, filter)
+			if err != nil {
+				utils.NewErrorResponse(ctx, w, err)
+				return
+			}
+		}
+
 		if err = utils.WriteResponse(w, http.StatusOK, response); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
@@ -187,10 +224,14 @@ func GetLyrics(ctx utils.MyContext, service music.MusicService) http.HandlerFunc
 // @Success 200 {object} utils.StatusResponse "Response indicating the status of the operation"
 // @Failure 400 {object} utils.ErrorResponse "Bad Request"
 // @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /songs/{id} [put]
 func UpdateSong(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
 		ctx.Logger.Debugf("UpdateSong handler invoked")
 
 		var input models.UpdateSongRequest
@@ -199,22 +240,22 @@ func UpdateSong(ctx utils.MyContext, service music.MusicService) http.HandlerFun
 
 		ctx.Logger.Debugf("decoding update data for songId=%s", id)
 
-		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+		if err := decodeBody(r, &input); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
 		ctx.Logger.Debugf("updating song with data: %+v", input)
 
 		if err := service.Update(ctx, id, input); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
 		ctx.Logger.Infof("song updated successfully with id=%s", id)
 
 		if err := utils.WriteResponse(w, http.StatusOK, utils.StatusResponse{Status: "ok"}); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
@@ -232,10 +273,14 @@ func UpdateSong(ctx utils.MyContext, service music.MusicService) http.HandlerFun
 // @Success 200 {object} utils.StatusResponse "Response indicating the status of the operation"
 // @Failure 400 {object} utils.ErrorResponse "Bad Request"
 // @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /songs/{id} [delete]
 func DeleteSong(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
 		ctx.Logger.Debugf("DeleteSong handler invoked")
 
 		id := mux.Vars(r)["id"]
@@ -243,14 +288,14 @@ func DeleteSong(ctx utils.MyContext, service music.MusicService) http.HandlerFun
 		ctx.Logger.Debugf("deleting song with id=%s", id)
 
 		if err := service.Delete(ctx, id); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
 		ctx.Logger.Infof("song deleted successfully with id=%s", id)
 
 		if err := utils.WriteResponse(w, http.StatusOK, utils.StatusResponse{Status: "ok"}); err != nil {
-			utils.NewErrorResponse(ctx, w, err.Error())
+			utils.NewErrorResponse(ctx, w, err)
 			return
 		}
 
@@ -258,6 +303,581 @@ func DeleteSong(ctx utils.MyContext, service music.MusicService) http.HandlerFun
 	}
 }
 
+// EnrichSong godoc
+// @Summary Fetch song details again
+// @Description Retry fetching the release date, lyrics and link of a song from the details providers.
+// @Description In asynchronous enrichment mode the song is queued and 202 is returned.
+// @Tags songs
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Song ID"
+// @Param X-Cache-Bypass header bool false "Fetch song details from the providers instead of the cache, admins only"
+// @Success 200 {object} models.EnrichSongResponse "Song details were fetched"
+// @Success 202 {object} models.EnrichSongResponse "Song was queued for enrichment"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 409 {object} utils.ErrorResponse "Song was changed while its details were fetched"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Failure 502 {object} utils.ErrorResponse "Details providers failed"
+// @Failure 503 {object} utils.ErrorResponse "Details providers are unavailable, retry after the Retry-After header if present"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs/{id}:enrich [post]
+func EnrichSong(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("EnrichSong handler invoked")
+
+		id := mux.Vars(r)["id"]
+
+		ctx.Logger.Debugf("enriching song with id=%s", id)
+
+		enrichmentStatus, err := service.EnrichSong(detailsContext(ctx, r), id)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("song id=%s enrichment status=%s", id, enrichmentStatus)
+
+		status := http.StatusOK
+		if enrichmentStatus == models.EnrichmentPending {
+			status = http.StatusAccepted
+		}
+
+		if err = utils.WriteResponse(w, status, models.EnrichSongResponse{EnrichmentStatus: enrichmentStatus}); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for EnrichSong")
+	}
+}
+
+// RefreshSongs godoc
+// @Summary Refresh song details
+// @Description Fetch the details of enriched songs again and update the fields that changed upstream.
+// @Description Fields edited manually since the last enrichment are never overwritten. With dryRun nothing is saved
+// @Description and the response shows what would change.
+// @Tags songs
+// @Accept  json
+// @Produce  json
+// @Param request body models.RefreshSongsRequest true "Songs to refresh"
+// @Success 200 {object} models.RefreshSongsResponse "Changed and skipped fields of every song"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs:refresh [post]
+func RefreshSongs(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("RefreshSongs handler invoked")
+
+		var req models.RefreshSongsRequest
+		if err := decodeBody(r, &req); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		response, err := service.RefreshSongs(ctx, req)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("details of %d songs refreshed, dry run=%t", len(response.Songs), response.DryRun)
+
+		if err = utils.WriteResponse(w, http.StatusOK, response); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for RefreshSongs")
+	}
+}
+
+// GetLyricsRevisions godoc
+// @Summary Get lyrics revisions of a song
+// @Description Retrieve the list of stored lyrics revisions for a song, oldest first
+// @Tags lyrics
+// @Accept  json
+// @Produce  json
+// @Param songId path string true "Song ID"
+// @Success 200 {array} models.LyricsRevision "Lyrics revisions"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs/{songId}/lyrics/revisions [get]
+func GetLyricsRevisions(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("GetLyricsRevisions handler invoked")
+
+		songId := mux.Vars(r)["songId"]
+
+		revisions, err := service.GetLyricsRevisions(ctx, songId)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("lyrics revisions retrieved successfully for songId: %s, count: %d", songId, len(revisions))
+
+		if err = utils.WriteResponse(w, http.StatusOK, revisions); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for GetLyricsRevisions")
+	}
+}
+
+// GetLyricsDiff godoc
+// @Summary Diff two lyrics revisions of a song
+// @Description Return a line-level and word-level diff between two lyrics revisions as a JSON edit script, or as unified diff text with format=unified
+// @Tags lyrics
+// @Accept  json
+// @Produce  json,plain
+// @Param songId path string true "Song ID"
+// @Param from query int false "Old revision, defaults to the one before 'to', or the empty text for the first revision"
+// @Param to query int false "New revision, defaults to the latest"
+// @Param format query string false "Response format" Enums(json, unified) default(json)
+// @Success 200 {object} models.LyricsDiff "Lyrics diff"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs/{songId}/lyrics/diff [get]
+func GetLyricsDiff(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("GetLyricsDiff handler invoked")
+
+		from, err := getRevisionFromQuery(r, "from")
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		to, err := getRevisionFromQuery(r, "to")
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		filter := models.LyricsDiffFilter{
+			SongId: mux.Vars(r)["songId"],
+			From:   from,
+			To:     to,
+		}
+
+		ctx.Logger.Debugf("filters applied: %+v", filter)
+
+		lyricsDiff, err := service.DiffLyrics(ctx, filter)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("lyrics diff computed successfully for songId: %s", filter.SongId)
+
+		if r.URL.Query().Get("format") == "unified" {
+			w.Header().Set(utils.ContentType, utils.TextPlain)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(lyricsDiff.Unified))
+			return
+		}
+
+		if err = utils.WriteResponse(w, http.StatusOK, lyricsDiff); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for GetLyricsDiff")
+	}
+}
+
+// LookupLyrics godoc
+// @Summary Find songs by a lyrics fragment
+// @Description Find songs whose lyrics contain the phrase, ignoring case, punctuation and ё/е differences. Every hit carries the verse index, usable as the page of GetLyrics with limit=1, and the line within that verse
+// @Tags lyrics
+// @Accept  json
+// @Produce  json
+// @Param q query string true "Lyrics fragment"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of songs per page" default(10)
+// @Success 200 {array} models.LyricsLookupResult "Matching songs"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /lyrics/lookup [get]
+func LookupLyrics(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("LookupLyrics handler invoked")
+
+		filter := models.LyricsLookupFilter{
+			Query: r.URL.Query().Get("q"),
+			Page:  getPageFromQuery(r),
+			Limit: getLimitFromQuery(r),
+		}
+
+		ctx.Logger.Debugf("filters applied: %+v", filter)
+
+		results, err := service.LookupLyrics(ctx, filter)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("lyrics lookup matched %d songs", len(results))
+
+		if err = utils.WriteResponse(w, http.StatusOK, results); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for LookupLyrics")
+	}
+}
+
+// AddAnnotation godoc
+// @Summary Annotate a fragment of lyrics
+// @Description Attach a Markdown annotation to a character range of a lyrics line
+// @Tags annotations
+// @Accept json
+// @Produce json
+// @Param songId path string true "Song ID"
+// @Param annotation body models.AddAnnotationRequest true "Annotation Data"
+// @Success 200 {object} models.AddAnnotationResponse "id of the created annotation"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs/{songId}/annotations [post]
+func AddAnnotation(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("AddAnnotation handler invoked")
+
+		songId := mux.Vars(r)["songId"]
+
+		var req models.AddAnnotationRequest
+		if err := decodeBody(r, &req); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("creating annotation for songId=%s: %+v", songId, req)
+		id, err := service.CreateAnnotation(ctx, songId, req)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("annotation created successfully with id=%s", id)
+
+		if err = utils.WriteResponse(w, http.StatusOK, models.AddAnnotationResponse{Id: id}); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for AddAnnotation")
+	}
+}
+
+// GetAnnotations godoc
+// @Summary Get annotations of a song
+// @Description Retrieve all annotations of a song, including orphaned ones whose text was removed from the lyrics
+// @Tags annotations
+// @Accept  json
+// @Produce  json
+// @Param songId path string true "Song ID"
+// @Success 200 {array} models.Annotation "Annotations"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs/{songId}/annotations [get]
+func GetAnnotations(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("GetAnnotations handler invoked")
+
+		songId := mux.Vars(r)["songId"]
+
+		annotations, err := service.GetAnnotations(ctx, songId)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("annotations retrieved successfully for songId: %s, count: %d", songId, len(annotations))
+
+		if err = utils.WriteResponse(w, http.StatusOK, annotations); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for GetAnnotations")
+	}
+}
+
+// UpdateAnnotation godoc
+// @Summary Update an annotation
+// @Description Update the author or body of an annotation
+// @Tags annotations
+// @Accept  json
+// @Produce  json
+// @Param songId path string true "Song ID"
+// @Param id path string true "Annotation ID"
+// @Param annotation body models.UpdateAnnotationRequest true "Annotation Data"
+// @Success 200 {object} utils.StatusResponse "Response indicating the status of the operation"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs/{songId}/annotations/{id} [put]
+func UpdateAnnotation(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("UpdateAnnotation handler invoked")
+
+		songId, id := mux.Vars(r)["songId"], mux.Vars(r)["id"]
+
+		var input models.UpdateAnnotationRequest
+		if err := decodeBody(r, &input); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		if err := service.UpdateAnnotation(ctx, songId, id, input); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("annotation updated successfully with id=%s", id)
+
+		if err := utils.WriteResponse(w, http.StatusOK, utils.StatusResponse{Status: "ok"}); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for UpdateAnnotation")
+	}
+}
+
+// DeleteAnnotation godoc
+// @Summary Delete an annotation
+// @Description Delete an annotation of a song by its ID
+// @Tags annotations
+// @Accept  json
+// @Produce  json
+// @Param songId path string true "Song ID"
+// @Param id path string true "Annotation ID"
+// @Success 200 {object} utils.StatusResponse "Response indicating the status of the operation"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs/{songId}/annotations/{id} [delete]
+func DeleteAnnotation(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("DeleteAnnotation handler invoked")
+
+		songId, id := mux.Vars(r)["songId"], mux.Vars(r)["id"]
+
+		if err := service.DeleteAnnotation(ctx, songId, id); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("annotation deleted successfully with id=%s", id)
+
+		if err := utils.WriteResponse(w, http.StatusOK, utils.StatusResponse{Status: "ok"}); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for DeleteAnnotation")
+	}
+}
+
+// GetSimilar godoc
+// @Summary Get songs similar to a song
+// @Description Rank other songs by TF-IDF cosine similarity of lyrics combined with group and era proximity
+// @Tags songs
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Song ID"
+// @Param limit query int false "Number of songs to return, defaults to SIMILAR_LIMIT"
+// @Success 200 {array} models.SimilarSong "Similar songs, best first"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /songs/{id}/similar [get]
+func GetSimilar(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("GetSimilar handler invoked")
+
+		filter := models.SimilarFilter{
+			SongId: mux.Vars(r)["id"],
+		}
+		if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+			filter.Limit = limit
+		}
+
+		ctx.Logger.Debugf("filters applied: %+v", filter)
+
+		songs, err := service.GetSimilar(ctx, filter)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("similar songs retrieved successfully for id=%s, count: %d", filter.SongId, len(songs))
+
+		if err = utils.WriteResponse(w, http.StatusOK, songs); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for GetSimilar")
+	}
+}
+
+// GetDetailsStatus godoc
+// @Summary Get details providers status
+// @Description Report the circuit breaker state of every song details provider and the details cache counters
+// @Tags status
+// @Produce  json
+// @Success 200 {object} models.DetailsStatus "Details providers status"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /status/details [get]
+func GetDetailsStatus(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("GetDetailsStatus handler invoked")
+
+		if err := utils.WriteResponse(w, http.StatusOK, service.GetDetailsStatus(ctx)); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for GetDetailsStatus")
+	}
+}
+
+// GetDetailsRepairs godoc
+// @Summary Get details repairs
+// @Description List the song details fields that providers returned invalid or in a non-canonical form, newest first.
+// @Description Repaired fields were brought into canonical form, rejected ones were dropped.
+// @Tags status
+// @Produce  json
+// @Param provider query string false "Details provider name"
+// @Param limit query int false "Maximum number of repairs (default 50, at most 500)"
+// @Success 200 {array} models.DetailsRepair "Details repairs"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /status/details/repairs [get]
+func GetDetailsRepairs(ctx utils.MyContext, service music.MusicService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("GetDetailsRepairs handler invoked")
+
+		filter := models.DetailsRepairFilter{
+			Provider: r.URL.Query().Get("provider"),
+		}
+		if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+			filter.Limit = limit
+		}
+
+		ctx.Logger.Debugf("filters applied: %+v", filter)
+
+		repairs, err := service.GetDetailsRepairs(ctx, filter)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("details repairs retrieved successfully, count: %d", len(repairs))
+
+		if err = utils.WriteResponse(w, http.StatusOK, repairs); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for GetDetailsRepairs")
+	}
+}
+
+// detailsContext makes song details lookups of the request skip the cache when
+// an admin sets the X-Cache-Bypass header. Other callers could use it to get
+// around the cache and the provider rate limits, so it is ignored for them.
+func detailsContext(ctx utils.MyContext, r *http.Request) utils.MyContext {
+	if bypass, _ := strconv.ParseBool(r.Header.Get("X-Cache-Bypass")); bypass {
+		if principal, ok := auth.PrincipalFrom(r.Context()); !ok || !principal.HasScope(auth.ScopeAdmin) {
+			ctx.Logger.Debugf("ignoring X-Cache-Bypass of a caller without the %s scope", auth.ScopeAdmin)
+			return ctx
+		}
+
+		ctx.Logger.Debugf("bypassing song details cache")
+		return music.WithoutDetailsCache(ctx)
+	}
+
+	return ctx
+}
+
+// decodeBody decodes the JSON request body into v. Malformed bodies are
+// validation errors, bodies that decompress to more than the allowed size are
+// too large.
+func decodeBody(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return utils.NewTooLargeError("request body is larger than %d bytes", tooLarge.Limit)
+		}
+		return utils.NewValidationError("invalid request body: " + err.Error())
+	}
+
+	return nil
+}
+
+func getRevisionFromQuery(r *http.Request, name string) (int, error) {
+	revision := r.URL.Query().Get(name)
+	if revision == "" {
+		return 0, nil
+	}
+	rev, err := strconv.Atoi(revision)
+	if err != nil || rev < 1 {
+		return 0, utils.NewValidationError(fmt.Sprintf("invalid %s revision: %s", name, revision),
+			utils.FieldError{Field: name, Message: "must be a revision number of 1 or more"})
+	}
+	return rev, nil
+}
+
 func getPageFromQuery(r *http.Request) int {
 	page := r.URL.Query().Get("page")
 	if page == "" {
@@ -281,3 +901,172 @@ func getLimitFromQuery(r *http.Request) int {
 	}
 	return l
 }
+
+// CreateAPIKey godoc
+// @Summary Issue an API key
+// @Description Issue an API key with the given scopes: songs:read, songs:write, songs:delete or admin, which grants
+// @Description all of them. The key is returned only in this response, the server keeps just its hash.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param key body models.CreateAPIKeyRequest true "API key data"
+// @Success 200 {object} models.CreateAPIKeyResponse "Issued API key"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /admin/keys [post]
+func CreateAPIKey(ctx utils.MyContext, service apikeys.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("CreateAPIKey handler invoked")
+
+		var req models.CreateAPIKeyRequest
+		if err := decodeBody(r, &req); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		key, err := service.Create(ctx, req)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("API key issued with id=%s, scopes=%v", key.Id, key.Scopes)
+
+		if err = utils.WriteResponse(w, http.StatusOK, key); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for CreateAPIKey")
+	}
+}
+
+// GetAPIKeys godoc
+// @Summary List API keys
+// @Description List every API key, revoked and expired ones included, newest first
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Success 200 {array} models.APIKey "API keys"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /admin/keys [get]
+func GetAPIKeys(ctx utils.MyContext, service apikeys.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("GetAPIKeys handler invoked")
+
+		keys, err := service.List(ctx)
+		if err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		if err = utils.WriteResponse(w, http.StatusOK, keys); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for GetAPIKeys")
+	}
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key by its ID. Requests with the key are rejected from then on.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Success 200 {object} utils.StatusResponse "Response indicating the status of the operation"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests, retry after the Retry-After header"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /admin/keys/{id} [delete]
+func RevokeAPIKey(ctx utils.MyContext, service apikeys.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("RevokeAPIKey handler invoked")
+
+		id := mux.Vars(r)["id"]
+
+		if err := service.Revoke(ctx, id); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Infof("API key revoked successfully with id=%s", id)
+
+		if err := utils.WriteResponse(w, http.StatusOK, utils.StatusResponse{Status: "ok"}); err != nil {
+			utils.NewErrorResponse(ctx, w, err)
+			return
+		}
+
+		ctx.Logger.Debugf("response sent successfully for RevokeAPIKey")
+	}
+}
+
+// Healthz reports that the process is alive. It checks no dependencies, so
+// that an orchestrator restarts the app only when it stops responding.
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteResponse(w, http.StatusOK, models.ReadinessStatus{Status: health.StatusUp})
+	}
+}
+
+// Readyz reports whether the app accepts traffic: 200 when the required
+// dependency checks pass, 503 when one fails or the app is draining before
+// shutdown.
+func Readyz(ctx utils.MyContext, checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+
+		status := checker.Ready(ctx.Ctx)
+		statusCode := http.StatusOK
+		if status.Status != health.StatusUp {
+			ctx.Logger.Warnf("app is not ready: %v", status.Failed)
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		if err := utils.WriteResponse(w, statusCode, status); err != nil {
+			ctx.Logger.Errorf("failed to write readiness status: %v", err)
+		}
+	}
+}
+
+// Health reports the status and latency of every dependency check, with 503
+// when the app is down. Errors of failed checks are logged, not returned.
+func Health(ctx utils.MyContext, checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.RequestContext(ctx, r)
+		ctx.Logger.Debugf("Health handler invoked")
+
+		report := checker.Run(ctx.Ctx)
+		for _, check := range report.Checks {
+			if check.Error != "" {
+				ctx.Logger.Warnf("health check %s failed: %s", check.Name, check.Error)
+			}
+		}
+
+		statusCode := http.StatusOK
+		if report.Status == health.StatusDown {
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		if err := utils.WriteResponse(w, statusCode, report); err != nil {
+			ctx.Logger.Errorf("failed to write health report: %v", err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/pkg/auth"
+	"effectiveMobileTest/pkg/service/music"
+	"effectiveMobileTest/utils"
+)
+
+func TestDetailsContext(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		principal  *auth.Principal
+		wantBypass bool
+	}{
+		{name: "admin bypasses the cache", header: "true", principal: &auth.Principal{Scopes: []string{auth.ScopeAdmin}}, wantBypass: true},
+		{name: "admin without the header", principal: &auth.Principal{Scopes: []string{auth.ScopeAdmin}}},
+		{name: "admin with a false header", header: "false", principal: &auth.Principal{Scopes: []string{auth.ScopeAdmin}}},
+		{name: "writer is ignored", header: "true", principal: &auth.Principal{Scopes: []string{auth.ScopeSongsWrite}}},
+		{name: "anonymous caller is ignored", header: "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+
+			r := httptest.NewRequest(http.MethodPost, "/api/songs", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Cache-Bypass", tt.header)
+			}
+			if tt.principal != nil {
+				r = r.WithContext(auth.WithPrincipal(ctx, *tt.principal).Ctx)
+			}
+
+			if bypass := music.DetailsCacheBypassed(detailsContext(ctx, r)); bypass != tt.wantBypass {
+				t.Errorf("cache bypassed = %v, want %v", bypass, tt.wantBypass)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package middlewares
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"effectiveMobileTest/pkg/auth"
+	"effectiveMobileTest/pkg/metrics"
+	"effectiveMobileTest/pkg/ratelimit"
+	"effectiveMobileTest/utils"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator resolves the principal of a credential sent by a client.
+type Authenticator interface {
+	Authenticate(ctx utils.MyContext, credential string) (auth.Principal, error)
+}
+
+// Credentials dispatches credentials by their form: JWTs, which have three
+// dot-separated parts, go to Tokens when set, anything else to APIKeys.
+type Credentials struct {
+	APIKeys Authenticator
+	Tokens  Authenticator
+}
+
+func (c Credentials) Authenticate(ctx utils.MyContext, credential string) (auth.Principal, error) {
+	if c.Tokens != nil && strings.Count(credential, ".") == 2 {
+		return c.Tokens.Authenticate(ctx, credential)
+	}
+	return c.APIKeys.Authenticate(ctx, credential)
+}
+
+// AuthMiddleware authenticates the credential sent in the X-API-Key header or
+// as an Authorization bearer token and stores its principal in the request
+// context, adding the caller to the request logger for auditing. Requests
+// without credentials pass on anonymously, requests with invalid ones are
+// rejected. Failed authentications are counted against the client address in
+// limiter, and an address over its limit is answered 429 before its
+// credential is checked; a nil limiter disables this.
+func AuthMiddleware(ctx utils.MyContext, authenticator Authenticator, limiter *ratelimit.Limiter, clientIP *ratelimit.ClientIP,
+	next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential := credentialOf(r)
+		if credential == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestCtx := utils.RequestContext(ctx, r)
+		var client string
+		if limiter != nil {
+			client = "ip:" + clientIP.Of(r)
+			if err := checkAuthFailures(requestCtx, limiter, client); err != nil {
+				utils.NewErrorResponse(requestCtx, w, err)
+				return
+			}
+		}
+
+		principal, err := authenticator.Authenticate(requestCtx, credential)
+		if err != nil {
+			if limiter != nil && utils.KindOf(err) == utils.KindUnauthorized {
+				if _, countErr := limiter.Allow(requestCtx, ratelimit.ClassAuthFailure, client); countErr != nil {
+					requestCtx.Logger.Warnf("failed authentication not counted: %v", countErr)
+				}
+			}
+			utils.NewErrorResponse(requestCtx, w, err)
+			return
+		}
+
+		requestCtx.Logger = requestCtx.Logger.With("callerId", principal.Id, "caller", principal.Name)
+		requestCtx.Logger.Debugf("request authenticated with scopes %v", principal.Scopes)
+		next.ServeHTTP(w, r.WithContext(utils.WithLogger(auth.WithPrincipal(requestCtx, principal)).Ctx))
+	})
+}
+
+// checkAuthFailures returns a rate limited error once client has used up its
+// failed authentications. Like RateLimit, it lets requests pass when the
+// counter store fails.
+func checkAuthFailures(ctx utils.MyContext, limiter *ratelimit.Limiter, client string) error {
+	decision, err := limiter.Check(ctx, ratelimit.ClassAuthFailure, client)
+	if err != nil {
+		ctx.Logger.Warnf("failed authentications not checked: %v", err)
+		return nil
+	}
+	if decision.Allowed {
+		return nil
+	}
+
+	metrics.RateLimited(ratelimit.ClassAuthFailure)
+	reset := max(int64(math.Ceil(decision.Reset.Seconds())), 1)
+	return utils.NewRateLimitedError(time.Duration(reset)*time.Second,
+		"too many failed authentications, %d allowed per window", decision.Limit)
+}
+
+func credentialOf(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// RequireScope lets a request through only if it was authenticated with the
+// given scope. With publicReads, requests needing just auth.ScopeSongsRead
+// need no credentials.
+func RequireScope(ctx utils.MyContext, scope string, publicReads bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if publicReads && scope == auth.ScopeSongsRead {
+			next(w, r)
+			return
+		}
+
+		principal, ok := auth.PrincipalFrom(r.Context())
+		switch {
+		case !ok:
+			utils.NewErrorResponse(utils.RequestContext(ctx, r), w,
+				utils.NewUnauthorizedError("authentication required, send an API key in the %s header or a bearer token", APIKeyHeader))
+		case !principal.HasScope(scope):
+			utils.NewErrorResponse(utils.RequestContext(ctx, r), w,
+				utils.NewForbiddenError("caller %s lacks scope %s", principal.Name, scope))
+		default:
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/pkg/auth"
+	"effectiveMobileTest/pkg/ratelimit"
+	"effectiveMobileTest/utils"
+)
+
+type fakeAuthenticator map[string]auth.Principal
+
+func (a fakeAuthenticator) Authenticate(ctx utils.MyContext, credential string) (auth.Principal, error) {
+	principal, ok := a[credential]
+	if !ok {
+		return auth.Principal{}, utils.NewUnauthorizedError("invalid API key")
+	}
+	return principal, nil
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	authenticator := fakeAuthenticator{
+		"reader": {Name: "reader", Scopes: []string{auth.ScopeSongsRead}},
+		"admin":  {Name: "admin", Scopes: []string{auth.ScopeAdmin}},
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	tests := []struct {
+		name        string
+		header      string
+		credential  string
+		scope       string
+		publicReads bool
+		status      int
+	}{
+		{"anonymous", "", "", auth.ScopeSongsRead, false, http.StatusUnauthorized},
+		{"anonymous public read", "", "", auth.ScopeSongsRead, true, http.StatusOK},
+		{"anonymous public reads do not cover writes", "", "", auth.ScopeSongsWrite, true, http.StatusUnauthorized},
+		{"invalid key", APIKeyHeader, "stolen", auth.ScopeSongsRead, true, http.StatusUnauthorized},
+		{"missing scope", APIKeyHeader, "reader", auth.ScopeSongsDelete, false, http.StatusForbidden},
+		{"granted scope", APIKeyHeader, "reader", auth.ScopeSongsRead, false, http.StatusOK},
+		{"bearer token", "Authorization", "Bearer admin", auth.ScopeSongsDelete, false, http.StatusOK},
+		{"other scheme", "Authorization", "Basic admin", auth.ScopeSongsDelete, false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := AuthMiddleware(ctx, authenticator, nil, nil, RequireScope(ctx, tt.scope, tt.publicReads, ok))
+
+			request := httptest.NewRequest(http.MethodGet, "/api/songs", nil)
+			if tt.header != "" {
+				request.Header.Set(tt.header, tt.credential)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareLimitsFailures(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	clientIP, err := ratelimit.NewClientIP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.ClassAuthFailure: {Requests: 2, Window: time.Minute},
+	})
+	authenticator := fakeAuthenticator{"reader": {Name: "reader", Scopes: []string{auth.ScopeSongsRead}}}
+	handler := AuthMiddleware(ctx, authenticator, limiter, clientIP, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(remoteAddr, credential string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/api/songs", nil)
+		request.RemoteAddr = remoteAddr
+		request.Header.Set(APIKeyHeader, credential)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// valid credentials are not counted
+	for i := 0; i < 3; i++ {
+		if recorder := send("192.0.2.1:1234", "reader"); recorder.Code != http.StatusOK {
+			t.Fatalf("valid request %d: status = %d", i, recorder.Code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if recorder := send("192.0.2.1:1234", "guess"); recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status = %d, want 401", i, recorder.Code)
+		}
+	}
+
+	// once the failures are used up, even a right guess is not checked
+	recorder := send("192.0.2.1:1234", "reader")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After = %q, want 429 with Retry-After", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	if recorder := send("192.0.2.2:1234", "reader"); recorder.Code != http.StatusOK {
+		t.Errorf("another address: status = %d, want 200", recorder.Code)
+	}
+}
+
+func TestCredentialsDispatch(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	credentials := Credentials{
+		APIKeys: fakeAuthenticator{"mk_key": {Name: "key"}},
+		Tokens:  fakeAuthenticator{"header.payload.signature": {Name: "token"}},
+	}
+
+	if principal, err := credentials.Authenticate(ctx, "mk_key"); err != nil || principal.Name != "key" {
+		t.Errorf("API key: %+v, %v", principal, err)
+	}
+	if principal, err := credentials.Authenticate(ctx, "header.payload.signature"); err != nil || principal.Name != "token" {
+		t.Errorf("JWT: %+v, %v", principal, err)
+	}
+
+	credentials.Tokens = nil
+	if _, err := credentials.Authenticate(ctx, "header.payload.signature"); err == nil {
+		t.Errorf("expected JWTs to be refused when they are not configured")
+	}
+}
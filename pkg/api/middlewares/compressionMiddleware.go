@@ -0,0 +1,326 @@
+package middlewares
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"effectiveMobileTest/utils"
+)
+
+// Content codings supported for responses and request bodies.
+const (
+	EncodingZstd = "zstd"
+	EncodingGzip = "gzip"
+)
+
+// CompressionOptions configures response compression. Encodings lists the
+// codings responses may use, in the order the server prefers them when a
+// client accepts several equally. Responses shorter than MinSize bytes or
+// with a content type outside ContentTypes, which may hold patterns like
+// text/*, are sent as is. Compressed request bodies are decoded up to
+// MaxDecodedSize bytes, zero means no limit.
+type CompressionOptions struct {
+	Encodings      []string
+	MinSize        int
+	ContentTypes   []string
+	MaxDecodedSize int64
+}
+
+// encoder is implemented by both gzip.Writer and zstd.Encoder.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoders = map[string]*sync.Pool{
+	EncodingZstd: {New: func() any {
+		// cannot fail with valid options
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return encoder
+	}},
+	EncodingGzip: {New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}},
+}
+
+// CompressionMiddleware compresses responses with the coding negotiated
+// through Accept-Encoding and decodes request bodies sent with a
+// Content-Encoding. Responses are buffered up to MinSize bytes to decide
+// whether they are worth compressing; a flush by a streaming handler sends
+// what was written so far right away.
+func CompressionMiddleware(ctx utils.MyContext, options CompressionOptions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if coding := r.Header.Get("Content-Encoding"); coding != "" && !strings.EqualFold(coding, "identity") && r.Body != http.NoBody {
+			body, err := decodedBody(r.Body, strings.ToLower(strings.TrimSpace(coding)), options.MaxDecodedSize)
+			if err != nil {
+				if utils.KindOf(err) == utils.KindUnsupported {
+					w.Header().Set("Accept-Encoding", EncodingZstd+", "+EncodingGzip)
+				}
+				utils.NewErrorResponse(utils.RequestContext(ctx, r), w, err)
+				return
+			}
+			defer body.Close()
+
+			r.Body = body
+			if options.MaxDecodedSize > 0 {
+				// guards against small bodies that decode to huge ones
+				r.Body = http.MaxBytesReader(w, body, options.MaxDecodedSize)
+			}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		coding := negotiateEncoding(r.Header.Get("Accept-Encoding"), options.Encodings)
+		if coding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: w, coding: coding, options: options}
+		defer writer.Close()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// decodedBody returns a reader of the decoded body. With a maxDecodedSize the
+// zstd decoder refuses frames that would take more memory, so that a small
+// frame declaring a huge window or content size cannot make the server
+// allocate it.
+func decodedBody(body io.ReadCloser, coding string, maxDecodedSize int64) (io.ReadCloser, error) {
+	switch coding {
+	case EncodingGzip:
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, utils.NewValidationError("invalid gzip request body: " + err.Error())
+		}
+		return reader, nil
+	case EncodingZstd:
+		options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if maxDecodedSize > 0 {
+			options = append(options,
+				zstd.WithDecoderMaxMemory(uint64(maxDecodedSize)),
+				zstd.WithDecoderMaxWindow(uint64(min(max(maxDecodedSize, zstd.MinWindowSize), zstd.MaxWindowSize))))
+		}
+		decoder, err := zstd.NewReader(body, options...)
+		if err != nil {
+			return nil, utils.NewValidationError("invalid zstd request body: " + err.Error())
+		}
+		return &zstdReader{ReadCloser: decoder.IOReadCloser(), limit: maxDecodedSize}, nil
+	default:
+		return nil, utils.NewUnsupportedMediaTypeError(utils.CodeUnknownEncoding,
+			"unsupported content encoding %s, use %s or %s", coding, EncodingZstd, EncodingGzip)
+	}
+}
+
+// zstdReader reports frames refused for their size like http.MaxBytesReader
+// reports bodies over the limit, so that both are answered alike.
+type zstdReader struct {
+	io.ReadCloser
+	limit int64
+}
+
+func (b *zstdReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		err = &http.MaxBytesError{Limit: b.limit}
+	}
+	return n, err
+}
+
+// negotiateEncoding returns the coding of encodings that the Accept-Encoding
+// header accepts with the highest quality, preferring earlier ones on ties,
+// or "" when none is accepted.
+func negotiateEncoding(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	wildcard := 0.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(name) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		if coding == "*" {
+			wildcard = quality
+		} else {
+			qualities[coding] = quality
+		}
+	}
+
+	best, bestQuality := "", 0.0
+	for _, coding := range encodings {
+		quality, ok := qualities[coding]
+		if !ok {
+			quality = wildcard
+		}
+		if quality > bestQuality {
+			best, bestQuality = coding, quality
+		}
+	}
+
+	return best
+}
+
+// compressWriter holds back the status and the first MinSize bytes of a
+// response until it knows whether to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	coding  string
+	options CompressionOptions
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder encoder
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	switch {
+	case c.decided || status < http.StatusOK:
+		c.ResponseWriter.WriteHeader(status)
+	case status == http.StatusNoContent || status == http.StatusNotModified:
+		c.status = status
+		c.decide(false)
+	case c.status == 0:
+		c.status = status
+	}
+}
+
+func (c *compressWriter) Write(data []byte) (int, error) {
+	if c.decided {
+		if c.encoder != nil {
+			return c.encoder.Write(data)
+		}
+		return c.ResponseWriter.Write(data)
+	}
+
+	c.buf = append(c.buf, data...)
+	if len(c.buf) >= c.options.MinSize {
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// FlushError sends what was written so far, compressing it if the response
+// has a compressible content type, whatever its size: a flushing handler is
+// streaming and its response is likely to grow.
+func (c *compressWriter) FlushError() error {
+	if !c.decided {
+		if err := c.decide(true); err != nil {
+			return err
+		}
+	}
+	if c.encoder != nil {
+		if err := c.encoder.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+func (c *compressWriter) Flush() {
+	_ = c.FlushError()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Close sends a response that stayed shorter than MinSize as is and ends a
+// compressed one.
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if c.status == 0 && len(c.buf) == 0 {
+			return nil
+		}
+		return c.decide(false)
+	}
+	if c.encoder == nil {
+		return nil
+	}
+
+	err := c.encoder.Close()
+	c.encoder.Reset(io.Discard)
+	encoders[c.coding].Put(c.encoder)
+	c.encoder = nil
+
+	return err
+}
+
+// decide writes the header, compressed when compress is set and the response
+// qualifies, and the buffered body.
+func (c *compressWriter) decide(compress bool) error {
+	c.decided = true
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+
+	header := c.Header()
+	if header.Get(utils.ContentType) == "" && len(c.buf) > 0 {
+		// sniffed here, the server would sniff the compressed bytes
+		header.Set(utils.ContentType, http.DetectContentType(c.buf))
+	}
+
+	if compress && header.Get("Content-Encoding") == "" && c.compressible(header.Get(utils.ContentType)) {
+		header.Set("Content-Encoding", c.coding)
+		header.Del("Content-Length")
+		c.encoder = encoders[c.coding].Get().(encoder)
+		c.encoder.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if c.encoder != nil {
+		_, err := c.encoder.Write(buf)
+		return err
+	}
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+func (c *compressWriter) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return slices.ContainsFunc(c.options.ContentTypes, func(pattern string) bool {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			return strings.HasPrefix(mediaType, prefix+"/")
+		}
+		return mediaType == pattern
+	})
+}
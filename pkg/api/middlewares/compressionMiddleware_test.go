@@ -0,0 +1,283 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/utils"
+)
+
+var testCompression = CompressionOptions{
+	Encodings:      []string{EncodingZstd, EncodingGzip},
+	MinSize:        64,
+	ContentTypes:   []string{"application/json", "text/*"},
+	MaxDecodedSize: 1024,
+}
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var reader io.Reader
+	switch encoding {
+	case EncodingGzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = gzipReader
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decoder.Close()
+		reader = decoder
+	default:
+		return string(body)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	large := `{"text":"` + strings.Repeat("la ", 100) + `"}`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		encoding       string
+	}{
+		{"zstd preferred", "gzip, deflate, br, zstd", utils.ApplicationJSON, large, EncodingZstd},
+		{"gzip", "gzip", utils.ApplicationJSON, large, EncodingGzip},
+		{"quality", "zstd;q=0.5, gzip;q=0.8", utils.ApplicationJSON, large, EncodingGzip},
+		{"wildcard", "*", utils.ApplicationJSON, large, EncodingZstd},
+		{"refused", "zstd;q=0, gzip;q=0", utils.ApplicationJSON, large, ""},
+		{"no Accept-Encoding", "", utils.ApplicationJSON, large, ""},
+		{"small", "gzip", utils.ApplicationJSON, `{"id":"1"}`, ""},
+		{"text pattern", "gzip", utils.TextPlain, large, EncodingGzip},
+		{"other content type", "gzip", "image/png", large, ""},
+		{"sniffed content type", "gzip", "", "<html><body>" + large + "</body></html>", EncodingGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CompressionMiddleware(ctx, testCompression, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set(utils.ContentType, tt.contentType)
+				}
+				w.WriteHeader(http.StatusCreated)
+				// written in pieces to cross MinSize in the middle
+				io.WriteString(w, tt.body[:len(tt.body)/2])
+				io.WriteString(w, tt.body[len(tt.body)/2:])
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/api/songs", nil)
+			if tt.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusCreated {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusCreated)
+			}
+			if got := recorder.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := decompress(t, tt.encoding, recorder.Body.Bytes()); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			if recorder.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Vary = %q", recorder.Header().Get("Vary"))
+			}
+			if recorder.Header().Get(utils.ContentType) == "" {
+				t.Error("Content-Type is not set")
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewareStreaming(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	var flushed string
+
+	var recorder *httptest.ResponseRecorder
+	handler := CompressionMiddleware(ctx, testCompression, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(utils.ContentType, "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush() error = %v", err)
+		}
+
+		// the first event can be decoded before the response ends
+		reader, err := gzip.NewReader(bytes.NewReader(recorder.Body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := make([]byte, len("data: first\n\n"))
+		_, err = io.ReadFull(reader, event)
+		if err != nil {
+			t.Errorf("flushed data cannot be decoded: %v", err)
+		}
+		flushed = string(event)
+
+		io.WriteString(w, "data: second\n\n")
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/api/events", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if flushed != "data: first\n\n" {
+		t.Errorf("flushed event = %q", flushed)
+	}
+	if !recorder.Flushed || recorder.Header().Get("Content-Encoding") != EncodingGzip {
+		t.Fatalf("flushed = %t, Content-Encoding = %q", recorder.Flushed, recorder.Header().Get("Content-Encoding"))
+	}
+	if got := decompress(t, EncodingGzip, recorder.Body.Bytes()); got != "data: first\n\ndata: second\n\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestCompressionMiddlewareRequestBody(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	body := `{"group":"Muse","song":"Supermassive Black Hole"}`
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	io.WriteString(gzipWriter, body)
+	gzipWriter.Close()
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zstdBody := encoder.EncodeAll([]byte(body), nil)
+
+	var bomb bytes.Buffer
+	gzipWriter = gzip.NewWriter(&bomb)
+	gzipWriter.Write(make([]byte, 4096))
+	gzipWriter.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+		read     string
+	}{
+		{"plain", "", []byte(body), http.StatusOK, body},
+		{"gzip", "gzip", gzipped.Bytes(), http.StatusOK, body},
+		{"zstd", "ZSTD", zstdBody, http.StatusOK, body},
+		{"identity", "identity", []byte(body), http.StatusOK, body},
+		{"not gzip", "gzip", []byte(body), http.StatusBadRequest, ""},
+		{"unsupported", "br", []byte(body), http.StatusUnsupportedMediaType, ""},
+		{"too large when decoded", "gzip", bomb.Bytes(), http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CompressionMiddleware(ctx, testCompression, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				if string(data) != tt.read || r.Header.Get("Content-Encoding") != "" && tt.encoding != "identity" {
+					t.Errorf("read %q with Content-Encoding %q", data, r.Header.Get("Content-Encoding"))
+				}
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/api/songs", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				request.Header.Set("Content-Encoding", tt.encoding)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			if tt.status == http.StatusUnsupportedMediaType && recorder.Header().Get("Accept-Encoding") == "" {
+				t.Error("Accept-Encoding is not set on 415")
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewareDecompressionBomb(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	zeros := make([]byte, 16<<20)
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write(zeros)
+	gzipWriter.Close()
+
+	// a single frame declaring its content size
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sized := encoder.EncodeAll(zeros, nil)
+
+	// a streamed frame declaring a large window instead
+	var streamed bytes.Buffer
+	streamEncoder, err := zstd.NewWriter(&streamed, zstd.WithWindowSize(8<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamEncoder.Write(zeros)
+	streamEncoder.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"gzip", "gzip", gzipped.Bytes()},
+		{"zstd content size", "zstd", sized},
+		{"zstd window", "zstd", streamed.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var read int64
+			handler := CompressionMiddleware(ctx, testCompression, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var err error
+				read, err = io.Copy(io.Discard, r.Body)
+
+				var tooLarge *http.MaxBytesError
+				if !errors.As(err, &tooLarge) || tooLarge.Limit != testCompression.MaxDecodedSize {
+					t.Errorf("read error = %v, want *http.MaxBytesError with the decoded size limit", err)
+				}
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/api/songs", bytes.NewReader(tt.body))
+			request.Header.Set("Content-Encoding", tt.encoding)
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			if read > testCompression.MaxDecodedSize {
+				t.Errorf("read %d bytes, want at most %d", read, testCompression.MaxDecodedSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the cross-origin requests browsers may send.
+// AllowedOrigins holds exact origins, * for any origin, or patterns like
+// https://*.example.com matching subdomains. An allowed header * allows any
+// header requested in a preflight.
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORSMiddleware adds the CORS headers to responses to allowed origins. It
+// answers preflight requests itself, before they reach the router, which would
+// reject their OPTIONS method for routes registered with other methods.
+func CORSMiddleware(options CORSOptions, next http.Handler) http.Handler {
+	anyOrigin := slices.Contains(options.AllowedOrigins, "*")
+	anyHeader := slices.Contains(options.AllowedHeaders, "*")
+	allowedMethods := strings.Join(options.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(options.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(options.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(options.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if preflight {
+			header.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+		} else {
+			header.Add("Vary", "Origin")
+		}
+
+		if origin == "" || !(anyOrigin || allowsOrigin(options.AllowedOrigins, origin)) {
+			if preflight {
+				// without CORS headers the browser refuses the actual request
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// a wildcard cannot be combined with credentials, the origin is
+		// echoed then
+		if anyOrigin && !options.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if options.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if !slices.Contains(options.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) ||
+			!(anyHeader || allowsHeaders(options.AllowedHeaders, requestedHeaders)) {
+			header.Del("Access-Control-Allow-Origin")
+			header.Del("Access-Control-Allow-Credentials")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", allowedMethods)
+		if anyHeader {
+			header.Set("Access-Control-Allow-Headers", requestedHeaders)
+		} else if allowedHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowedHeaders)
+		}
+		if options.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func allowsOrigin(allowed []string, origin string) bool {
+	for _, pattern := range allowed {
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard {
+			if strings.EqualFold(pattern, origin) {
+				return true
+			}
+			continue
+		}
+
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+			!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+			return true
+		}
+	}
+	return false
+}
+
+func allowsHeaders(allowed []string, requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		if !slices.ContainsFunc(allowed, func(allowed string) bool { return strings.EqualFold(allowed, header) }) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/songs", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet, http.MethodPost)
+	handler := CORSMiddleware(CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders:   []string{"Content-Type", "X-API-Key"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}, router)
+
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		requestMethod  string
+		requestHeaders string
+		status         int
+		allowOrigin    string
+		allowMethods   string
+		exposeHeaders  string
+	}{
+		{"preflight", http.MethodOptions, "https://app.example.com", http.MethodPost, "content-type, x-api-key", http.StatusNoContent, "https://app.example.com", "GET, POST", ""},
+		{"preflight from subdomain", http.MethodOptions, "https://pr-1.preview.example.com", http.MethodGet, "", http.StatusNoContent, "https://pr-1.preview.example.com", "GET, POST", ""},
+		{"preflight from other origin", http.MethodOptions, "https://evil.example.org", http.MethodPost, "", http.StatusNoContent, "", "", ""},
+		{"preflight of nested subdomain host", http.MethodOptions, "https://evil.com/.preview.example.com", http.MethodGet, "", http.StatusNoContent, "", "", ""},
+		{"preflight of other method", http.MethodOptions, "https://app.example.com", http.MethodDelete, "", http.StatusNoContent, "", "", ""},
+		{"preflight of other header", http.MethodOptions, "https://app.example.com", http.MethodPost, "X-Admin", http.StatusNoContent, "", "", ""},
+		{"actual request", http.MethodGet, "https://app.example.com", "", "", http.StatusOK, "https://app.example.com", "", "X-Request-ID"},
+		{"actual request from other origin", http.MethodGet, "https://evil.example.org", "", "", http.StatusOK, "", "", ""},
+		{"same origin request", http.MethodGet, "", "", "", http.StatusOK, "", "", ""},
+		{"plain OPTIONS", http.MethodOptions, "https://app.example.com", "", "", http.StatusMethodNotAllowed, "https://app.example.com", "", "X-Request-ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, "/api/songs", nil)
+			if tt.origin != "" {
+				request.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				request.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			if tt.requestHeaders != "" {
+				request.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			header := recorder.Header()
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Methods"); got != tt.allowMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.allowMethods)
+			}
+			if got := header.Get("Access-Control-Expose-Headers"); got != tt.exposeHeaders {
+				t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, tt.exposeHeaders)
+			}
+			if tt.allowOrigin != "" && header.Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("credentials are not allowed")
+			}
+			if header.Get("Vary") == "" {
+				t.Error("Vary is not set")
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewareAnyOrigin(t *testing.T) {
+	handler := CORSMiddleware(CORSOptions{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodGet},
+		AllowedHeaders: []string{"*"},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := httptest.NewRequest(http.MethodOptions, "/api/songs", nil)
+	request.Header.Set("Origin", "https://anywhere.example")
+	request.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	request.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := recorder.Header().Get("Access-Control-Allow-Headers"); got != "X-Custom" {
+		t.Errorf("Access-Control-Allow-Headers = %q, want the requested header", got)
+	}
+	if got := recorder.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("Access-Control-Max-Age = %q without a max age", got)
+	}
+}
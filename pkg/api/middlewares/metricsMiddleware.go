@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"effectiveMobileTest/pkg/metrics"
+)
+
+// MetricsMiddleware counts requests in flight and records the count and
+// latency of requests by route template, method and status.
+func MetricsMiddleware(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done := metrics.RequestStarted()
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		done(RouteTemplate(router, r), r.Method, recorder.status)
+	})
+}
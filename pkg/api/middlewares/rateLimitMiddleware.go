@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"effectiveMobileTest/pkg/auth"
+	"effectiveMobileTest/pkg/metrics"
+	"effectiveMobileTest/pkg/ratelimit"
+	"effectiveMobileTest/utils"
+)
+
+// RateLimit limits the requests of each client in a route class. Clients are
+// told their quota in the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers and are answered 429 once it is used up.
+// Authenticated clients are counted by their principal, anonymous ones by
+// their address. Requests pass when the counter store fails, so that the
+// limiter never takes the service down.
+func RateLimit(ctx utils.MyContext, limiter *ratelimit.Limiter, clientIP *ratelimit.ClientIP, class string, next http.HandlerFunc) http.HandlerFunc {
+	limit, ok := limiter.Limit(class)
+	if !ok {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestCtx := utils.RequestContext(ctx, r)
+
+		client := "ip:" + clientIP.Of(r)
+		if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+			client = "client:" + principal.Id
+		}
+
+		decision, err := limiter.Allow(requestCtx, class, client)
+		if err != nil {
+			requestCtx.Logger.Warnf("rate limit not applied: %v", err)
+			next(w, r)
+			return
+		}
+
+		reset := max(int64(math.Ceil(decision.Reset.Seconds())), 1)
+		w.Header().Set("RateLimit-Limit", strconv.FormatInt(decision.Limit, 10))
+		w.Header().Set("RateLimit-Remaining", strconv.FormatInt(decision.Remaining, 10))
+		w.Header().Set("RateLimit-Reset", strconv.FormatInt(reset, 10))
+
+		if !decision.Allowed {
+			metrics.RateLimited(class)
+			utils.NewErrorResponse(requestCtx, w, utils.NewRateLimitedError(time.Duration(reset)*time.Second,
+				"rate limit of %d %s requests per %s exceeded", limit.Requests, class, limit.Window))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/pkg/auth"
+	"effectiveMobileTest/pkg/ratelimit"
+	"effectiveMobileTest/utils"
+)
+
+type failingStore struct{}
+
+func (failingStore) Increment(ctx utils.MyContext, key string, window time.Duration) (int64, time.Duration, error) {
+	return 0, 0, errors.New("connection refused")
+}
+
+func (failingStore) Count(ctx utils.MyContext, key string, window time.Duration) (int64, time.Duration, error) {
+	return 0, 0, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	clientIP, err := ratelimit.NewClientIP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.ClassWrite: {Requests: 2, Window: time.Minute},
+	})
+	handler := RateLimit(ctx, limiter, clientIP, ratelimit.ClassWrite, func(w http.ResponseWriter, r *http.Request) {})
+
+	send := func(remoteAddr string, principal *auth.Principal) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPut, "/api/songs/1", nil)
+		request.RemoteAddr = remoteAddr
+		if principal != nil {
+			request = request.WithContext(auth.WithPrincipal(utils.RequestContext(ctx, request), *principal).Ctx)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		recorder := send("192.0.2.1:1234", nil)
+		if recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("request %d: status = %d, remaining = %q", i, recorder.Code, recorder.Header().Get("RateLimit-Remaining"))
+		}
+	}
+
+	recorder := send("192.0.2.1:5678", nil)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", recorder.Code)
+	}
+	if recorder.Header().Get("Retry-After") == "" || recorder.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("headers = %v", recorder.Header())
+	}
+
+	if recorder := send("192.0.2.2:1234", nil); recorder.Code != http.StatusOK {
+		t.Errorf("other address: status = %d", recorder.Code)
+	}
+	if recorder := send("192.0.2.1:1234", &auth.Principal{Id: "key-1"}); recorder.Code != http.StatusOK {
+		t.Errorf("authenticated client: status = %d", recorder.Code)
+	}
+
+	unlimited := RateLimit(ctx, limiter, clientIP, ratelimit.ClassRead, func(w http.ResponseWriter, r *http.Request) {})
+	recorder = httptest.NewRecorder()
+	unlimited(recorder, httptest.NewRequest(http.MethodGet, "/api/songs", nil))
+	if recorder.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("unlimited class sent RateLimit-Limit %q", recorder.Header().Get("RateLimit-Limit"))
+	}
+
+	failing := RateLimit(ctx, ratelimit.NewLimiter(failingStore{}, map[string]ratelimit.Limit{
+		ratelimit.ClassWrite: {Requests: 1, Window: time.Minute},
+	}), clientIP, ratelimit.ClassWrite, func(w http.ResponseWriter, r *http.Request) {})
+	recorder = httptest.NewRecorder()
+	failing(recorder, httptest.NewRequest(http.MethodPut, "/api/songs/1", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("failing store: status = %d, want requests to pass", recorder.Code)
+	}
+}
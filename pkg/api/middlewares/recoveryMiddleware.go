@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"fmt"
 	"net/http"
 	"runtime/debug"
 
@@ -11,8 +12,9 @@ func RecoveryMiddleware(ctx utils.MyContext, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				ctx.Logger.Errorf("panic occurred: %v\n%s", err, debug.Stack())
-				utils.NewErrorResponse(ctx, w, "Internal Server Error")
+				requestCtx := utils.RequestContext(ctx, r)
+				requestCtx.Logger.Errorf("panic occurred: %v\n%s", err, debug.Stack())
+				utils.NewErrorResponse(requestCtx, w, fmt.Errorf("panic: %v", err))
 			}
 		}()
 		next.ServeHTTP(w, r)
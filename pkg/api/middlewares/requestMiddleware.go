@@ -0,0 +1,115 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"effectiveMobileTest/pkg/tracing"
+	"effectiveMobileTest/utils"
+)
+
+const (
+	RequestIdHeader = "X-Request-ID"
+
+	// maxRequestIdLength bounds client-supplied request ids, longer ones are
+	// replaced with a generated id.
+	maxRequestIdLength = 128
+)
+
+// RequestMiddleware gives every request its own MyContext: r.Context(), so that
+// a client disconnect cancels the work done for it, a request id taken from the
+// X-Request-ID header or generated, and a child logger tagged with the request
+// id, method, route template, remote address and trace id. The id is echoed in
+// the response, and one access log line is written when the request completes.
+func RequestMiddleware(ctx utils.MyContext, router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIdHeader)
+		if !validRequestId(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIdHeader, id)
+
+		logger := ctx.Logger.With(
+			"requestId", id,
+			"method", r.Method,
+			"route", RouteTemplate(router, r),
+			"remoteAddr", r.RemoteAddr,
+		)
+		if traceId := tracing.TraceId(r.Context()); traceId != "" {
+			logger = logger.With("traceId", traceId)
+		}
+		requestCtx := utils.WithLogger(utils.WithRequestId(utils.NewMyContext(r.Context(), logger), id))
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(requestCtx.Ctx))
+
+		logger.Infow("request completed",
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"latency", time.Since(start),
+		)
+	})
+}
+
+// RouteTemplate returns the path template of the route matching r, such as
+// /api/songs/{songId}/lyrics, or "unmatched" when no route matches.
+func RouteTemplate(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) || match.Route == nil {
+		return "unmatched"
+	}
+
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return "unmatched"
+	}
+
+	return template
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// responseRecorder remembers the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"effectiveMobileTest/utils"
+)
+
+func TestRequestMiddleware(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx := utils.NewMyContext(context.Background(), zap.New(core).Sugar())
+
+	var handlerCtx utils.MyContext
+	router := mux.NewRouter()
+	router.HandleFunc("/api/songs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerCtx = utils.RequestContext(ctx, r)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+	handler := RequestMiddleware(ctx, router, router)
+
+	requestCtx, cancel := context.WithCancel(context.Background())
+	request := httptest.NewRequest(http.MethodGet, "/api/songs/42", nil).WithContext(requestCtx)
+	request.Header.Set(RequestIdHeader, "client-id-1")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if id := recorder.Header().Get(RequestIdHeader); id != "client-id-1" {
+		t.Errorf("%s = %q, want the id sent by the client", RequestIdHeader, id)
+	}
+	if id := utils.RequestId(handlerCtx); id != "client-id-1" {
+		t.Errorf("RequestId() = %q in the handler", id)
+	}
+	cancel()
+	if handlerCtx.Ctx.Err() == nil {
+		t.Errorf("expected the handler context to be canceled with the request")
+	}
+
+	entries := logs.FilterMessage("request completed").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one access log line, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["route"] != "/api/songs/{id}" || fields["status"] != int64(http.StatusTeapot) || fields["bytes"] != int64(15) {
+		t.Errorf("unexpected access log fields: %+v", fields)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/unknown", nil)
+	request.Header.Set(RequestIdHeader, "bad id\n")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if id := recorder.Header().Get(RequestIdHeader); id == "" || id == "bad id\n" {
+		t.Errorf("expected a generated request id, got %q", id)
+	}
+	if fields := logs.FilterMessage("request completed").All()[1].ContextMap(); fields["route"] != "unmatched" {
+		t.Errorf("route = %v, want unmatched", fields["route"])
+	}
+}
@@ -0,0 +1,57 @@
+package middlewares
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecurityHeaders tell browsers how to treat responses. RouteCSP overrides
+// the ContentSecurityPolicy for paths under a prefix, e.g. for the swagger UI,
+// which needs its own scripts and styles. HSTSMaxAge is sent only on requests
+// served over TLS; zero disables HSTS.
+type SecurityHeaders struct {
+	ContentSecurityPolicy string
+	RouteCSP              map[string]string
+	ReferrerPolicy        string
+	HSTSMaxAge            time.Duration
+}
+
+// SecurityHeadersMiddleware adds the security headers to every response. The
+// policy of the longest prefix matching the path wins.
+func SecurityHeadersMiddleware(headers SecurityHeaders, next http.Handler) http.Handler {
+	prefixes := make([]string, 0, len(headers.RouteCSP))
+	for prefix := range headers.RouteCSP {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	hsts := "max-age=" + strconv.Itoa(int(headers.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+
+		csp := headers.ContentSecurityPolicy
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				csp = headers.RouteCSP[prefix]
+				break
+			}
+		}
+		if csp != "" {
+			header.Set("Content-Security-Policy", csp)
+		}
+
+		header.Set("X-Content-Type-Options", "nosniff")
+		if headers.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", headers.ReferrerPolicy)
+		}
+		if r.TLS != nil && headers.HSTSMaxAge > 0 {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
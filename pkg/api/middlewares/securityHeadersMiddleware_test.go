@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	handler := SecurityHeadersMiddleware(SecurityHeaders{
+		ContentSecurityPolicy: "default-src 'none'",
+		RouteCSP: map[string]string{
+			"/swagger/":       "default-src 'self'",
+			"/swagger/oauth/": "default-src 'self' https://sso.example.com",
+		},
+		ReferrerPolicy: "no-referrer",
+		HSTSMaxAge:     24 * time.Hour,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path string
+		tls  bool
+		csp  string
+		hsts string
+	}{
+		{"/api/songs", false, "default-src 'none'", ""},
+		{"/api/songs", true, "default-src 'none'", "max-age=86400; includeSubDomains"},
+		{"/swagger/index.html", false, "default-src 'self'", ""},
+		{"/swagger/oauth/callback", false, "default-src 'self' https://sso.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.tls {
+			request.TLS = &tls.ConnectionState{}
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		header := recorder.Header()
+		if got := header.Get("Content-Security-Policy"); got != tt.csp {
+			t.Errorf("%s: Content-Security-Policy = %q, want %q", tt.path, got, tt.csp)
+		}
+		if got := header.Get("Strict-Transport-Security"); got != tt.hsts {
+			t.Errorf("%s (tls %t): Strict-Transport-Security = %q, want %q", tt.path, tt.tls, got, tt.hsts)
+		}
+		if header.Get("X-Content-Type-Options") != "nosniff" || header.Get("Referrer-Policy") != "no-referrer" {
+			t.Errorf("%s: headers = %v", tt.path, header)
+		}
+	}
+}
@@ -11,6 +11,10 @@ import (
 	"effectiveMobileTest/config"
 	"effectiveMobileTest/pkg/api/handler"
 	"effectiveMobileTest/pkg/api/middlewares"
+	"effectiveMobileTest/pkg/auth"
+	"effectiveMobileTest/pkg/health"
+	"effectiveMobileTest/pkg/ratelimit"
+	"effectiveMobileTest/pkg/service/apikeys"
 	"effectiveMobileTest/pkg/service/music"
 	"effectiveMobileTest/utils"
 )
@@ -24,14 +28,60 @@ const (
 type Server struct {
 	httpServer *http.Server
 	router     *mux.Router
+	auth       config.AuthConfig
+	limiter    *ratelimit.Limiter
+	clientIP   *ratelimit.ClientIP
+	tls        config.TLSConfig
 }
 
-func NewServer(ctx utils.MyContext, config config.Config) *Server {
+// NewServer sets up the HTTP server. With authentication enabled, API keys
+// sent by clients are checked with authenticator. Requests are rate limited
+// by limiter, with clients told apart by clientIP; a nil limiter disables
+// rate limiting.
+func NewServer(ctx utils.MyContext, config config.Config, authenticator middlewares.Authenticator,
+	limiter *ratelimit.Limiter, clientIP *ratelimit.ClientIP) *Server {
 	router := mux.NewRouter()
 
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
-	wrappedRouter := middlewares.RecoveryMiddleware(ctx, router)
+	var handler http.Handler = router
+	if config.Auth.Enabled {
+		handler = middlewares.AuthMiddleware(ctx, authenticator, limiter, clientIP, router)
+	}
+	// compression goes inside CORS and the security headers, so that its
+	// rejections of request bodies carry them too
+	if compression := config.Compression; compression.Enabled {
+		handler = middlewares.CompressionMiddleware(ctx, middlewares.CompressionOptions{
+			Encodings:      compression.Encodings,
+			MinSize:        compression.MinSize,
+			ContentTypes:   compression.ContentTypes,
+			MaxDecodedSize: int64(compression.MaxDecodedSize),
+		}, handler)
+	}
+	// CORS goes before authentication, so that preflights need no
+	// credentials and rejections carry CORS headers browsers can read
+	if cors := config.CORS; len(cors.AllowedOrigins) > 0 {
+		handler = middlewares.CORSMiddleware(middlewares.CORSOptions{
+			AllowedOrigins:   cors.AllowedOrigins,
+			AllowedMethods:   cors.AllowedMethods,
+			AllowedHeaders:   cors.AllowedHeaders,
+			ExposedHeaders:   cors.ExposedHeaders,
+			AllowCredentials: cors.AllowCredentials,
+			MaxAge:           cors.MaxAge,
+		}, handler)
+	}
+	handler = middlewares.SecurityHeadersMiddleware(middlewares.SecurityHeaders{
+		ContentSecurityPolicy: config.Security.ContentSecurityPolicy,
+		RouteCSP:              config.Security.RouteCSP,
+		ReferrerPolicy:        config.Security.ReferrerPolicy,
+		HSTSMaxAge:            config.Security.HSTSMaxAge,
+	}, handler)
+
+	handler = middlewares.RecoveryMiddleware(ctx, handler)
+
+	wrappedRouter := middlewares.TracingMiddleware(ctx, router,
+		middlewares.RequestMiddleware(ctx, router,
+			middlewares.MetricsMiddleware(router, handler)))
 
 	return &Server{
 		httpServer: &http.Server{
@@ -41,11 +91,35 @@ func NewServer(ctx utils.MyContext, config config.Config) *Server {
 			WriteTimeout:   writeTimeout,
 			Handler:        wrappedRouter,
 		},
-		router: router,
+		router:   router,
+		auth:     config.Auth,
+		limiter:  limiter,
+		clientIP: clientIP,
+		tls:      config.TLS,
+	}
+}
+
+// guard rate limits handlers in their route class and checks the scope they
+// require, unless authentication is disabled. Rate limiting comes first, so
+// that requests over the limit are turned away without a scope check.
+// Guessing credentials is limited earlier, by AuthMiddleware.
+func (s *Server) guard(ctx utils.MyContext, scope, class string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if s.auth.Enabled {
+			next = middlewares.RequireScope(ctx, scope, s.auth.PublicReads, next)
+		}
+		if s.limiter != nil {
+			next = middlewares.RateLimit(ctx, s.limiter, s.clientIP, class, next)
+		}
+		return next
 	}
 }
 
+// Run serves HTTPS when a TLS certificate is configured, HTTP otherwise.
 func (s *Server) Run() error {
+	if s.tls.CertFile != "" && s.tls.KeyFile != "" {
+		return s.httpServer.ListenAndServeTLS(s.tls.CertFile, s.tls.KeyFile)
+	}
 	return s.httpServer.ListenAndServe()
 }
 
@@ -53,10 +127,48 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.httpServer.Shutdown(ctx)
 }
 
+// HandleHealth serves the liveness, readiness and health endpoints used by
+// orchestrators and load balancers.
+func (s *Server) HandleHealth(ctx utils.MyContext, checker *health.Checker) {
+	s.router.HandleFunc("/healthz", handler.Healthz()).Methods(http.MethodGet)
+	s.router.HandleFunc("/readyz", handler.Readyz(ctx, checker)).Methods(http.MethodGet)
+	s.router.HandleFunc("/health", handler.Health(ctx, checker)).Methods(http.MethodGet)
+}
+
 func (s *Server) HandleMusic(ctx utils.MyContext, service music.MusicService) {
-	s.router.HandleFunc("/api/songs", handler.AddSong(ctx, service)).Methods(http.MethodPost)
-	s.router.HandleFunc("/api/songs", handler.GetSongs(ctx, service)).Methods(http.MethodGet)
-	s.router.HandleFunc("/api/songs/{songId}/lyrics", handler.GetLyrics(ctx, service)).Methods(http.MethodGet)
-	s.router.HandleFunc("/api/songs/{id}", handler.UpdateSong(ctx, service)).Methods(http.MethodPut)
-	s.router.HandleFunc("/api/songs/{id}", handler.DeleteSong(ctx, service)).Methods(http.MethodDelete)
+	read := s.guard(ctx, auth.ScopeSongsRead, ratelimit.ClassRead)
+	write := s.guard(ctx, auth.ScopeSongsWrite, ratelimit.ClassWrite)
+	// importing fetches song details from the upstream providers and uses
+	// up their quota
+	importing := s.guard(ctx, auth.ScopeSongsWrite, ratelimit.ClassImport)
+	remove := s.guard(ctx, auth.ScopeSongsDelete, ratelimit.ClassWrite)
+	admin := s.guard(ctx, auth.ScopeAdmin, ratelimit.ClassRead)
+
+	s.router.HandleFunc("/api/songs", importing(handler.AddSong(ctx, service))).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/songs", read(handler.GetSongs(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/songs:refresh", importing(handler.RefreshSongs(ctx, service))).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/songs/{songId}/lyrics", read(handler.GetLyrics(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/songs/{songId}/lyrics/revisions", read(handler.GetLyricsRevisions(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/songs/{songId}/lyrics/diff", read(handler.GetLyricsDiff(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/songs/{songId}/annotations", write(handler.AddAnnotation(ctx, service))).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/songs/{songId}/annotations", read(handler.GetAnnotations(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/songs/{songId}/annotations/{id}", write(handler.UpdateAnnotation(ctx, service))).Methods(http.MethodPut)
+	s.router.HandleFunc("/api/songs/{songId}/annotations/{id}", remove(handler.DeleteAnnotation(ctx, service))).Methods(http.MethodDelete)
+	s.router.HandleFunc("/api/songs/{id:[^/:]+}:enrich", importing(handler.EnrichSong(ctx, service))).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/songs/{id}/similar", read(handler.GetSimilar(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/status/details", admin(handler.GetDetailsStatus(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/status/details/repairs", admin(handler.GetDetailsRepairs(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/lyrics/lookup", read(handler.LookupLyrics(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/songs/{id}", write(handler.UpdateSong(ctx, service))).Methods(http.MethodPut)
+	s.router.HandleFunc("/api/songs/{id}", remove(handler.DeleteSong(ctx, service))).Methods(http.MethodDelete)
+}
+
+// HandleAPIKeys serves the admin endpoints managing API keys.
+func (s *Server) HandleAPIKeys(ctx utils.MyContext, service apikeys.APIKeyService) {
+	adminRead := s.guard(ctx, auth.ScopeAdmin, ratelimit.ClassRead)
+	adminWrite := s.guard(ctx, auth.ScopeAdmin, ratelimit.ClassWrite)
+
+	s.router.HandleFunc("/api/admin/keys", adminWrite(handler.CreateAPIKey(ctx, service))).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/admin/keys", adminRead(handler.GetAPIKeys(ctx, service))).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/admin/keys/{id}", adminWrite(handler.RevokeAPIKey(ctx, service))).Methods(http.MethodDelete)
 }
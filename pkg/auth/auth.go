@@ -0,0 +1,55 @@
+// Package auth defines the scopes that guard the API and the principal of an
+// authenticated request.
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"effectiveMobileTest/utils"
+)
+
+// Scopes granted to API clients. ScopeAdmin grants every other scope.
+const (
+	ScopeSongsRead   = "songs:read"
+	ScopeSongsWrite  = "songs:write"
+	ScopeSongsDelete = "songs:delete"
+	ScopeAdmin       = "admin"
+)
+
+// Scopes lists every known scope.
+var Scopes = []string{ScopeSongsRead, ScopeSongsWrite, ScopeSongsDelete, ScopeAdmin}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// Principal is the client a request was authenticated as.
+type Principal struct {
+	// Id identifies the caller: the id of an API key or the subject of a JWT.
+	Id     string
+	Name   string
+	Scopes []string
+	// Roles are the roles of a JWT the scopes were derived from.
+	Roles []string
+}
+
+// HasScope reports whether the principal was granted scope, directly or
+// through ScopeAdmin.
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal.
+func WithPrincipal(ctx utils.MyContext, principal Principal) utils.MyContext {
+	return utils.NewMyContext(context.WithValue(ctx.Ctx, principalKey{}, principal), ctx.Logger)
+}
+
+// PrincipalFrom returns the principal a request was authenticated as, if any.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
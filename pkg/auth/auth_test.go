@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/utils"
+)
+
+func TestPrincipalHasScope(t *testing.T) {
+	reader := Principal{Scopes: []string{ScopeSongsRead}}
+	if !reader.HasScope(ScopeSongsRead) || reader.HasScope(ScopeSongsDelete) {
+		t.Errorf("unexpected scopes of a reader: %v", reader.Scopes)
+	}
+
+	admin := Principal{Scopes: []string{ScopeAdmin}}
+	for _, scope := range Scopes {
+		if !admin.HasScope(scope) {
+			t.Errorf("expected admin to have scope %s", scope)
+		}
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	if _, ok := PrincipalFrom(ctx.Ctx); ok {
+		t.Fatalf("expected no principal in a fresh context")
+	}
+
+	ctx = WithPrincipal(ctx, Principal{Id: "key-1", Scopes: []string{ScopeSongsRead}})
+	if principal, ok := PrincipalFrom(ctx.Ctx); !ok || principal.Id != "key-1" {
+		t.Errorf("PrincipalFrom() = %+v, %v", principal, ok)
+	}
+}
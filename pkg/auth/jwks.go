@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwks holds the public keys of a JWKS file. The file is read again when a
+// token names a key it does not hold and the file has changed, so that keys
+// can be rotated without a restart.
+type jwks struct {
+	file string
+
+	mu      sync.Mutex
+	modTime time.Time
+	keys    map[string]jsonWebKey
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	publicKey any
+}
+
+func loadJWKS(file string) (*jwks, error) {
+	keys := &jwks{file: file}
+	if err := keys.reload(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// key returns the key with the given id for alg. Without a kid the only key
+// of the file is used.
+func (k *jwks) key(kid, alg string) (any, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, found := k.lookup(kid)
+	if !found {
+		if info, err := os.Stat(k.file); err == nil && !info.ModTime().Equal(k.modTime) {
+			if err = k.reload(); err != nil {
+				return nil, err
+			}
+			key, found = k.lookup(kid)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	if key.Alg != "" && key.Alg != alg {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, key.Alg, alg)
+	}
+	switch key.publicKey.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return nil, fmt.Errorf("RSA key %q cannot verify %s", kid, alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return nil, fmt.Errorf("EC key %q cannot verify %s", kid, alg)
+		}
+	}
+
+	return key.publicKey, nil
+}
+
+func (k *jwks) lookup(kid string) (jsonWebKey, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+
+	key, found := k.keys[kid]
+	return key, found
+}
+
+func (k *jwks) reload() error {
+	info, err := os.Stat(k.file)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	data, err := os.ReadFile(k.file)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("invalid JWKS file %s: %w", k.file, err)
+	}
+
+	keys := make(map[string]jsonWebKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if key.publicKey, err = key.parse(); err != nil {
+			return fmt.Errorf("invalid key %q in JWKS file %s: %w", key.Kid, k.file, err)
+		}
+		keys[key.Kid] = key
+	}
+
+	k.keys = keys
+	k.modTime = info.ModTime()
+	return nil
+}
+
+func (key jsonWebKey) parse() (any, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if key.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil || len(x) != 32 {
+			return nil, fmt.Errorf("invalid x coordinate")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(key.Y)
+		if err != nil || len(y) != 32 {
+			return nil, fmt.Errorf("invalid y coordinate")
+		}
+		// ecdh rejects points that are not on the curve
+		if _, err = ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
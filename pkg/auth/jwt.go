@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"effectiveMobileTest/utils"
+)
+
+// Roles carried by JWTs. Each grants a set of scopes, see RoleScopes.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// RoleScopes lists the scopes granted by each role.
+var RoleScopes = map[string][]string{
+	RoleViewer: {ScopeSongsRead},
+	RoleEditor: {ScopeSongsRead, ScopeSongsWrite, ScopeSongsDelete},
+	RoleAdmin:  {ScopeAdmin},
+}
+
+// JWTConfig selects how bearer tokens are verified. HS256 tokens are checked
+// with Secret, RS256 and ES256 tokens with the keys of the JWKS file; only the
+// algorithms with a configured key are accepted.
+type JWTConfig struct {
+	Secret   []byte
+	JWKSFile string
+	// Issuer and Audience are required and must match the iss and aud
+	// claims, so that tokens issued for other services are refused.
+	Issuer   string
+	Audience string
+	// RolesClaim is the claim holding the roles, a string or a list of
+	// strings. A dotted path such as realm_access.roles reaches into nested
+	// objects.
+	RolesClaim string
+	// RoleMapping translates the role names of the identity provider to
+	// RoleViewer, RoleEditor or RoleAdmin. Those names are accepted as is.
+	RoleMapping map[string]string
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+}
+
+// JWTAuthenticator verifies bearer JWTs and maps their roles to scopes.
+type JWTAuthenticator struct {
+	config JWTConfig
+	jwks   *jwks
+	parser *jwt.Parser
+}
+
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	var methods []string
+	if len(config.Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	authenticator := &JWTAuthenticator{config: config}
+	if config.JWKSFile != "" {
+		keys, err := loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.jwks = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("neither a JWT secret nor a JWKS file is configured")
+	}
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, fmt.Errorf("JWT issuer and audience must be configured")
+	}
+
+	authenticator.parser = jwt.NewParser(
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(config.Leeway),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(config.Audience),
+	)
+
+	return authenticator, nil
+}
+
+// Authenticate verifies the signature, expiry, issuer and audience of a token
+// and returns its subject with the scopes of its roles.
+func (a *JWTAuthenticator) Authenticate(ctx utils.MyContext, token string) (Principal, error) {
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(token, claims, a.key); err != nil {
+		return Principal{}, utils.NewUnauthorizedError("invalid token: %v", err)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return Principal{}, utils.NewUnauthorizedError("invalid token: missing sub claim")
+	}
+
+	principal := Principal{Id: subject, Name: subject, Roles: a.roles(claims)}
+	for _, claim := range []string{"preferred_username", "email"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			principal.Name = name
+			break
+		}
+	}
+	for _, role := range principal.Roles {
+		principal.Scopes = append(principal.Scopes, RoleScopes[role]...)
+	}
+
+	return principal, nil
+}
+
+func (a *JWTAuthenticator) key(token *jwt.Token) (any, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		return a.config.Secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	return a.jwks.key(kid, token.Method.Alg())
+}
+
+// roles returns the known roles named in the roles claim, in claim order and
+// without duplicates.
+func (a *JWTAuthenticator) roles(claims jwt.MapClaims) []string {
+	var value any = map[string]any(claims)
+	for _, name := range strings.Split(a.config.RolesClaim, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	var names []string
+	switch value := value.(type) {
+	case string:
+		names = strings.Fields(value)
+	case []any:
+		for _, name := range value {
+			if name, ok := name.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var roles []string
+	for _, name := range names {
+		role, ok := a.config.RoleMapping[name]
+		if !ok {
+			role = name
+		}
+		if _, known := RoleScopes[role]; known && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/utils"
+)
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func claims(overrides jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"iss":   "https://sso.example.com",
+		"aud":   "music-api",
+		"sub":   "user-1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"viewer"},
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
+
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err = os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func encode(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	secret := []byte("shared-secret")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := writeJWKS(t,
+		map[string]string{"kty": "RSA", "kid": "rsa-1", "alg": "RS256", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+		map[string]string{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+	)
+
+	authenticator, err := NewJWTAuthenticator(JWTConfig{
+		Secret:      secret,
+		JWKSFile:    jwksFile,
+		Issuer:      "https://sso.example.com",
+		Audience:    "music-api",
+		RolesClaim:  "roles",
+		RoleMapping: map[string]string{"music-editors": RoleEditor},
+	})
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator() error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		valid  bool
+		scopes []string
+	}{
+		{"HS256", sign(t, jwt.SigningMethodHS256, secret, "", claims(nil)), true, []string{ScopeSongsRead}},
+		{"RS256", sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(nil)), true, []string{ScopeSongsRead}},
+		{"ES256", sign(t, jwt.SigningMethodES256, ecKey, "ec-1", claims(nil)), true, []string{ScopeSongsRead}},
+		{"mapped role", sign(t, jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"roles": []string{"music-editors", "unknown"}})), true,
+			[]string{ScopeSongsRead, ScopeSongsWrite, ScopeSongsDelete}},
+		{"no roles", sign(t, jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"roles": nil})), true, nil},
+		{"wrong secret", sign(t, jwt.SigningMethodHS256, []byte("guess"), "", claims(nil)), false, nil},
+		{"expired", sign(t, jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), false, nil},
+		{"no expiry", sign(t, jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"exp": nil})), false, nil},
+		{"wrong issuer", sign(t, jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"iss": "https://evil.example.com"})), false, nil},
+		{"wrong audience", sign(t, jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"aud": "other-api"})), false, nil},
+		{"no subject", sign(t, jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"sub": nil})), false, nil},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-2", claims(nil)), false, nil},
+		{"EC key used for RS256", sign(t, jwt.SigningMethodRS256, rsaKey, "ec-1", claims(nil)), false, nil},
+		{"unsupported algorithm", sign(t, jwt.SigningMethodHS512, secret, "", claims(nil)), false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(ctx, tt.token)
+			if !tt.valid {
+				if utils.KindOf(err) != utils.KindUnauthorized {
+					t.Errorf("expected an unauthorized error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error: %v", err)
+			}
+			if principal.Id != "user-1" || !slices.Equal(principal.Scopes, tt.scopes) {
+				t.Errorf("principal = %+v, want scopes %v", principal, tt.scopes)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorNestedRolesClaim(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	secret := []byte("shared-secret")
+
+	authenticator, err := NewJWTAuthenticator(JWTConfig{
+		Secret:     secret,
+		Issuer:     "https://sso.example.com",
+		Audience:   "music-api",
+		RolesClaim: "realm_access.roles",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := sign(t, jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{
+		"realm_access":       map[string]any{"roles": []string{"admin"}},
+		"preferred_username": "alice",
+	}))
+	principal, err := authenticator.Authenticate(ctx, token)
+	if err != nil {
+		t.Fatalf("Authenticate() error: %v", err)
+	}
+	if principal.Name != "alice" || !principal.HasScope(ScopeSongsDelete) {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+}
+
+func TestJWTAuthenticatorRequiresKeys(t *testing.T) {
+	if _, err := NewJWTAuthenticator(JWTConfig{}); err == nil {
+		t.Errorf("expected an error without a secret or JWKS file")
+	}
+	if _, err := NewJWTAuthenticator(JWTConfig{JWKSFile: "missing.json"}); err == nil {
+		t.Errorf("expected an error for a missing JWKS file")
+	}
+	if _, err := NewJWTAuthenticator(JWTConfig{Secret: []byte("secret"), Issuer: "https://sso.example.com"}); err == nil {
+		t.Errorf("expected an error without an audience")
+	}
+	if _, err := NewJWTAuthenticator(JWTConfig{Secret: []byte("secret"), Audience: "music-api"}); err == nil {
+		t.Errorf("expected an error without an issuer")
+	}
+
+	// only the JWKS is configured, so HS256 tokens are refused even if they
+	// are signed with the public key material
+	authenticator, err := NewJWTAuthenticator(JWTConfig{JWKSFile: writeJWKS(t), Issuer: "https://sso.example.com", Audience: "music-api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := sign(t, jwt.SigningMethodHS256, []byte("anything"), "", claims(nil))
+	if _, err = authenticator.Authenticate(utils.NewMyContext(context.Background(), zap.NewNop().Sugar()), token); err == nil {
+		t.Errorf("expected HS256 to be refused without a secret")
+	}
+}
@@ -0,0 +1,127 @@
+// Package health runs the dependency checks behind the readiness and health
+// endpoints and tracks whether the app is draining before shutdown.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"effectiveMobileTest/models"
+)
+
+// Statuses of the app and of single checks.
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Check is a dependency check. A failing optional check degrades the app
+// without making it unready.
+type Check struct {
+	Name     string
+	Optional bool
+	Func     func(ctx context.Context) error
+}
+
+// Checker runs the checks concurrently, each bounded by timeout.
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Drain makes the app unready, so that load balancers stop sending traffic
+// before the server shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Run runs every check and reports the app down when a required check fails
+// or the app is draining, and degraded when only optional checks fail.
+func (c *Checker) Run(ctx context.Context) models.HealthReport {
+	report := models.HealthReport{
+		Status:   StatusUp,
+		Draining: c.Draining(),
+		Checks:   make([]models.HealthCheck, len(c.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for _, check := range report.Checks {
+		switch {
+		case check.Status == StatusUp:
+		case check.Optional:
+			if report.Status == StatusUp {
+				report.Status = StatusDegraded
+			}
+		default:
+			report.Status = StatusDown
+		}
+	}
+	if report.Draining {
+		report.Status = StatusDown
+	}
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) models.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Func(ctx)
+
+	result := models.HealthCheck{
+		Name:      check.Name,
+		Status:    StatusUp,
+		Optional:  check.Optional,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// Ready reports whether the app accepts traffic. While draining the checks
+// are not run.
+func (c *Checker) Ready(ctx context.Context) models.ReadinessStatus {
+	if c.Draining() {
+		return models.ReadinessStatus{Status: StatusDown, Failed: []string{"draining"}}
+	}
+
+	status := models.ReadinessStatus{Status: StatusUp}
+	for _, check := range c.Run(ctx).Checks {
+		if check.Status != StatusUp && !check.Optional {
+			status.Status = StatusDown
+			status.Failed = append(status.Failed, check.Name)
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,79 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckerRun(t *testing.T) {
+	up := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name   string
+		checks []Check
+		status string
+		ready  string
+		failed []string
+	}{
+		{"all up", []Check{{Name: "db", Func: up}, {Name: "details", Optional: true, Func: up}}, StatusUp, StatusUp, nil},
+		{"optional down", []Check{{Name: "db", Func: up}, {Name: "details", Optional: true, Func: down}}, StatusDegraded, StatusUp, nil},
+		{"required down", []Check{{Name: "db", Func: down}, {Name: "details", Optional: true, Func: down}}, StatusDown, StatusDown, []string{"db"}},
+		{"timed out", []Check{{Name: "db", Func: slow}, {Name: "migrations", Func: up}}, StatusDown, StatusDown, []string{"db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(10*time.Millisecond, tt.checks...)
+
+			report := checker.Run(context.Background())
+			if report.Status != tt.status {
+				t.Errorf("Run() status = %s, want %s", report.Status, tt.status)
+			}
+			for i, check := range report.Checks {
+				if check.Name != tt.checks[i].Name {
+					t.Errorf("check %d = %s, want %s", i, check.Name, tt.checks[i].Name)
+				}
+				if (check.Status == StatusDown) != (check.Error != "") {
+					t.Errorf("check %s has status %s and error %q", check.Name, check.Status, check.Error)
+				}
+			}
+			if body, _ := json.Marshal(report); strings.Contains(string(body), "connection refused") {
+				t.Errorf("Run() report %s exposes check errors", body)
+			}
+
+			ready := checker.Ready(context.Background())
+			if ready.Status != tt.ready || len(ready.Failed) != len(tt.failed) {
+				t.Errorf("Ready() = %+v, want %s with %v failed", ready, tt.ready, tt.failed)
+			}
+		})
+	}
+}
+
+func TestCheckerDrain(t *testing.T) {
+	calls := 0
+	checker := NewChecker(time.Second, Check{Name: "db", Func: func(context.Context) error {
+		calls++
+		return nil
+	}})
+
+	checker.Drain()
+
+	if ready := checker.Ready(context.Background()); ready.Status != StatusDown {
+		t.Errorf("Ready() status = %s while draining, want %s", ready.Status, StatusDown)
+	}
+	if calls != 0 {
+		t.Errorf("expected no checks to run while draining")
+	}
+	if report := checker.Run(context.Background()); report.Status != StatusDown || !report.Draining {
+		t.Errorf("Run() = %+v while draining", report)
+	}
+}
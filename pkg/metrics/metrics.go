@@ -0,0 +1,187 @@
+// Package metrics defines the Prometheus metrics of the app. They are
+// registered with the default registry, which also carries the Go runtime and
+// process metrics, and served by Handler.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "music"
+
+// Outcomes of song details requests.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not_found"
+	OutcomeCanceled = "canceled"
+	OutcomeError    = "error"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	httpRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being served.",
+	})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of repository queries by query name.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	detailsRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "details_request_duration_seconds",
+		Help:      "Latency of song details API requests, retries included, by provider and outcome.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"provider", "outcome"})
+
+	rateLimitedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the rate limiter by route class.",
+	}, []string{"class"})
+)
+
+// Handler serves the metrics in the Prometheus text format. A collector that
+// fails only drops its own metrics, so that a database outage does not hide
+// the others.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}))
+}
+
+// RequestStarted counts a request in flight until the returned function
+// records its route template, method, status and latency.
+func RequestStarted() func(route, method string, status int) {
+	start := time.Now()
+	httpRequestsInFlight.Inc()
+
+	return func(route, method string, status int) {
+		httpRequestsInFlight.Dec()
+
+		labels := []string{route, method, strconv.Itoa(status)}
+		httpRequests.WithLabelValues(labels...).Inc()
+		httpRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveQuery records the latency of a repository query. Use it as
+// defer metrics.ObserveQuery("GetSong")().
+func ObserveQuery(query string) func() {
+	start := time.Now()
+
+	return func() {
+		dbQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveDetailsRequest records the latency and outcome of a request to a song
+// details provider.
+func ObserveDetailsRequest(provider, outcome string, latency time.Duration) {
+	detailsRequestDuration.WithLabelValues(provider, outcome).Observe(latency.Seconds())
+}
+
+// RateLimited counts a request rejected by the rate limiter.
+func RateLimited(class string) {
+	rateLimitedRequests.WithLabelValues(class).Inc()
+}
+
+// SongStats are the business counters reported as gauges.
+type SongStats struct {
+	Total   int64
+	Pending int64
+}
+
+// songStatsCollector reads the song counters from the database, at most once
+// per maxAge.
+type songStatsCollector struct {
+	stats   func(ctx context.Context) (SongStats, error)
+	timeout time.Duration
+	maxAge  time.Duration
+
+	mu        sync.Mutex
+	cached    SongStats
+	fetchedAt time.Time
+
+	total   *prometheus.Desc
+	pending *prometheus.Desc
+}
+
+// NewSongStatsCollector returns a collector of the total number of songs and
+// of the songs waiting for enrichment. Counting scans the songs table, so the
+// result is reused by the scrapes within maxAge. A scrape whose stats call
+// fails or takes longer than timeout reports an invalid metric instead.
+func NewSongStatsCollector(stats func(ctx context.Context) (SongStats, error), timeout, maxAge time.Duration) prometheus.Collector {
+	return &songStatsCollector{
+		stats:   stats,
+		timeout: timeout,
+		maxAge:  maxAge,
+		total: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "songs"),
+			"Songs in the library.", nil, nil),
+		pending: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "songs_pending_enrichment"),
+			"Songs waiting for their details to be fetched.", nil, nil),
+	}
+}
+
+func (c *songStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.total
+	ch <- c.pending
+}
+
+func (c *songStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.get()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.total, err)
+		ch <- prometheus.NewInvalidMetric(c.pending, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stats.Total))
+	ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(stats.Pending))
+}
+
+// get returns the cached stats while they are fresh and queries them again
+// otherwise. Concurrent scrapes wait for a single query.
+func (c *songStatsCollector) get() (SongStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.maxAge {
+		return c.cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	stats, err := c.stats(ctx)
+	if err != nil {
+		return SongStats{}, err
+	}
+
+	c.cached, c.fetchedAt = stats, time.Now()
+	return stats, nil
+}
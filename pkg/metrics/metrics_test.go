@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSongStatsCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewSongStatsCollector(func(context.Context) (SongStats, error) {
+		return SongStats{Total: 12, Pending: 3}, nil
+	}, time.Second, 0))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		values[family.GetName()] = family.GetMetric()[0].GetGauge().GetValue()
+	}
+	if values["music_songs"] != 12 || values["music_songs_pending_enrichment"] != 3 {
+		t.Errorf("unexpected gauges: %v", values)
+	}
+}
+
+func TestSongStatsCollectorError(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewSongStatsCollector(func(context.Context) (SongStats, error) {
+		return SongStats{}, errors.New("connection refused")
+	}, time.Second, 0))
+
+	if _, err := registry.Gather(); err == nil {
+		t.Errorf("expected the failed stats query to be reported")
+	}
+}
+
+func TestSongStatsCollectorCache(t *testing.T) {
+	var (
+		calls int
+		fail  bool
+	)
+	collector := NewSongStatsCollector(func(context.Context) (SongStats, error) {
+		calls++
+		if fail {
+			return SongStats{}, errors.New("connection refused")
+		}
+		return SongStats{Total: int64(calls)}, nil
+	}, time.Second, time.Hour).(*songStatsCollector)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	for range 3 {
+		if _, err := registry.Gather(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("stats queried %d times, want once within the max age", calls)
+	}
+
+	collector.fetchedAt = time.Now().Add(-2 * time.Hour)
+	fail = true
+	if _, err := registry.Gather(); err == nil {
+		t.Errorf("expected a failed query of expired stats to be reported")
+	}
+	if calls != 2 {
+		t.Errorf("stats queried %d times, want expired stats queried again", calls)
+	}
+}
+
+func TestHandlerContinuesOnCollectorError(t *testing.T) {
+	collector := NewSongStatsCollector(func(context.Context) (SongStats, error) {
+		return SongStats{}, errors.New("connection refused")
+	}, time.Second, 0)
+	prometheus.MustRegister(collector)
+	defer prometheus.Unregister(collector)
+
+	RequestStarted()("/api/songs", http.MethodGet, http.StatusOK)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "music_http_requests_total") || strings.Contains(body, "music_songs ") {
+		t.Errorf("expected the other metrics served without the failed gauges, got:\n%s", body)
+	}
+}
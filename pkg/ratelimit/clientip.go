@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP finds the address of the client of a request. X-Forwarded-For is
+// trusted only when the request comes from a trusted proxy; the client is
+// then the rightmost address of the header that is not a trusted proxy.
+type ClientIP struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIP parses the trusted proxies, given as addresses or CIDR
+// prefixes.
+func NewClientIP(trustedProxies []string) (*ClientIP, error) {
+	c := &ClientIP{}
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		c.trusted = append(c.trusted, prefix.Masked())
+	}
+
+	return c, nil
+}
+
+func (c *ClientIP) Of(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !c.isTrusted(remote) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// a malformed hop cannot be attributed, stop at the last proxy
+			break
+		}
+		if !c.isTrusted(hop) {
+			return hop.Unmap().String()
+		}
+		remote = hop
+	}
+
+	return remote.Unmap().String()
+}
+
+func (c *ClientIP) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
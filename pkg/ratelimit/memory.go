@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"effectiveMobileTest/utils"
+)
+
+// sweepInterval is how often counters of past windows are dropped.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps the counters of one instance in memory.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]window
+	lastSweep time.Time
+}
+
+type window struct {
+	end   time.Time
+	count int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		now:     time.Now,
+		windows: make(map[string]window),
+	}
+}
+
+func (s *MemoryStore) Increment(ctx utils.MyContext, key string, length time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for key, w := range s.windows {
+			if !now.Before(w.end) {
+				delete(s.windows, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.end) {
+		// windows are aligned to multiples of their length, like those of
+		// the Postgres store
+		w = window{end: now.Truncate(length).Add(length)}
+	}
+	w.count++
+	s.windows[key] = w
+
+	return w.count, w.end.Sub(now), nil
+}
+
+func (s *MemoryStore) Count(ctx utils.MyContext, key string, length time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.end) {
+		return 0, now.Truncate(length).Add(length).Sub(now), nil
+	}
+
+	return w.count, w.end.Sub(now), nil
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"sync/atomic"
+	"time"
+
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/utils"
+)
+
+// Repository stores rate limit counters shared by all instances.
+type Repository interface {
+	IncrementRateLimit(ctx utils.MyContext, key string, window time.Duration) (dbmodels.RateLimitCounter, error)
+	GetRateLimit(ctx utils.MyContext, key string, window time.Duration) (dbmodels.RateLimitCounter, error)
+	DeleteExpiredRateLimits(ctx utils.MyContext) (int64, error)
+}
+
+// PostgresStore keeps the counters in Postgres, so that a client is limited
+// across all instances of the app.
+type PostgresStore struct {
+	repo      Repository
+	lastSweep atomic.Int64
+}
+
+func NewPostgresStore(repo Repository) *PostgresStore {
+	return &PostgresStore{repo: repo}
+}
+
+func (s *PostgresStore) Increment(ctx utils.MyContext, key string, window time.Duration) (int64, time.Duration, error) {
+	counter, err := s.repo.IncrementRateLimit(ctx, key, window)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// one request a minute per instance drops the counters of past windows
+	now := time.Now().UnixNano()
+	last := s.lastSweep.Load()
+	if now-last >= int64(sweepInterval) && s.lastSweep.CompareAndSwap(last, now) {
+		if deleted, err := s.repo.DeleteExpiredRateLimits(ctx); err != nil {
+			ctx.Logger.Warnf("failed to delete expired rate limit counters: %v", err)
+		} else if deleted > 0 {
+			ctx.Logger.Debugf("deleted %d expired rate limit counters", deleted)
+		}
+	}
+
+	return counter.Count, time.Duration(counter.ResetSeconds * float64(time.Second)), nil
+}
+
+func (s *PostgresStore) Count(ctx utils.MyContext, key string, window time.Duration) (int64, time.Duration, error) {
+	counter, err := s.repo.GetRateLimit(ctx, key, window)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return counter.Count, time.Duration(counter.ResetSeconds * float64(time.Second)), nil
+}
@@ -0,0 +1,107 @@
+// Package ratelimit limits the requests of each client in fixed time windows,
+// separately for every route class. Counters live in a Store, in memory or
+// shared by all instances through Postgres.
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"effectiveMobileTest/utils"
+)
+
+// Route classes with their own limits. ClassImport covers the requests that
+// fetch song details from the upstream providers. ClassAuthFailure counts the
+// failed authentications of each address, so that credentials cannot be
+// guessed without limit.
+const (
+	ClassRead        = "read"
+	ClassWrite       = "write"
+	ClassImport      = "import"
+	ClassAuthFailure = "auth_failure"
+)
+
+// Limit allows Requests per Window. A zero Requests disables the limit.
+type Limit struct {
+	Requests int64
+	Window   time.Duration
+}
+
+// Store counts the requests of a key in the current window.
+type Store interface {
+	// Increment counts a request and returns the number of requests in the
+	// current window, this one included, and the time until it ends.
+	Increment(ctx utils.MyContext, key string, window time.Duration) (count int64, reset time.Duration, err error)
+	// Count returns the number of requests of a key in the current window
+	// and the time until it ends, without counting a request.
+	Count(ctx utils.MyContext, key string, window time.Duration) (count int64, reset time.Duration, err error)
+}
+
+// Decision is the outcome of a request against its limit.
+type Decision struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	Reset     time.Duration
+}
+
+// Limiter applies the limits of each route class.
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+}
+
+func NewLimiter(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{
+		store:  store,
+		limits: limits,
+	}
+}
+
+// Limit returns the limit of a route class, false when it is not limited.
+func (l *Limiter) Limit(class string) (Limit, bool) {
+	limit, ok := l.limits[class]
+	return limit, ok && limit.Requests > 0 && limit.Window > 0
+}
+
+// Allow counts a request of client in a route class.
+func (l *Limiter) Allow(ctx utils.MyContext, class, client string) (Decision, error) {
+	limit, ok := l.Limit(class)
+	if !ok {
+		return Decision{Allowed: true}, nil
+	}
+
+	count, reset, err := l.store.Increment(ctx, class+":"+client, limit.Window)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to count request: %w", err)
+	}
+
+	return Decision{
+		Allowed:   count <= limit.Requests,
+		Limit:     limit.Requests,
+		Remaining: max(limit.Requests-count, 0),
+		Reset:     reset,
+	}, nil
+}
+
+// Check tells whether client may make another request in a route class,
+// without counting one. It lets a class count only some requests, such as
+// failed ones, after they are made.
+func (l *Limiter) Check(ctx utils.MyContext, class, client string) (Decision, error) {
+	limit, ok := l.Limit(class)
+	if !ok {
+		return Decision{Allowed: true}, nil
+	}
+
+	count, reset, err := l.store.Count(ctx, class+":"+client, limit.Window)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to read request count: %w", err)
+	}
+
+	return Decision{
+		Allowed:   count < limit.Requests,
+		Limit:     limit.Requests,
+		Remaining: max(limit.Requests-count, 0),
+		Reset:     reset,
+	}, nil
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/utils"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	now := time.Date(2026, 10, 19, 12, 0, 40, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limiter := NewLimiter(store, map[string]Limit{
+		ClassWrite:  {Requests: 2, Window: time.Minute},
+		ClassImport: {Requests: 0, Window: time.Minute},
+	})
+
+	for i, want := range []Decision{
+		{Allowed: true, Limit: 2, Remaining: 1, Reset: 20 * time.Second},
+		{Allowed: true, Limit: 2, Remaining: 0, Reset: 20 * time.Second},
+		{Allowed: false, Limit: 2, Remaining: 0, Reset: 20 * time.Second},
+	} {
+		decision, err := limiter.Allow(ctx, ClassWrite, "ip:192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision != want {
+			t.Errorf("request %d: decision = %+v, want %+v", i, decision, want)
+		}
+	}
+
+	if decision, _ := limiter.Allow(ctx, ClassWrite, "ip:192.0.2.2"); !decision.Allowed {
+		t.Error("another client was limited")
+	}
+	if decision, _ := limiter.Allow(ctx, ClassRead, "ip:192.0.2.1"); !decision.Allowed {
+		t.Error("unconfigured class was limited")
+	}
+	if decision, _ := limiter.Allow(ctx, ClassImport, "ip:192.0.2.1"); !decision.Allowed {
+		t.Error("disabled class was limited")
+	}
+
+	// windows are aligned to full minutes
+	now = now.Add(time.Minute)
+	decision, _ := limiter.Allow(ctx, ClassWrite, "ip:192.0.2.1")
+	if !decision.Allowed || decision.Remaining != 1 || decision.Reset != 20*time.Second {
+		t.Errorf("next window: decision = %+v", decision)
+	}
+	if len(store.windows) != 1 {
+		t.Errorf("expired windows were not swept: %d left", len(store.windows))
+	}
+}
+
+func TestLimiterCheck(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	now := time.Date(2026, 10, 19, 12, 0, 40, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limiter := NewLimiter(store, map[string]Limit{ClassAuthFailure: {Requests: 2, Window: time.Minute}})
+
+	for i := 0; i < 2; i++ {
+		decision, err := limiter.Check(ctx, ClassAuthFailure, "ip:192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decision.Allowed || decision.Remaining != int64(2-i) || decision.Reset != 20*time.Second {
+			t.Errorf("check %d: decision = %+v", i, decision)
+		}
+		limiter.Allow(ctx, ClassAuthFailure, "ip:192.0.2.1")
+	}
+
+	if decision, _ := limiter.Check(ctx, ClassAuthFailure, "ip:192.0.2.1"); decision.Allowed {
+		t.Errorf("check after the limit: decision = %+v", decision)
+	}
+	if decision, _ := limiter.Check(ctx, ClassAuthFailure, "ip:192.0.2.1"); decision.Remaining != 0 || store.windows["auth_failure:ip:192.0.2.1"].count != 2 {
+		t.Errorf("checks were counted: decision = %+v", decision)
+	}
+
+	now = now.Add(time.Minute)
+	if decision, _ := limiter.Check(ctx, ClassAuthFailure, "ip:192.0.2.1"); !decision.Allowed {
+		t.Errorf("next window: decision = %+v", decision)
+	}
+}
+
+func TestClientIPOf(t *testing.T) {
+	clientIP, err := NewClientIP([]string{"10.0.0.0/8", "192.0.2.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"direct", "198.51.100.7:4000", "", "198.51.100.7"},
+		{"untrusted proxy is ignored", "198.51.100.7:4000", "203.0.113.5", "198.51.100.7"},
+		{"trusted proxy", "10.1.2.3:4000", "203.0.113.5", "203.0.113.5"},
+		{"spoofed hops are skipped", "10.1.2.3:4000", "1.1.1.1, 203.0.113.5, 192.0.2.10", "203.0.113.5"},
+		{"only proxies", "10.1.2.3:4000", "10.0.0.1", "10.0.0.1"},
+		{"malformed hop", "10.1.2.3:4000", "203.0.113.5, junk", "10.1.2.3"},
+		{"ipv6", "[2001:db8::1]:4000", "", "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/api/songs", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				request.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if got := clientIP.Of(request); got != tt.want {
+				t.Errorf("Of() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewClientIP([]string{"proxy.local"}); err == nil {
+		t.Error("NewClientIP accepted a host name")
+	}
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/utils"
+)
+
+//go:embed sql/CreateAnnotation.sql
+var createAnnotation string
+
+func (r *Postgres) CreateAnnotation(ctx utils.MyContext, annotation dbmodels.Annotation) error {
+	defer observe(ctx, "CreateAnnotation")()
+
+	ctx.Logger.Debugf("executing CreateAnnotation query: id=%s, songId=%s", annotation.Id, annotation.SongId)
+
+	_, err := r.db.ExecContext(ctx.Ctx, createAnnotation, annotation.Id, annotation.SongId, annotation.Verse, annotation.Line,
+		annotation.StartChar, annotation.EndChar, annotation.Quote, annotation.Author, annotation.Body)
+	if err != nil {
+		return dbError("failed to insert annotation", err)
+	}
+
+	ctx.Logger.Infof("annotation inserted successfully id=%s", annotation.Id)
+
+	return nil
+}
+
+//go:embed sql/GetAnnotations.sql
+var getAnnotations string
+
+func (r *Postgres) GetAnnotations(ctx utils.MyContext, songId string) ([]dbmodels.Annotation, error) {
+	defer observe(ctx, "GetAnnotations")()
+
+	ctx.Logger.Debugf("executing GetAnnotations query for song id=%s", songId)
+
+	var annotations []dbmodels.Annotation
+	err := r.db.SelectContext(ctx.Ctx, &annotations, getAnnotations, songId)
+	if err != nil {
+		return nil, dbError("failed to fetch annotations", err)
+	}
+
+	ctx.Logger.Debugf("retrieved %d annotations", len(annotations))
+
+	return annotations, nil
+}
+
+//go:embed sql/GetAnnotation.sql
+var getAnnotation string
+
+func (r *Postgres) GetAnnotation(ctx utils.MyContext, songId, id string) (dbmodels.Annotation, error) {
+	defer observe(ctx, "GetAnnotation")()
+
+	ctx.Logger.Debugf("executing GetAnnotation query for song id=%s, annotation id=%s", songId, id)
+
+	var annotation dbmodels.Annotation
+	err := r.db.GetContext(ctx.Ctx, &annotation, getAnnotation, songId, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodels.Annotation{}, utils.NewNotFoundError(utils.CodeAnnotationNotFound, "annotation with id %s not found", id)
+		}
+		return dbmodels.Annotation{}, dbError("failed to fetch annotation", err)
+	}
+
+	return annotation, nil
+}
+
+//go:embed sql/UpdateAnnotation.sql
+var updateAnnotation string
+
+func (r *Postgres) UpdateAnnotation(ctx utils.MyContext, annotation dbmodels.Annotation) error {
+	defer observe(ctx, "UpdateAnnotation")()
+
+	ctx.Logger.Debugf("executing UpdateAnnotation query for annotation id=%s", annotation.Id)
+
+	result, err := r.db.ExecContext(ctx.Ctx, updateAnnotation, annotation.SongId, annotation.Id, annotation.Author, annotation.Body)
+	if err != nil {
+		return dbError("failed to update annotation", err)
+	}
+
+	if err = checkAffected(result, utils.NewNotFoundError(utils.CodeAnnotationNotFound, "annotation with id %s not found", annotation.Id)); err != nil {
+		return err
+	}
+
+	ctx.Logger.Infof("annotation updated successfully id=%s", annotation.Id)
+
+	return nil
+}
+
+// Reanchor returns the annotations of a song whose anchors change with its
+// new lyrics.
+type Reanchor func(annotations []dbmodels.Annotation) []dbmodels.Annotation
+
+//go:embed sql/GetAnnotationsForUpdate.sql
+var getAnnotationsForUpdate string
+
+//go:embed sql/UpdateAnnotationAnchor.sql
+var updateAnnotationAnchor string
+
+// reanchorAnnotations moves the annotations of a song within the transaction
+// that changes its lyrics, so that they never point into the old text.
+func reanchorAnnotations(ctx utils.MyContext, tx *sqlx.Tx, songId string, reanchor Reanchor) error {
+	if reanchor == nil {
+		return nil
+	}
+
+	var annotations []dbmodels.Annotation
+	if err := tx.SelectContext(ctx.Ctx, &annotations, getAnnotationsForUpdate, songId); err != nil {
+		return dbError("failed to fetch annotations", err)
+	}
+
+	changed := reanchor(annotations)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	ctx.Logger.Debugf("reanchoring %d annotations of song id=%s", len(changed), songId)
+
+	for _, annotation := range changed {
+		_, err := tx.ExecContext(ctx.Ctx, updateAnnotationAnchor, annotation.Id, annotation.Verse, annotation.Line,
+			annotation.StartChar, annotation.EndChar, annotation.Quote, annotation.Orphaned)
+		if err != nil {
+			return dbError("failed to update annotation anchor", err)
+		}
+	}
+
+	return nil
+}
+
+//go:embed sql/DeleteAnnotation.sql
+var deleteAnnotation string
+
+func (r *Postgres) DeleteAnnotation(ctx utils.MyContext, songId, id string) error {
+	defer observe(ctx, "DeleteAnnotation")()
+
+	ctx.Logger.Debugf("executing DeleteAnnotation query for annotation id=%s", id)
+
+	result, err := r.db.ExecContext(ctx.Ctx, deleteAnnotation, songId, id)
+	if err != nil {
+		return dbError("failed to delete annotation", err)
+	}
+
+	if err = checkAffected(result, utils.NewNotFoundError(utils.CodeAnnotationNotFound, "annotation with id %s not found", id)); err != nil {
+		return err
+	}
+
+	ctx.Logger.Infof("annotation deleted successfully id=%s", id)
+
+	return nil
+}
+
+func checkAffected(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return dbError("failed to get affected rows", err)
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/utils"
+)
+
+//go:embed sql/CreateAPIKey.sql
+var createAPIKey string
+
+// CreateAPIKey stores a new API key and returns it with its creation time.
+func (r *Postgres) CreateAPIKey(ctx utils.MyContext, key dbmodels.APIKey) (dbmodels.APIKey, error) {
+	defer observe(ctx, "CreateAPIKey")()
+
+	ctx.Logger.Debugf("executing CreateAPIKey query: id=%s, name=%s, scopes=%v", key.Id, key.Name, key.Scopes)
+
+	err := r.db.QueryRowContext(ctx.Ctx, createAPIKey, key.Id, key.Name, key.Prefix, key.Hash, key.Scopes, key.ExpiresAt).
+		Scan(&key.CreatedAt)
+	if err != nil {
+		return dbmodels.APIKey{}, dbError("failed to insert API key", err)
+	}
+
+	ctx.Logger.Infof("API key created id=%s", key.Id)
+
+	return key, nil
+}
+
+//go:embed sql/GetAPIKeys.sql
+var getAPIKeys string
+
+// GetAPIKeys returns every API key, revoked and expired ones included, newest
+// first. Key hashes are not loaded.
+func (r *Postgres) GetAPIKeys(ctx utils.MyContext) ([]dbmodels.APIKey, error) {
+	defer observe(ctx, "GetAPIKeys")()
+
+	var keys []dbmodels.APIKey
+	if err := r.db.SelectContext(ctx.Ctx, &keys, getAPIKeys); err != nil {
+		return nil, dbError("failed to get API keys", err)
+	}
+
+	ctx.Logger.Debugf("retrieved %d API keys", len(keys))
+
+	return keys, nil
+}
+
+//go:embed sql/GetAPIKeyByHash.sql
+var getAPIKeyByHash string
+
+// GetAPIKeyByHash returns the API key with the given hash. found is false when
+// there is none.
+func (r *Postgres) GetAPIKeyByHash(ctx utils.MyContext, hash string) (key dbmodels.APIKey, found bool, err error) {
+	defer observe(ctx, "GetAPIKeyByHash")()
+
+	err = r.db.GetContext(ctx.Ctx, &key, getAPIKeyByHash, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbmodels.APIKey{}, false, nil
+	}
+	if err != nil {
+		return dbmodels.APIKey{}, false, dbError("failed to get API key", err)
+	}
+
+	return key, true, nil
+}
+
+//go:embed sql/RevokeAPIKey.sql
+var revokeAPIKey string
+
+// RevokeAPIKey marks an API key revoked. Revoking a revoked key keeps the time
+// it was first revoked.
+func (r *Postgres) RevokeAPIKey(ctx utils.MyContext, id string) error {
+	defer observe(ctx, "RevokeAPIKey")()
+
+	ctx.Logger.Debugf("executing RevokeAPIKey query for API key id=%s", id)
+
+	result, err := r.db.ExecContext(ctx.Ctx, revokeAPIKey, id)
+	if err != nil {
+		return dbError("failed to revoke API key", err)
+	}
+
+	if err = checkAffected(result, utils.NewNotFoundError(utils.CodeAPIKeyNotFound, "API key with id %s not found", id)); err != nil {
+		return err
+	}
+
+	ctx.Logger.Infof("API key revoked id=%s", id)
+
+	return nil
+}
+
+//go:embed sql/TouchAPIKey.sql
+var touchAPIKey string
+
+// TouchAPIKey records that an API key was just used.
+func (r *Postgres) TouchAPIKey(ctx utils.MyContext, id string) error {
+	defer observe(ctx, "TouchAPIKey")()
+
+	if _, err := r.db.ExecContext(ctx.Ctx, touchAPIKey, id); err != nil {
+		return dbError("failed to update API key last use", err)
+	}
+
+	return nil
+}
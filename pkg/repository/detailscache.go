@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"time"
+
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/utils"
+)
+
+//go:embed sql/GetDetailsCache.sql
+var getDetailsCache string
+
+// GetDetailsCache returns the unexpired cache entry for a normalized group and
+// title. The second result is false on a cache miss.
+func (r *Postgres) GetDetailsCache(ctx utils.MyContext, groupKey, titleKey string) (dbmodels.DetailsCacheEntry, bool, error) {
+	defer observe(ctx, "GetDetailsCache")()
+
+	ctx.Logger.Debugf("executing GetDetailsCache query for group=%s, title=%s", groupKey, titleKey)
+
+	var entry dbmodels.DetailsCacheEntry
+	err := r.db.GetContext(ctx.Ctx, &entry, getDetailsCache, groupKey, titleKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodels.DetailsCacheEntry{}, false, nil
+		}
+		return dbmodels.DetailsCacheEntry{}, false, dbError("failed to get details cache entry", err)
+	}
+
+	return entry, true, nil
+}
+
+//go:embed sql/PutDetailsCache.sql
+var putDetailsCache string
+
+// PutDetailsCache stores a cache entry that expires after ttl, replacing the
+// previous entry for the same group and title.
+func (r *Postgres) PutDetailsCache(ctx utils.MyContext, entry dbmodels.DetailsCacheEntry, ttl time.Duration) error {
+	defer observe(ctx, "PutDetailsCache")()
+
+	ctx.Logger.Debugf("executing PutDetailsCache query for group=%s, title=%s", entry.GroupKey, entry.TitleKey)
+
+	_, err := r.db.ExecContext(ctx.Ctx, putDetailsCache, entry.GroupKey, entry.TitleKey, entry.ReleaseDate,
+		entry.Text, entry.Link, entry.DetailsSources, entry.NotFound, ttl.Seconds())
+	if err != nil {
+		return dbError("failed to put details cache entry", err)
+	}
+
+	return nil
+}
+
+//go:embed sql/DeleteExpiredDetailsCache.sql
+var deleteExpiredDetailsCache string
+
+// DeleteExpiredDetailsCache removes expired cache entries and returns their number.
+func (r *Postgres) DeleteExpiredDetailsCache(ctx utils.MyContext) (int64, error) {
+	defer observe(ctx, "DeleteExpiredDetailsCache")()
+
+	result, err := r.db.ExecContext(ctx.Ctx, deleteExpiredDetailsCache)
+	if err != nil {
+		return 0, dbError("failed to delete expired details cache entries", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, dbError("failed to get affected rows", err)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/utils"
+)
+
+//go:embed sql/CreateEnrichmentJob.sql
+var createEnrichmentJob string
+
+//go:embed sql/UpdateEnrichmentStatus.sql
+var updateEnrichmentStatus string
+
+// QueueEnrichment marks a song as pending and schedules an enrichment job for it.
+func (r *Postgres) QueueEnrichment(ctx utils.MyContext, songId string) error {
+	defer observe(ctx, "QueueEnrichment")()
+
+	ctx.Logger.Debugf("queueing enrichment job for song id=%s", songId)
+
+	tx, err := r.db.BeginTxx(ctx.Ctx, nil)
+	if err != nil {
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx.Ctx, updateEnrichmentStatus, songId, "pending", "")
+	if err != nil {
+		return dbError("failed to update enrichment status", err)
+	}
+
+	if err = checkAffected(result, utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", songId)); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx.Ctx, createEnrichmentJob, songId); err != nil {
+		return dbError("failed to insert enrichment job", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
+	}
+
+	return nil
+}
+
+//go:embed sql/ClaimEnrichmentJob.sql
+var claimEnrichmentJob string
+
+// ClaimEnrichmentJob locks the next due enrichment job for the lease duration.
+// A job whose worker died before finishing becomes due again once the lease
+// expires. The second result is false when there is no due job.
+func (r *Postgres) ClaimEnrichmentJob(ctx utils.MyContext, lease time.Duration) (dbmodels.EnrichmentJob, bool, error) {
+	defer observe(ctx, "ClaimEnrichmentJob")()
+
+	var job dbmodels.EnrichmentJob
+	err := r.db.GetContext(ctx.Ctx, &job, claimEnrichmentJob, lease.Seconds())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodels.EnrichmentJob{}, false, nil
+		}
+		return dbmodels.EnrichmentJob{}, false, dbError("failed to claim enrichment job", err)
+	}
+
+	ctx.Logger.Debugf("claimed enrichment job for song id=%s, attempt %d", job.SongId, job.Attempts)
+
+	return job, true, nil
+}
+
+//go:embed sql/CompleteEnrichment.sql
+var completeEnrichment string
+
+//go:embed sql/DeleteEnrichmentJob.sql
+var deleteEnrichmentJob string
+
+// CompleteEnrichment stores fetched song details, moves the annotations with
+// reanchor, marks the song enriched and removes its enrichment job. The song is
+// only updated while it still matches read, the song the details were fetched
+// for, so that an edit made during the fetch is not overwritten.
+func (r *Postgres) CompleteEnrichment(ctx utils.MyContext, read, song dbmodels.Song, reanchor Reanchor) error {
+	defer observe(ctx, "CompleteEnrichment")()
+
+	ctx.Logger.Debugf("executing CompleteEnrichment query for song id=%s", song.Id)
+
+	tx, err := r.db.BeginTxx(ctx.Ctx, nil)
+	if err != nil {
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx.Ctx, completeEnrichment, song.Id, song.ReleaseDate, song.Text, song.Link,
+		song.TextSearch, song.DetailsSources, song.EnrichedDetails,
+		read.Group, read.Title, read.ReleaseDate, read.Text, read.Link)
+	if err != nil {
+		return dbError("failed to update song details", err)
+	}
+
+	if err = checkAffected(result, errSongChanged); err != nil {
+		return songChangedError(ctx, tx, song.Id, err)
+	}
+
+	if err = addLyricsRevision(ctx, tx, song.Id, song.Text); err != nil {
+		return err
+	}
+
+	if err = reanchorAnnotations(ctx, tx, song.Id, reanchor); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx.Ctx, deleteEnrichmentJob, song.Id); err != nil {
+		return dbError("failed to delete enrichment job", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
+	}
+
+	ctx.Logger.Infof("song enriched successfully id=%s", song.Id)
+
+	return nil
+}
+
+// errSongChanged marks a guarded update of fetched details that matched no row.
+var errSongChanged = errors.New("song changed")
+
+// songChangedError tells apart the reasons a guarded update of fetched details
+// changed nothing: the song was deleted, or it was edited after being read.
+func songChangedError(ctx utils.MyContext, tx *sqlx.Tx, songId string, err error) error {
+	if !errors.Is(err, errSongChanged) {
+		return err
+	}
+
+	var exists bool
+	if err = tx.QueryRowContext(ctx.Ctx, "SELECT EXISTS(SELECT 1 FROM songs WHERE id = $1)", songId).Scan(&exists); err != nil {
+		return dbError("failed to check if song exists", err)
+	}
+
+	if !exists {
+		return utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", songId)
+	}
+
+	return utils.NewConflictError(utils.CodeConflict,
+		fmt.Sprintf("song with id %s was changed while its details were fetched", songId), errSongChanged)
+}
+
+//go:embed sql/PostponeEnrichmentJob.sql
+var postponeEnrichmentJob string
+
+// PostponeEnrichment keeps the song pending with the last error and makes its
+// job due again after delay.
+func (r *Postgres) PostponeEnrichment(ctx utils.MyContext, songId, lastError string, delay time.Duration) error {
+	defer observe(ctx, "PostponeEnrichment")()
+
+	ctx.Logger.Debugf("postponing enrichment job for song id=%s by %s", songId, delay)
+
+	tx, err := r.db.BeginTxx(ctx.Ctx, nil)
+	if err != nil {
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx.Ctx, updateEnrichmentStatus, songId, "pending", lastError); err != nil {
+		return dbError("failed to update enrichment status", err)
+	}
+
+	if _, err = tx.ExecContext(ctx.Ctx, postponeEnrichmentJob, songId, delay.Seconds()); err != nil {
+		return dbError("failed to postpone enrichment job", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
+	}
+
+	return nil
+}
+
+// FailEnrichment marks the song as failed with the last error and removes its
+// enrichment job.
+func (r *Postgres) FailEnrichment(ctx utils.MyContext, songId, lastError string) error {
+	defer observe(ctx, "FailEnrichment")()
+
+	ctx.Logger.Debugf("failing enrichment of song id=%s", songId)
+
+	tx, err := r.db.BeginTxx(ctx.Ctx, nil)
+	if err != nil {
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx.Ctx, updateEnrichmentStatus, songId, "failed", lastError); err != nil {
+		return dbError("failed to update enrichment status", err)
+	}
+
+	if _, err = tx.ExecContext(ctx.Ctx, deleteEnrichmentJob, songId); err != nil {
+		return dbError("failed to delete enrichment job", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
+	}
+
+	return nil
+}
+
+// GetSongsForRefresh returns enriched songs matching the filter, those enriched
+// longest ago first. Songs never refreshed since the enrichment snapshot was
+// introduced come before all others.
+func (r *Postgres) GetSongsForRefresh(ctx utils.MyContext, filter dbmodels.RefreshFilter) ([]dbmodels.Song, error) {
+	defer observe(ctx, "GetSongsForRefresh")()
+
+	ctx.Logger.Debugf("executing GetSongsForRefresh query with filter: %+v", filter)
+
+	var (
+		query strings.Builder
+		args  []interface{}
+	)
+	query.WriteString("SELECT * FROM songs WHERE enrichment_status = 'enriched'")
+
+	if len(filter.Ids) > 0 {
+		args = append(args, pq.Array(filter.Ids))
+		query.WriteString(fmt.Sprintf(" AND id = ANY($%d::uuid[])", len(args)))
+	}
+	if filter.Group != "" {
+		args = append(args, containsPattern(filter.Group), pq.Array(containsPatterns(filter.GroupKeys)))
+		query.WriteString(fmt.Sprintf(" AND (group_name ILIKE $%d OR group_search ILIKE ANY($%d))", len(args)-1, len(args)))
+	}
+	if filter.Title != "" {
+		args = append(args, containsPattern(filter.Title), pq.Array(containsPatterns(filter.TitleKeys)))
+		query.WriteString(fmt.Sprintf(" AND (title ILIKE $%d OR title_search ILIKE ANY($%d))", len(args)-1, len(args)))
+	}
+	if !filter.EnrichedBefore.IsZero() {
+		args = append(args, filter.EnrichedBefore)
+		query.WriteString(fmt.Sprintf(" AND (enriched_at IS NULL OR enriched_at < $%d)", len(args)))
+	}
+
+	query.WriteString(fmt.Sprintf(" ORDER BY enriched_at NULLS FIRST LIMIT %d", filter.Limit))
+
+	var songs []dbmodels.Song
+	if err := r.db.SelectContext(ctx.Ctx, &songs, query.String(), args...); err != nil {
+		return nil, dbError("failed to get songs for refresh", err)
+	}
+
+	ctx.Logger.Debugf("retrieved %d songs for refresh", len(songs))
+
+	return songs, nil
+}
+
+//go:embed sql/RefreshSong.sql
+var refreshSong string
+
+// RefreshSong stores re-fetched song details along with the new enrichment
+// snapshot. When newRevision is set, a lyrics revision is added and the
+// annotations are moved with reanchor. Like CompleteEnrichment, it only updates
+// the song while it still matches read.
+func (r *Postgres) RefreshSong(ctx utils.MyContext, read, song dbmodels.Song, newRevision bool, reanchor Reanchor) error {
+	defer observe(ctx, "RefreshSong")()
+
+	ctx.Logger.Debugf("executing RefreshSong query for song id=%s", song.Id)
+
+	tx, err := r.db.BeginTxx(ctx.Ctx, nil)
+	if err != nil {
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx.Ctx, refreshSong, song.Id, song.ReleaseDate, song.Text, song.Link,
+		song.TextSearch, song.DetailsSources, song.EnrichedDetails,
+		read.Group, read.Title, read.ReleaseDate, read.Text, read.Link)
+	if err != nil {
+		return dbError("failed to refresh song details", err)
+	}
+
+	if err = checkAffected(result, errSongChanged); err != nil {
+		return songChangedError(ctx, tx, song.Id, err)
+	}
+
+	if newRevision {
+		if err = addLyricsRevision(ctx, tx, song.Id, song.Text); err != nil {
+			return err
+		}
+
+		if err = reanchorAnnotations(ctx, tx, song.Id, reanchor); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
+	}
+
+	return nil
+}
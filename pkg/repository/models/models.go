@@ -1,22 +1,198 @@
 package dbmodels
 
-import "time"
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
 
 type Song struct {
-	Id          string    `db:"id"`
-	Group       string    `db:"group_name"`
-	Title       string    `db:"title"`
-	ReleaseDate time.Time `db:"release_date"`
-	Text        string    `db:"text"`
-	Link        string    `db:"link"`
+	Id               string          `db:"id"`
+	Group            string          `db:"group_name"`
+	Title            string          `db:"title"`
+	ReleaseDate      sql.NullTime    `db:"release_date"`
+	Text             string          `db:"text"`
+	Link             string          `db:"link"`
+	GroupSearch      string          `db:"group_search"`
+	TitleSearch      string          `db:"title_search"`
+	TextSearch       string          `db:"text_search"`
+	DetailsSources   DetailsSources  `db:"details_sources"`
+	EnrichmentStatus string          `db:"enrichment_status"`
+	EnrichmentError  string          `db:"enrichment_error"`
+	EnrichedDetails  EnrichedDetails `db:"enriched_details"`
+	EnrichedAt       *time.Time      `db:"enriched_at"`
+}
+
+// DetailsSources maps song details fields to the name of the provider that
+// supplied them. It is stored as a JSONB object.
+type DetailsSources map[string]string
+
+func (s DetailsSources) Value() (driver.Value, error) {
+	if s == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(s)
+}
+
+func (s *DetailsSources) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*s = nil
+		return nil
+	default:
+		return fmt.Errorf("unsupported type for details sources: %T", src)
+	}
+
+	return json.Unmarshal(data, s)
+}
+
+// DetailsCacheEntry is a cached answer of the details providers for a
+// normalized group and title. NotFound entries record that no provider knows
+// the song.
+type DetailsCacheEntry struct {
+	GroupKey       string         `db:"group_key"`
+	TitleKey       string         `db:"title_key"`
+	ReleaseDate    string         `db:"release_date"`
+	Text           string         `db:"text"`
+	Link           string         `db:"link"`
+	DetailsSources DetailsSources `db:"details_sources"`
+	NotFound       bool           `db:"not_found"`
+	ExpiresAt      time.Time      `db:"expires_at"`
+}
+
+// EnrichedDetails keeps the song details as they were last fetched from the
+// providers. A song field that differs from its fetched value was edited
+// manually. It is stored as a JSONB object, the release date as YYYY-MM-DD.
+type EnrichedDetails struct {
+	ReleaseDate string `json:"releaseDate"`
+	Text        string `json:"text"`
+	Link        string `json:"link"`
+}
+
+func (d EnrichedDetails) Value() (driver.Value, error) {
+	return json.Marshal(d)
+}
+
+func (d *EnrichedDetails) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*d = EnrichedDetails{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported type for enriched details: %T", src)
+	}
+
+	return json.Unmarshal(data, d)
+}
+
+// RefreshFilter selects enriched songs whose details should be fetched again.
+// Songs enriched at or after EnrichedBefore are left out unless it is zero.
+type RefreshFilter struct {
+	Ids            []string
+	Group          string
+	Title          string
+	GroupKeys      []string
+	TitleKeys      []string
+	EnrichedBefore time.Time
+	Limit          int
 }
 
 type SongFilter struct {
 	Group       string    `db:"group_name"`
 	Title       string    `db:"title"`
+	GroupKeys   []string  `db:"group_search"`
+	TitleKeys   []string  `db:"title_search"`
 	ReleaseDate time.Time `db:"release_date"`
 	Text        string    `db:"text"`
 	Link        string    `db:"link"`
 	Page        int       `db:"page"`
 	Limit       int       `db:"limit"`
 }
+
+type LyricsRevision struct {
+	SongId    string    `db:"song_id"`
+	Revision  int       `db:"revision"`
+	Text      string    `db:"text"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type LyricsLookupFilter struct {
+	Phrase string `db:"text_search"`
+	Page   int    `db:"page"`
+	Limit  int    `db:"limit"`
+}
+
+type Annotation struct {
+	Id        string    `db:"id"`
+	SongId    string    `db:"song_id"`
+	Verse     int       `db:"verse"`
+	Line      int       `db:"line"`
+	StartChar int       `db:"start_char"`
+	EndChar   int       `db:"end_char"`
+	Quote     string    `db:"quote"`
+	Author    string    `db:"author"`
+	Body      string    `db:"body"`
+	Orphaned  bool      `db:"orphaned"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type EnrichmentJob struct {
+	SongId   string `db:"song_id"`
+	Attempts int    `db:"attempts"`
+}
+
+type DetailsRepair struct {
+	Provider  string    `db:"provider"`
+	Group     string    `db:"group_name"`
+	Title     string    `db:"title"`
+	Field     string    `db:"field"`
+	Action    string    `db:"action"`
+	Reason    string    `db:"reason"`
+	Original  string    `db:"original"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type DetailsRepairFilter struct {
+	Provider string `db:"provider"`
+	Limit    int    `db:"limit"`
+}
+
+type SongStats struct {
+	Total   int64 `db:"total"`
+	Pending int64 `db:"pending"`
+}
+
+// APIKey is an API key. Only the SHA-256 hash of the key is stored, the
+// prefix is kept to tell keys apart.
+type APIKey struct {
+	Id         string         `db:"id"`
+	Name       string         `db:"name"`
+	Prefix     string         `db:"prefix"`
+	Hash       string         `db:"key_hash"`
+	Scopes     pq.StringArray `db:"scopes"`
+	ExpiresAt  *time.Time     `db:"expires_at"`
+	LastUsedAt *time.Time     `db:"last_used_at"`
+	RevokedAt  *time.Time     `db:"revoked_at"`
+	CreatedAt  time.Time      `db:"created_at"`
+}
+
+// RateLimitCounter is the number of requests of a client in the current rate
+// limit window and the seconds until the window ends.
+type RateLimitCounter struct {
+	Count        int64   `db:"count"`
+	ResetSeconds float64 `db:"reset_seconds"`
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	_ "embed"
+	"time"
+
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/utils"
+)
+
+//go:embed sql/IncrementRateLimit.sql
+var incrementRateLimit string
+
+// IncrementRateLimit counts a request of key in the current window. Windows
+// are aligned to multiples of their length on the database clock, so that all
+// instances share them.
+func (r *Postgres) IncrementRateLimit(ctx utils.MyContext, key string, window time.Duration) (dbmodels.RateLimitCounter, error) {
+	defer observe(ctx, "IncrementRateLimit")()
+
+	var counter dbmodels.RateLimitCounter
+	if err := r.db.GetContext(ctx.Ctx, &counter, incrementRateLimit, key, window.Seconds()); err != nil {
+		return dbmodels.RateLimitCounter{}, dbError("failed to increment rate limit counter", err)
+	}
+
+	return counter, nil
+}
+
+//go:embed sql/GetRateLimit.sql
+var getRateLimit string
+
+// GetRateLimit returns the count of key in the current window, zero when it
+// has none, without counting a request.
+func (r *Postgres) GetRateLimit(ctx utils.MyContext, key string, window time.Duration) (dbmodels.RateLimitCounter, error) {
+	defer observe(ctx, "GetRateLimit")()
+
+	var counter dbmodels.RateLimitCounter
+	if err := r.db.GetContext(ctx.Ctx, &counter, getRateLimit, key, window.Seconds()); err != nil {
+		return dbmodels.RateLimitCounter{}, dbError("failed to get rate limit counter", err)
+	}
+
+	return counter, nil
+}
+
+//go:embed sql/DeleteExpiredRateLimits.sql
+var deleteExpiredRateLimits string
+
+// DeleteExpiredRateLimits removes the counters of past windows and returns
+// their number.
+func (r *Postgres) DeleteExpiredRateLimits(ctx utils.MyContext) (int64, error) {
+	defer observe(ctx, "DeleteExpiredRateLimits")()
+
+	result, err := r.db.ExecContext(ctx.Ctx, deleteExpiredRateLimits)
+	if err != nil {
+		return 0, dbError("failed to delete expired rate limit counters", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, dbError("failed to get affected rows", err)
+	}
+
+	return deleted, nil
+}
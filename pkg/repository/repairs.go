@@ -0,0 +1,57 @@
+package repository
+
+import (
+	_ "embed"
+
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/utils"
+)
+
+//go:embed sql/CreateDetailsRepair.sql
+var createDetailsRepair string
+
+// CreateDetailsRepairs records the song details fields repaired or rejected
+// during normalization.
+func (r *Postgres) CreateDetailsRepairs(ctx utils.MyContext, repairs []dbmodels.DetailsRepair) error {
+	defer observe(ctx, "CreateDetailsRepairs")()
+
+	ctx.Logger.Debugf("inserting %d details repairs", len(repairs))
+
+	tx, err := r.db.BeginTxx(ctx.Ctx, nil)
+	if err != nil {
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	for _, repair := range repairs {
+		_, err = tx.ExecContext(ctx.Ctx, createDetailsRepair, repair.Provider, repair.Group, repair.Title,
+			repair.Field, repair.Action, repair.Reason, repair.Original)
+		if err != nil {
+			return dbError("failed to insert details repair", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
+	}
+
+	return nil
+}
+
+//go:embed sql/GetDetailsRepairs.sql
+var getDetailsRepairs string
+
+// GetDetailsRepairs returns the latest details repairs, newest first. An empty
+// provider matches every provider.
+func (r *Postgres) GetDetailsRepairs(ctx utils.MyContext, filter dbmodels.DetailsRepairFilter) ([]dbmodels.DetailsRepair, error) {
+	defer observe(ctx, "GetDetailsRepairs")()
+
+	var repairs []dbmodels.DetailsRepair
+	if err := r.db.SelectContext(ctx.Ctx, &repairs, getDetailsRepairs, filter.Provider, filter.Limit); err != nil {
+		return nil, dbError("failed to get details repairs", err)
+	}
+
+	ctx.Logger.Debugf("retrieved %d details repairs", len(repairs))
+
+	return repairs, nil
+}
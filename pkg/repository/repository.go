@@ -5,11 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"database/sql"
+	"effectiveMobileTest/pkg/metrics"
 	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/pkg/tracing"
 	"effectiveMobileTest/utils"
 )
 
@@ -17,8 +23,41 @@ type Repository interface {
 	Create(ctx utils.MyContext, song dbmodels.Song) error
 	GetSongs(ctx utils.MyContext, filter dbmodels.SongFilter) ([]dbmodels.Song, error)
 	GetLyrics(ctx utils.MyContext, id string) (string, error)
-	Update(ctx utils.MyContext, input dbmodels.Song) error
+	Update(ctx utils.MyContext, input dbmodels.Song, reanchor Reanchor) error
 	Delete(ctx utils.MyContext, id string) error
+	GetSongsWithoutSearchKeys(ctx utils.MyContext) ([]dbmodels.Song, error)
+	UpdateSearchKeys(ctx utils.MyContext, song dbmodels.Song) error
+	GetLyricsRevisions(ctx utils.MyContext, songId string) ([]dbmodels.LyricsRevision, error)
+	GetLyricsRevision(ctx utils.MyContext, songId string, revision int) (dbmodels.LyricsRevision, error)
+	LookupLyrics(ctx utils.MyContext, filter dbmodels.LyricsLookupFilter) ([]dbmodels.Song, error)
+	GetSong(ctx utils.MyContext, id string) (dbmodels.Song, error)
+	GetSongsForIndex(ctx utils.MyContext) ([]dbmodels.Song, error)
+	CreateAnnotation(ctx utils.MyContext, annotation dbmodels.Annotation) error
+	GetAnnotations(ctx utils.MyContext, songId string) ([]dbmodels.Annotation, error)
+	GetAnnotation(ctx utils.MyContext, songId, id string) (dbmodels.Annotation, error)
+	UpdateAnnotation(ctx utils.MyContext, annotation dbmodels.Annotation) error
+	DeleteAnnotation(ctx utils.MyContext, songId, id string) error
+	QueueEnrichment(ctx utils.MyContext, songId string) error
+	ClaimEnrichmentJob(ctx utils.MyContext, lease time.Duration) (dbmodels.EnrichmentJob, bool, error)
+	CompleteEnrichment(ctx utils.MyContext, read, song dbmodels.Song, reanchor Reanchor) error
+	PostponeEnrichment(ctx utils.MyContext, songId, lastError string, delay time.Duration) error
+	FailEnrichment(ctx utils.MyContext, songId, lastError string) error
+	GetDetailsCache(ctx utils.MyContext, groupKey, titleKey string) (dbmodels.DetailsCacheEntry, bool, error)
+	PutDetailsCache(ctx utils.MyContext, entry dbmodels.DetailsCacheEntry, ttl time.Duration) error
+	DeleteExpiredDetailsCache(ctx utils.MyContext) (int64, error)
+	GetSongsForRefresh(ctx utils.MyContext, filter dbmodels.RefreshFilter) ([]dbmodels.Song, error)
+	RefreshSong(ctx utils.MyContext, read, song dbmodels.Song, newRevision bool, reanchor Reanchor) error
+	CountSongs(ctx utils.MyContext) (dbmodels.SongStats, error)
+	CreateDetailsRepairs(ctx utils.MyContext, repairs []dbmodels.DetailsRepair) error
+	GetDetailsRepairs(ctx utils.MyContext, filter dbmodels.DetailsRepairFilter) ([]dbmodels.DetailsRepair, error)
+	CreateAPIKey(ctx utils.MyContext, key dbmodels.APIKey) (dbmodels.APIKey, error)
+	GetAPIKeys(ctx utils.MyContext) ([]dbmodels.APIKey, error)
+	GetAPIKeyByHash(ctx utils.MyContext, hash string) (dbmodels.APIKey, bool, error)
+	RevokeAPIKey(ctx utils.MyContext, id string) error
+	TouchAPIKey(ctx utils.MyContext, id string) error
+	IncrementRateLimit(ctx utils.MyContext, key string, window time.Duration) (dbmodels.RateLimitCounter, error)
+	GetRateLimit(ctx utils.MyContext, key string, window time.Duration) (dbmodels.RateLimitCounter, error)
+	DeleteExpiredRateLimits(ctx utils.MyContext) (int64, error)
 }
 
 type Postgres struct {
@@ -32,12 +71,57 @@ func NewPostgres(db *sqlx.DB) *Postgres {
 //go:embed sql/CreateSong.sql
 var createSong string
 
+//go:embed sql/CreateLyricsRevision.sql
+var createLyricsRevision string
+
+//go:embed sql/LockSong.sql
+var lockSong string
+
+// addLyricsRevision stores text as the next lyrics revision of a song. The song
+// row is locked first, in its own statement, so that concurrent writers number
+// their revisions one after another instead of computing the same one.
+func addLyricsRevision(ctx utils.MyContext, tx *sqlx.Tx, songId, text string) error {
+	if _, err := tx.ExecContext(ctx.Ctx, lockSong, songId); err != nil {
+		return dbError("failed to lock song", err)
+	}
+
+	if _, err := tx.ExecContext(ctx.Ctx, createLyricsRevision, songId, text); err != nil {
+		return dbError("failed to insert lyrics revision", err)
+	}
+
+	return nil
+}
+
 func (r *Postgres) Create(ctx utils.MyContext, song dbmodels.Song) error {
+	defer observe(ctx, "Create")()
+
 	ctx.Logger.Debugf("executing CreateSong query: id=%s, group=%s, title=%s", song.Id, song.Group, song.Title)
 
-	_, err := r.db.ExecContext(ctx.Ctx, createSong, song.Id, song.Group, song.Title, song.ReleaseDate, song.Text, song.Link)
+	tx, err := r.db.BeginTxx(ctx.Ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to insert song: %w", err)
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx.Ctx, createSong, song.Id, song.Group, song.Title, song.ReleaseDate, song.Text, song.Link,
+		song.GroupSearch, song.TitleSearch, song.TextSearch, song.DetailsSources, song.EnrichmentStatus, song.EnrichedDetails,
+		song.EnrichmentError)
+	if err != nil {
+		return dbError("failed to insert song", err)
+	}
+
+	if song.EnrichmentStatus == "pending" {
+		if _, err = tx.ExecContext(ctx.Ctx, createEnrichmentJob, song.Id); err != nil {
+			return dbError("failed to insert enrichment job", err)
+		}
+	}
+
+	if err = addLyricsRevision(ctx, tx, song.Id, song.Text); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
 	}
 
 	ctx.Logger.Infof("song inserted successfully id=%s", song.Id)
@@ -46,33 +130,50 @@ func (r *Postgres) Create(ctx utils.MyContext, song dbmodels.Song) error {
 }
 
 func (r *Postgres) GetSongs(ctx utils.MyContext, filter dbmodels.SongFilter) ([]dbmodels.Song, error) {
+	defer observe(ctx, "GetSongs")()
+
 	ctx.Logger.Debugf("executing GetSongs query with filter: %+v", filter)
 
-	var query strings.Builder
+	var (
+		query   strings.Builder
+		orderBy []string
+		args    []interface{}
+	)
 	query.WriteString("SELECT * FROM songs WHERE 1=1")
 
 	if filter.Group != "" {
-		query.WriteString(" AND group_name ILIKE '%" + filter.Group + "%'")
+		args = append(args, containsPattern(filter.Group), pq.Array(containsPatterns(filter.GroupKeys)))
+		query.WriteString(fmt.Sprintf(" AND (group_name ILIKE $%d OR group_search ILIKE ANY($%d))", len(args)-1, len(args)))
+		orderBy = append(orderBy, fmt.Sprintf("group_name ILIKE $%d DESC", len(args)-1))
 	}
 	if filter.Title != "" {
-		query.WriteString(" AND title ILIKE '%" + filter.Title + "%'")
+		args = append(args, containsPattern(filter.Title), pq.Array(containsPatterns(filter.TitleKeys)))
+		query.WriteString(fmt.Sprintf(" AND (title ILIKE $%d OR title_search ILIKE ANY($%d))", len(args)-1, len(args)))
+		orderBy = append(orderBy, fmt.Sprintf("title ILIKE $%d DESC", len(args)-1))
 	}
 	if !filter.ReleaseDate.IsZero() {
-		formattedDate := filter.ReleaseDate.Format("2006-01-02")
-		query.WriteString(" AND release_date = '" + formattedDate + "'")
+		args = append(args, filter.ReleaseDate.Format("2006-01-02"))
+		query.WriteString(fmt.Sprintf(" AND release_date = $%d", len(args)))
 	}
 	if filter.Text != "" {
-		query.WriteString(" AND text ILIKE '%" + filter.Text + "%'")
+		args = append(args, containsPattern(filter.Text))
+		query.WriteString(fmt.Sprintf(" AND text ILIKE $%d", len(args)))
 	}
 	if filter.Link != "" {
-		query.WriteString(" AND link ILIKE '%" + filter.Link + "%'")
+		args = append(args, containsPattern(filter.Link))
+		query.WriteString(fmt.Sprintf(" AND link ILIKE $%d", len(args)))
+	}
+
+	// songs matching the original spelling go before transliterated matches
+	if len(orderBy) > 0 {
+		query.WriteString(" ORDER BY " + strings.Join(orderBy, ", "))
 	}
 
 	offset := (filter.Page - 1) * filter.Limit
 	query.WriteString(fmt.Sprintf(" LIMIT %d OFFSET %d", filter.Limit, offset))
 
 	var songs []dbmodels.Song
-	err := r.db.SelectContext(ctx.Ctx, &songs, query.String())
+	err := r.db.SelectContext(ctx.Ctx, &songs, query.String(), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -86,15 +187,17 @@ func (r *Postgres) GetSongs(ctx utils.MyContext, filter dbmodels.SongFilter) ([]
 var getLyrics string
 
 func (r *Postgres) GetLyrics(ctx utils.MyContext, id string) (string, error) {
+	defer observe(ctx, "GetLyrics")()
+
 	ctx.Logger.Debugf("executing GetLyrics query for song id=%s", id)
 
 	var lyrics string
 	err := r.db.QueryRowContext(ctx.Ctx, getLyrics, id).Scan(&lyrics)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", fmt.Errorf("song with id %s not found", id)
+			return "", utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", id)
 		}
-		return "", fmt.Errorf("failed to fetch lyrics: %w", err)
+		return "", dbError("failed to fetch lyrics", err)
 	}
 
 	ctx.Logger.Debug("lyrics retrieved successfully")
@@ -102,7 +205,12 @@ func (r *Postgres) GetLyrics(ctx utils.MyContext, id string) (string, error) {
 	return lyrics, nil
 }
 
-func (r *Postgres) Update(ctx utils.MyContext, input dbmodels.Song) error {
+// Update changes the given fields of a song. A new text is saved as a lyrics
+// revision and the annotations are moved with reanchor in the same
+// transaction.
+func (r *Postgres) Update(ctx utils.MyContext, input dbmodels.Song, reanchor Reanchor) error {
+	defer observe(ctx, "Update")()
+
 	ctx.Logger.Debugf("executing Update query for song with args: %+v", input)
 
 	var (
@@ -123,7 +231,7 @@ func (r *Postgres) Update(ctx utils.MyContext, input dbmodels.Song) error {
 		queryBuilder.WriteString(fmt.Sprintf("title = $%d, ", argIndex))
 		args = append(args, input.Title)
 	}
-	if !input.ReleaseDate.IsZero() {
+	if input.ReleaseDate.Valid {
 		argIndex++
 		queryBuilder.WriteString(fmt.Sprintf("release_date = $%d, ", argIndex))
 		args = append(args, input.ReleaseDate)
@@ -138,6 +246,21 @@ func (r *Postgres) Update(ctx utils.MyContext, input dbmodels.Song) error {
 		queryBuilder.WriteString(fmt.Sprintf("link = $%d, ", argIndex))
 		args = append(args, input.Link)
 	}
+	if input.GroupSearch != "" {
+		argIndex++
+		queryBuilder.WriteString(fmt.Sprintf("group_search = $%d, ", argIndex))
+		args = append(args, input.GroupSearch)
+	}
+	if input.TitleSearch != "" {
+		argIndex++
+		queryBuilder.WriteString(fmt.Sprintf("title_search = $%d, ", argIndex))
+		args = append(args, input.TitleSearch)
+	}
+	if input.TextSearch != "" {
+		argIndex++
+		queryBuilder.WriteString(fmt.Sprintf("text_search = $%d, ", argIndex))
+		args = append(args, input.TextSearch)
+	}
 
 	queryStr := queryBuilder.String()
 	queryStr = queryStr[:len(queryStr)-2]
@@ -148,13 +271,33 @@ func (r *Postgres) Update(ctx utils.MyContext, input dbmodels.Song) error {
 
 	ctx.Logger.Debugf("update query: %s", queryStr)
 
+	tx, err := r.db.BeginTxx(ctx.Ctx, nil)
+	if err != nil {
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
 	var id string
-	err := r.db.QueryRowContext(ctx.Ctx, queryStr, args...).Scan(&id)
+	err = tx.QueryRowContext(ctx.Ctx, queryStr, args...).Scan(&id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("song with id %s not found", input.Id)
+			return utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", input.Id)
 		}
-		return fmt.Errorf("failed to update song: %w", err)
+		return dbError("failed to update song", err)
+	}
+
+	if input.Text != "" {
+		if err = addLyricsRevision(ctx, tx, input.Id, input.Text); err != nil {
+			return err
+		}
+
+		if err = reanchorAnnotations(ctx, tx, input.Id, reanchor); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
 	}
 
 	ctx.Logger.Infof("song updated successfully id=%s", input.Id)
@@ -166,26 +309,233 @@ func (r *Postgres) Update(ctx utils.MyContext, input dbmodels.Song) error {
 var deleteSong string
 
 func (r *Postgres) Delete(ctx utils.MyContext, id string) error {
+	defer observe(ctx, "Delete")()
+
 	ctx.Logger.Debugf("checking if song exists id=%s", id)
 
 	var exists bool
-	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM songs WHERE id = $1)", id).Scan(&exists)
+	err := r.db.QueryRowContext(ctx.Ctx, "SELECT EXISTS(SELECT 1 FROM songs WHERE id = $1)", id).Scan(&exists)
 	if err != nil {
-		return fmt.Errorf("failed to check if song exists: %w", err)
+		return dbError("failed to check if song exists", err)
 	}
 
 	if !exists {
-		return fmt.Errorf("song with id %s not found", id)
+		return utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", id)
 	}
 
 	ctx.Logger.Debugf("executing Delete query for song id=%s", id)
 
 	_, err = r.db.ExecContext(ctx.Ctx, deleteSong, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete song: %w", err)
+		return dbError("failed to delete song", err)
 	}
 
 	ctx.Logger.Infof("song deleted successfully id=%s", id)
 
 	return nil
 }
+
+//go:embed sql/GetSongsWithoutSearchKeys.sql
+var getSongsWithoutSearchKeys string
+
+func (r *Postgres) GetSongsWithoutSearchKeys(ctx utils.MyContext) ([]dbmodels.Song, error) {
+	defer observe(ctx, "GetSongsWithoutSearchKeys")()
+
+	ctx.Logger.Debug("executing GetSongsWithoutSearchKeys query")
+
+	var songs []dbmodels.Song
+	err := r.db.SelectContext(ctx.Ctx, &songs, getSongsWithoutSearchKeys)
+	if err != nil {
+		return nil, dbError("failed to fetch songs without search keys", err)
+	}
+
+	ctx.Logger.Debugf("retrieved %d songs without search keys", len(songs))
+
+	return songs, nil
+}
+
+//go:embed sql/UpdateSearchKeys.sql
+var updateSearchKeys string
+
+func (r *Postgres) UpdateSearchKeys(ctx utils.MyContext, song dbmodels.Song) error {
+	defer observe(ctx, "UpdateSearchKeys")()
+
+	ctx.Logger.Debugf("executing UpdateSearchKeys query for song id=%s", song.Id)
+
+	_, err := r.db.ExecContext(ctx.Ctx, updateSearchKeys, song.Id, song.GroupSearch, song.TitleSearch, song.TextSearch)
+	if err != nil {
+		return dbError("failed to update search keys", err)
+	}
+
+	return nil
+}
+
+//go:embed sql/GetLyricsRevisions.sql
+var getLyricsRevisions string
+
+func (r *Postgres) GetLyricsRevisions(ctx utils.MyContext, songId string) ([]dbmodels.LyricsRevision, error) {
+	defer observe(ctx, "GetLyricsRevisions")()
+
+	ctx.Logger.Debugf("executing GetLyricsRevisions query for song id=%s", songId)
+
+	var revisions []dbmodels.LyricsRevision
+	err := r.db.SelectContext(ctx.Ctx, &revisions, getLyricsRevisions, songId)
+	if err != nil {
+		return nil, dbError("failed to fetch lyrics revisions", err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", songId)
+	}
+
+	ctx.Logger.Debugf("retrieved %d lyrics revisions", len(revisions))
+
+	return revisions, nil
+}
+
+//go:embed sql/GetLyricsRevision.sql
+var getLyricsRevision string
+
+func (r *Postgres) GetLyricsRevision(ctx utils.MyContext, songId string, revision int) (dbmodels.LyricsRevision, error) {
+	defer observe(ctx, "GetLyricsRevision")()
+
+	ctx.Logger.Debugf("executing GetLyricsRevision query for song id=%s, revision=%d", songId, revision)
+
+	var lyricsRevision dbmodels.LyricsRevision
+	err := r.db.GetContext(ctx.Ctx, &lyricsRevision, getLyricsRevision, songId, revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodels.LyricsRevision{}, utils.NewNotFoundError(utils.CodeRevisionNotFound, "lyrics revision %d of song with id %s not found", revision, songId)
+		}
+		return dbmodels.LyricsRevision{}, dbError("failed to fetch lyrics revision", err)
+	}
+
+	return lyricsRevision, nil
+}
+
+//go:embed sql/LookupLyrics.sql
+var lookupLyrics string
+
+func (r *Postgres) LookupLyrics(ctx utils.MyContext, filter dbmodels.LyricsLookupFilter) ([]dbmodels.Song, error) {
+	defer observe(ctx, "LookupLyrics")()
+
+	ctx.Logger.Debugf("executing LookupLyrics query with filter: %+v", filter)
+
+	offset := (filter.Page - 1) * filter.Limit
+
+	var songs []dbmodels.Song
+	err := r.db.SelectContext(ctx.Ctx, &songs, lookupLyrics, containsPattern(filter.Phrase), filter.Limit, offset)
+	if err != nil {
+		return nil, dbError("failed to look up lyrics", err)
+	}
+
+	ctx.Logger.Debugf("retrieved %d songs matching lyrics", len(songs))
+
+	return songs, nil
+}
+
+//go:embed sql/GetSong.sql
+var getSong string
+
+func (r *Postgres) GetSong(ctx utils.MyContext, id string) (dbmodels.Song, error) {
+	defer observe(ctx, "GetSong")()
+
+	ctx.Logger.Debugf("executing GetSong query for song id=%s", id)
+
+	var song dbmodels.Song
+	err := r.db.GetContext(ctx.Ctx, &song, getSong, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodels.Song{}, utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", id)
+		}
+		return dbmodels.Song{}, dbError("failed to fetch song", err)
+	}
+
+	return song, nil
+}
+
+//go:embed sql/GetSongsForIndex.sql
+var getSongsForIndex string
+
+func (r *Postgres) GetSongsForIndex(ctx utils.MyContext) ([]dbmodels.Song, error) {
+	defer observe(ctx, "GetSongsForIndex")()
+
+	ctx.Logger.Debug("executing GetSongsForIndex query")
+
+	var songs []dbmodels.Song
+	err := r.db.SelectContext(ctx.Ctx, &songs, getSongsForIndex)
+	if err != nil {
+		return nil, dbError("failed to fetch songs for index", err)
+	}
+
+	ctx.Logger.Debugf("retrieved %d songs for index", len(songs))
+
+	return songs, nil
+}
+
+func containsPattern(value string) string {
+	return "%" + likeEscaper.Replace(value) + "%"
+}
+
+func containsPatterns(values []string) []string {
+	patterns := make([]string, len(values))
+	for i, value := range values {
+		patterns[i] = containsPattern(value)
+	}
+	return patterns
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// observe starts a span for a repository method and records its latency. Use
+// it as defer observe(ctx, "GetSong")().
+func observe(ctx utils.MyContext, query string) func() {
+	_, span := tracing.Start(ctx, "repository."+query, trace.SpanKindClient,
+		semconv.DBSystemPostgreSQL, semconv.DBOperationName(query))
+	done := metrics.ObserveQuery(query)
+
+	return func() {
+		done()
+		span.End()
+	}
+}
+
+// Postgres error codes mapped to domain errors by dbError.
+const (
+	pqUniqueViolation           = "23505"
+	pqInvalidTextRepresentation = "22P02"
+)
+
+// dbError wraps a database error with message. Unique violations, such as two
+// concurrent edits creating the same lyrics revision, become conflict errors,
+// and malformed values, such as an id that is not a UUID, validation errors.
+func dbError(message string, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return utils.NewConflictError(utils.CodeConflict, message, err)
+		case pqInvalidTextRepresentation:
+			validationErr := utils.NewValidationError(message)
+			validationErr.Err = err
+			return validationErr
+		}
+	}
+
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+//go:embed sql/CountSongs.sql
+var countSongs string
+
+// CountSongs returns the number of songs and of songs waiting for enrichment.
+func (r *Postgres) CountSongs(ctx utils.MyContext) (dbmodels.SongStats, error) {
+	defer observe(ctx, "CountSongs")()
+
+	var stats dbmodels.SongStats
+	if err := r.db.GetContext(ctx.Ctx, &stats, countSongs); err != nil {
+		return dbmodels.SongStats{}, dbError("failed to count songs", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,124 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/pkg/repository"
+	"effectiveMobileTest/pkg/service/music"
+	"effectiveMobileTest/utils"
+)
+
+// testDBEnv names the connection string of a disposable Postgres database.
+// Repository tests are skipped without it.
+const testDBEnv = "TEST_DB_CONNECTION_STRING"
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	connectionString := os.Getenv(testDBEnv)
+	if connectionString == "" {
+		t.Skipf("%s is not set", testDBEnv)
+	}
+
+	db, err := sqlx.Connect("postgres", connectionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	goose.SetLogger(goose.NopLogger())
+	if err = goose.Up(db.DB, "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestRebuildSearchKeys(t *testing.T) {
+	db := openTestDB(t)
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+
+	withText, withoutText := uuid.New().String(), uuid.New().String()
+	db.MustExec(`INSERT INTO songs (id, group_name, title, text, details_sources) VALUES
+		($1, 'Muse', 'Supermassive Black Hole', 'Ooh baby, don''t you know I suffer?', '{"text":"primary"}'),
+		($2, 'Ёлка', 'Прованс', NULL, '{}')`, withText, withoutText)
+	t.Cleanup(func() { db.MustExec("DELETE FROM songs WHERE id IN ($1, $2)", withText, withoutText) })
+
+	service := music.NewMusicService(repository.NewPostgres(db), nil, nil, music.Options{})
+	if err := service.RebuildSearchKeys(ctx); err != nil {
+		t.Fatalf("RebuildSearchKeys() error = %v", err)
+	}
+
+	var song struct {
+		GroupSearch    string `db:"group_search"`
+		TitleSearch    string `db:"title_search"`
+		TextSearch     string `db:"text_search"`
+		DetailsSources string `db:"details_sources"`
+	}
+	if err := db.Get(&song, "SELECT group_search, title_search, text_search, details_sources::text FROM songs WHERE id = $1", withText); err != nil {
+		t.Fatal(err)
+	}
+	if song.GroupSearch == "" || song.TitleSearch == "" || song.TextSearch == "" {
+		t.Errorf("search keys not rebuilt: %+v", song)
+	}
+	if song.DetailsSources != `{"text": "primary"}` {
+		t.Errorf("details sources = %s, want them kept", song.DetailsSources)
+	}
+
+	if err := db.Get(&song, "SELECT group_search, title_search, text_search, details_sources::text FROM songs WHERE id = $1", withoutText); err != nil {
+		t.Fatal(err)
+	}
+	if song.GroupSearch == "" || song.TitleSearch == "" {
+		t.Errorf("search keys of a song without lyrics not rebuilt: %+v", song)
+	}
+}
+
+func TestCompleteEnrichmentKeepsConcurrentEdit(t *testing.T) {
+	db := openTestDB(t)
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	repo := repository.NewPostgres(db)
+
+	id := uuid.New().String()
+	db.MustExec(`INSERT INTO songs (id, group_name, title, text, link, details_sources, enrichment_status)
+		VALUES ($1, 'Muse', 'Uprising', '', '', '{}', 'pending')`, id)
+	t.Cleanup(func() { db.MustExec("DELETE FROM songs WHERE id = $1", id) })
+
+	read, err := repo.GetSong(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched := read
+	fetched.Text = "Paranoia is in bloom"
+
+	db.MustExec("UPDATE songs SET text = 'Edited lyrics' WHERE id = $1", id)
+
+	err = repo.CompleteEnrichment(ctx, read, fetched, nil)
+	if utils.KindOf(err) != utils.KindConflict {
+		t.Fatalf("CompleteEnrichment() error = %v, want a conflict", err)
+	}
+
+	var text string
+	if err = db.Get(&text, "SELECT text FROM songs WHERE id = $1", id); err != nil {
+		t.Fatal(err)
+	}
+	if text != "Edited lyrics" {
+		t.Errorf("text = %q, want the edit kept", text)
+	}
+
+	if read, err = repo.GetSong(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	fetched = read
+	fetched.Text = "Paranoia is in bloom"
+	if err = repo.CompleteEnrichment(ctx, read, fetched, nil); err != nil {
+		t.Fatalf("CompleteEnrichment() error = %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+UPDATE enrichment_jobs
+SET attempts = attempts + 1, locked_until = now() + make_interval(secs => $1)
+WHERE song_id = (
+    SELECT song_id FROM enrichment_jobs
+    WHERE run_after <= now() AND (locked_until IS NULL OR locked_until < now())
+    ORDER BY run_after
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING song_id, attempts
\ No newline at end of file
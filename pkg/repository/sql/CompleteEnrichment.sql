@@ -0,0 +1,5 @@
+UPDATE songs
+SET release_date = $2, text = $3, link = $4, text_search = $5, details_sources = $6,
+    enrichment_status = 'enriched', enrichment_error = '', enriched_details = $7, enriched_at = now()
+WHERE id = $1 AND group_name = $8 AND title = $9 AND release_date IS NOT DISTINCT FROM $10
+  AND COALESCE(text, '') = $11 AND COALESCE(link, '') = $12
\ No newline at end of file
@@ -0,0 +1,2 @@
+SELECT count(*) AS total, count(*) FILTER (WHERE enrichment_status = 'pending') AS pending
+FROM songs
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO api_keys (id, name, prefix, key_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING created_at
\ No newline at end of file
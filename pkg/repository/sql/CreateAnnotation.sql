@@ -0,0 +1,2 @@
+INSERT INTO annotations (id, song_id, verse, line, start_char, end_char, quote, author, body)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO details_repairs (provider, group_name, title, field, action, reason, original)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO enrichment_jobs (song_id) VALUES ($1)
+ON CONFLICT (song_id) DO UPDATE SET attempts = 0, run_after = now(), locked_until = NULL
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO lyrics_revisions (song_id, revision, text)
+SELECT $1, COALESCE(MAX(revision), 0) + 1, $2 FROM lyrics_revisions WHERE song_id = $1
\ No newline at end of file
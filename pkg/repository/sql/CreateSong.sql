@@ -1,2 +1,3 @@
-INSERT INTO songs (id, group_name, title, release_date, text, link)
-VALUES ($1, $2, $3, $4, $5, $6)
\ No newline at end of file
+INSERT INTO songs (id, group_name, title, release_date, text, link, group_search, title_search, text_search, details_sources,
+                   enrichment_status, enriched_details, enrichment_error, enriched_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, CASE WHEN $11 = 'enriched' THEN now() END)
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM enrichment_jobs WHERE song_id = $1
\ No newline at end of file
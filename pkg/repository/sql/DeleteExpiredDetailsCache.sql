@@ -0,0 +1 @@
+DELETE FROM details_cache WHERE expires_at <= now()
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM rate_limits WHERE expires_at <= now()
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+FROM api_keys
+WHERE key_hash = $1
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+FROM api_keys
+ORDER BY created_at DESC, id
\ No newline at end of file
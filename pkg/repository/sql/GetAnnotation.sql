@@ -0,0 +1 @@
+SELECT * FROM annotations WHERE song_id = $1 AND id = $2
\ No newline at end of file
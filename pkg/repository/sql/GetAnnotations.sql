@@ -0,0 +1 @@
+SELECT * FROM annotations WHERE song_id = $1 ORDER BY verse, line, start_char, created_at
\ No newline at end of file
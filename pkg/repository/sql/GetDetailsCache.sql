@@ -0,0 +1,3 @@
+SELECT group_key, title_key, release_date, text, link, details_sources, not_found, expires_at
+FROM details_cache
+WHERE group_key = $1 AND title_key = $2 AND expires_at > now()
\ No newline at end of file
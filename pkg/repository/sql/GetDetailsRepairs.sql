@@ -0,0 +1,5 @@
+SELECT provider, group_name, title, field, action, reason, original, created_at
+FROM details_repairs
+WHERE $1 = '' OR provider = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2
\ No newline at end of file
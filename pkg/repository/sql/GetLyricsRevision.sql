@@ -0,0 +1 @@
+SELECT song_id, revision, text, created_at FROM lyrics_revisions WHERE song_id = $1 AND revision = $2
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT song_id, revision, created_at FROM lyrics_revisions WHERE song_id = $1 ORDER BY revision
\ No newline at end of file
@@ -0,0 +1,6 @@
+WITH current_window AS (
+    SELECT to_timestamp(floor(extract(epoch FROM now())::float8 / $2) * $2) AS start
+)
+SELECT COALESCE((SELECT count FROM rate_limits WHERE key = $1 AND window_start = start), 0) AS count,
+       extract(epoch FROM start + make_interval(secs => $2) - now())::float8 AS reset_seconds
+FROM current_window
\ No newline at end of file
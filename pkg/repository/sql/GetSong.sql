@@ -0,0 +1 @@
+SELECT * FROM songs WHERE id = $1
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT id, group_name, title, release_date, COALESCE(text, '') AS text FROM songs
\ No newline at end of file
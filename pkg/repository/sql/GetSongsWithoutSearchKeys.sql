@@ -0,0 +1,2 @@
+SELECT id, group_name, title, COALESCE(text, '') AS text FROM songs
+WHERE group_search = '' OR title_search = '' OR text_search = ''
\ No newline at end of file
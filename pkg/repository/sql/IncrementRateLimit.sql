@@ -0,0 +1,7 @@
+WITH current_window AS (
+    SELECT to_timestamp(floor(extract(epoch FROM now())::float8 / $2) * $2) AS start
+)
+INSERT INTO rate_limits (key, window_start, count, expires_at)
+SELECT $1, start, 1, start + make_interval(secs => $2) FROM current_window
+ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limits.count + 1
+RETURNING count, extract(epoch FROM expires_at - now())::float8 AS reset_seconds
\ No newline at end of file
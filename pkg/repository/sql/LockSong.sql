@@ -0,0 +1 @@
+SELECT id FROM songs WHERE id = $1 FOR UPDATE
\ No newline at end of file
@@ -0,0 +1,4 @@
+SELECT id, group_name, title, COALESCE(text, '') AS text FROM songs
+WHERE text_search LIKE $1
+ORDER BY group_name, title
+LIMIT $2 OFFSET $3
\ No newline at end of file
@@ -0,0 +1 @@
+UPDATE enrichment_jobs SET run_after = now() + make_interval(secs => $2), locked_until = NULL WHERE song_id = $1
\ No newline at end of file
@@ -0,0 +1,5 @@
+INSERT INTO details_cache (group_key, title_key, release_date, text, link, details_sources, not_found, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, now() + make_interval(secs => $8))
+ON CONFLICT (group_key, title_key) DO UPDATE
+SET release_date = EXCLUDED.release_date, text = EXCLUDED.text, link = EXCLUDED.link,
+    details_sources = EXCLUDED.details_sources, not_found = EXCLUDED.not_found, expires_at = EXCLUDED.expires_at
\ No newline at end of file
@@ -0,0 +1,2 @@
+UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now())
+WHERE id = $1
\ No newline at end of file
@@ -0,0 +1,2 @@
+UPDATE api_keys SET last_used_at = now()
+WHERE id = $1
\ No newline at end of file
@@ -0,0 +1 @@
+UPDATE annotations SET author = $3, body = $4 WHERE song_id = $1 AND id = $2
\ No newline at end of file
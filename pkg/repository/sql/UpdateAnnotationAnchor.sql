@@ -0,0 +1 @@
+UPDATE annotations SET verse = $2, line = $3, start_char = $4, end_char = $5, quote = $6, orphaned = $7 WHERE id = $1
\ No newline at end of file
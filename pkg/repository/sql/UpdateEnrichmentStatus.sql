@@ -0,0 +1 @@
+UPDATE songs SET enrichment_status = $2, enrichment_error = $3 WHERE id = $1
\ No newline at end of file
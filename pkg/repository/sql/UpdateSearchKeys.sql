@@ -0,0 +1 @@
+UPDATE songs SET group_search = $2, title_search = $3, text_search = $4 WHERE id = $1
\ No newline at end of file
@@ -0,0 +1,168 @@
+package annotations
+
+import (
+	"fmt"
+	"strings"
+
+	"effectiveMobileTest/pkg/service/lyrics"
+	"effectiveMobileTest/utils"
+)
+
+// minSimilarity is the lowest similarity between the annotated quote and a
+// fragment of edited lyrics at which the annotation is moved to that fragment.
+const minSimilarity = 0.8
+
+// Anchor pins an annotation to a character range of a lyrics line. Verse and
+// Line are 1-based and use the same verse split as lyrics pagination; Start
+// and End are rune offsets within the line, End exclusive.
+type Anchor struct {
+	Verse int
+	Line  int
+	Start int
+	End   int
+}
+
+// Quote returns the text the anchor points at, or an error when the anchor is
+// outside of text.
+func Quote(text string, anchor Anchor) (string, error) {
+	lines := split(text)
+
+	index, ok := lineIndex(lines, anchor.Verse, anchor.Line)
+	if !ok {
+		return "", utils.NewValidationError(fmt.Sprintf("invalid anchor: verse %d line %d does not exist", anchor.Verse, anchor.Line),
+			utils.FieldError{Field: "verse", Message: "must point at an existing line together with line"},
+			utils.FieldError{Field: "line", Message: "must point at an existing line together with verse"})
+	}
+
+	runes := []rune(lines[index].text)
+	if anchor.Start < 0 || anchor.End <= anchor.Start || anchor.End > len(runes) {
+		return "", utils.NewValidationError(fmt.Sprintf("invalid anchor: character range %d-%d is outside of the line", anchor.Start, anchor.End),
+			utils.FieldError{Field: "start", Message: "must be at least 0 and less than end"},
+			utils.FieldError{Field: "end", Message: fmt.Sprintf("must be at most the line length %d", len(runes))})
+	}
+
+	return string(runes[anchor.Start:anchor.End]), nil
+}
+
+// Reanchor finds where quote, previously anchored at old, is located in the
+// edited text. It keeps the anchor if the quote is still there, otherwise it
+// moves to the nearest exact occurrence and then to the nearest fragment that
+// is similar enough. The second result is false when the quote is gone and the
+// annotation has to be marked orphaned.
+func Reanchor(text, quote string, old Anchor) (Anchor, bool) {
+	lines := split(text)
+	if current, err := Quote(text, old); err == nil && current == quote {
+		return old, true
+	}
+
+	origin := 0
+	for i, l := range lines {
+		if l.verse < old.Verse || (l.verse == old.Verse && l.line <= old.Line) {
+			origin = i
+		}
+	}
+
+	quoteRunes := []rune(quote)
+
+	var (
+		best      Anchor
+		bestScore float64
+		bestDist  int
+		found     bool
+	)
+	consider := func(i, start, end int, score float64) {
+		dist := abs(i - origin)
+		if !found || score > bestScore || (score == bestScore && dist < bestDist) {
+			best = Anchor{Verse: lines[i].verse, Line: lines[i].line, Start: start, End: end}
+			bestScore, bestDist, found = score, dist, true
+		}
+	}
+
+	for i, l := range lines {
+		runes := []rune(l.text)
+		for start := 0; start+len(quoteRunes) <= len(runes); start++ {
+			if string(runes[start:start+len(quoteRunes)]) == quote {
+				consider(i, start, start+len(quoteRunes), 1)
+			}
+		}
+	}
+	if found {
+		return best, true
+	}
+
+	for i, l := range lines {
+		runes := []rune(l.text)
+		for start := 0; start < len(runes); start++ {
+			for _, length := range []int{len(quoteRunes), len(quoteRunes) - 1, len(quoteRunes) + 1} {
+				end := start + length
+				if length <= 0 || end > len(runes) {
+					continue
+				}
+				if score := similarity(quoteRunes, runes[start:end]); score >= minSimilarity {
+					consider(i, start, end, score)
+				}
+			}
+		}
+	}
+
+	return best, found
+}
+
+type line struct {
+	verse, line int
+	text        string
+}
+
+func split(text string) []line {
+	var lines []line
+	for v, verse := range lyrics.Verses(text) {
+		for l, lineText := range strings.Split(verse, "\n") {
+			lines = append(lines, line{verse: v + 1, line: l + 1, text: lineText})
+		}
+	}
+	return lines
+}
+
+func lineIndex(lines []line, verse, lineNumber int) (int, bool) {
+	for i, l := range lines {
+		if l.verse == verse && l.line == lineNumber {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// similarity is 1 minus the Levenshtein distance between a and b relative to
+// the longer of the two.
+func similarity(a, b []rune) float64 {
+	longest := max(len(a), len(b))
+	if longest == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return 1 - float64(prev[len(b)])/float64(longest)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
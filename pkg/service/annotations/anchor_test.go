@@ -0,0 +1,74 @@
+package annotations
+
+import "testing"
+
+const lyricsText = `Группа крови на рукаве,
+Мой порядковый номер на рукаве.
+
+Пожелай мне удачи в бою,
+Пожелай мне удачи.`
+
+func TestQuote(t *testing.T) {
+	quote, err := Quote(lyricsText, Anchor{Verse: 2, Line: 1, Start: 12, End: 17})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if quote != "удачи" {
+		t.Errorf("Quote() = %q, want %q", quote, "удачи")
+	}
+
+	if _, err = Quote(lyricsText, Anchor{Verse: 3, Line: 1, Start: 0, End: 1}); err == nil {
+		t.Error("expected an error for a missing verse")
+	}
+	if _, err = Quote(lyricsText, Anchor{Verse: 1, Line: 1, Start: 5, End: 100}); err == nil {
+		t.Error("expected an error for a range outside of the line")
+	}
+}
+
+func TestReanchor(t *testing.T) {
+	old := Anchor{Verse: 1, Line: 1, Start: 0, End: 12}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected Anchor
+		ok       bool
+	}{
+		{
+			name:     "unchanged",
+			text:     lyricsText,
+			expected: old,
+			ok:       true,
+		},
+		{
+			name:     "moved by an inserted line",
+			text:     "Теплое место.\n" + lyricsText,
+			expected: Anchor{Verse: 1, Line: 2, Start: 0, End: 12},
+			ok:       true,
+		},
+		{
+			name:     "moved within the line",
+			text:     "Вот: Группа крови на рукаве,",
+			expected: Anchor{Verse: 1, Line: 1, Start: 5, End: 17},
+			ok:       true,
+		},
+		{
+			name:     "fuzzy match",
+			text:     "Группа кровИ на рукаве,",
+			expected: Anchor{Verse: 1, Line: 1, Start: 0, End: 12},
+			ok:       true,
+		},
+		{
+			name: "orphaned",
+			text: "Звезда по имени Солнце",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		result, ok := Reanchor(tt.text, "Группа крови", old)
+		if ok != tt.ok || (ok && result != tt.expected) {
+			t.Errorf("%s: Reanchor() = %+v, %v, want %+v, %v", tt.name, result, ok, tt.expected, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Package apikeys issues, lists and revokes API keys and authenticates the
+// requests that carry them.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/pkg/auth"
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/pkg/service/mappers"
+	"effectiveMobileTest/utils"
+)
+
+const (
+	// KeyPrefix starts every API key, so that keys can be told apart from
+	// other bearer tokens and found by secret scanners.
+	KeyPrefix = "mk_"
+
+	keyBytes = 32
+	// displayPrefixLength is the number of leading characters of a key kept
+	// in clear to tell keys apart.
+	displayPrefixLength = len(KeyPrefix) + 6
+	// lastUsedResolution limits how often the last use of a key is written.
+	lastUsedResolution = time.Minute
+)
+
+type APIKeyService interface {
+	Create(ctx utils.MyContext, req models.CreateAPIKeyRequest) (models.CreateAPIKeyResponse, error)
+	List(ctx utils.MyContext) ([]models.APIKey, error)
+	Revoke(ctx utils.MyContext, id string) error
+	Authenticate(ctx utils.MyContext, key string) (auth.Principal, error)
+}
+
+// Repository stores the API keys.
+type Repository interface {
+	CreateAPIKey(ctx utils.MyContext, key dbmodels.APIKey) (dbmodels.APIKey, error)
+	GetAPIKeys(ctx utils.MyContext) ([]dbmodels.APIKey, error)
+	GetAPIKeyByHash(ctx utils.MyContext, hash string) (dbmodels.APIKey, bool, error)
+	RevokeAPIKey(ctx utils.MyContext, id string) error
+	TouchAPIKey(ctx utils.MyContext, id string) error
+}
+
+type ImplAPIKeys struct {
+	repo Repository
+	now  func() time.Time
+}
+
+func NewAPIKeyService(repo Repository) *ImplAPIKeys {
+	return &ImplAPIKeys{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// Create issues a new API key. The key is returned once and only its hash is
+// stored.
+func (s *ImplAPIKeys) Create(ctx utils.MyContext, req models.CreateAPIKeyRequest) (models.CreateAPIKeyResponse, error) {
+	if err := s.validate(req); err != nil {
+		return models.CreateAPIKeyResponse{}, err
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		return models.CreateAPIKeyResponse{}, err
+	}
+
+	stored, err := s.repo.CreateAPIKey(ctx, dbmodels.APIKey{
+		Id:        uuid.New().String(),
+		Name:      req.Name,
+		Prefix:    key[:displayPrefixLength],
+		Hash:      HashKey(key),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		return models.CreateAPIKeyResponse{}, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return models.CreateAPIKeyResponse{APIKey: mappers.MapFromAPIKey(stored), Key: key}, nil
+}
+
+func (s *ImplAPIKeys) validate(req models.CreateAPIKeyRequest) error {
+	var fields []utils.FieldError
+	if strings.TrimSpace(req.Name) == "" {
+		fields = append(fields, utils.FieldError{Field: "name", Message: "is required"})
+	}
+	if len(req.Scopes) == 0 {
+		fields = append(fields, utils.FieldError{Field: "scopes", Message: "is required"})
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			fields = append(fields, utils.FieldError{Field: "scopes",
+				Message: fmt.Sprintf("unknown scope %q, expected one of %s", scope, strings.Join(auth.Scopes, ", "))})
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(s.now()) {
+		fields = append(fields, utils.FieldError{Field: "expiresAt", Message: "must be in the future"})
+	}
+
+	if len(fields) > 0 {
+		return utils.NewValidationError("invalid API key request", fields...)
+	}
+	return nil
+}
+
+// List returns every API key, newest first.
+func (s *ImplAPIKeys) List(ctx utils.MyContext) ([]models.APIKey, error) {
+	keys, err := s.repo.GetAPIKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %w", err)
+	}
+
+	return mappers.MapFromAPIKeys(keys), nil
+}
+
+// Revoke makes an API key unusable. Revoked keys are kept for the record.
+func (s *ImplAPIKeys) Revoke(ctx utils.MyContext, id string) error {
+	if err := s.repo.RevokeAPIKey(ctx, id); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	return nil
+}
+
+// Authenticate returns the principal of a valid API key and records its use.
+// Unknown, revoked and expired keys are rejected with an unauthorized error.
+func (s *ImplAPIKeys) Authenticate(ctx utils.MyContext, key string) (auth.Principal, error) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return auth.Principal{}, utils.NewUnauthorizedError("invalid API key")
+	}
+
+	stored, found, err := s.repo.GetAPIKeyByHash(ctx, HashKey(key))
+	switch {
+	case err != nil:
+		return auth.Principal{}, fmt.Errorf("failed to authenticate API key: %w", err)
+	case !found:
+		return auth.Principal{}, utils.NewUnauthorizedError("invalid API key")
+	case stored.RevokedAt != nil:
+		return auth.Principal{}, utils.NewUnauthorizedError("API key %s was revoked", stored.Prefix)
+	case stored.ExpiresAt != nil && !stored.ExpiresAt.After(s.now()):
+		return auth.Principal{}, utils.NewUnauthorizedError("API key %s expired", stored.Prefix)
+	}
+
+	if stored.LastUsedAt == nil || s.now().Sub(*stored.LastUsedAt) >= lastUsedResolution {
+		if err = s.repo.TouchAPIKey(ctx, stored.Id); err != nil {
+			ctx.Logger.Warnf("failed to record use of API key %s: %v", stored.Id, err)
+		}
+	}
+
+	return auth.Principal{Id: stored.Id, Name: stored.Name, Scopes: stored.Scopes}, nil
+}
+
+// GenerateKey returns a new random API key.
+func GenerateKey() (string, error) {
+	secret := make([]byte, keyBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// HashKey returns the hex SHA-256 hash under which a key is stored. Keys are
+// random, so a fast hash is enough to make a leaked table useless.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
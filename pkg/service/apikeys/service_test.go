@@ -0,0 +1,130 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/pkg/auth"
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/utils"
+)
+
+type fakeRepository struct {
+	keys    map[string]dbmodels.APIKey
+	touched []string
+}
+
+func (r *fakeRepository) CreateAPIKey(ctx utils.MyContext, key dbmodels.APIKey) (dbmodels.APIKey, error) {
+	key.CreatedAt = time.Now()
+	r.keys[key.Hash] = key
+	return key, nil
+}
+
+func (r *fakeRepository) GetAPIKeys(ctx utils.MyContext) ([]dbmodels.APIKey, error) {
+	var keys []dbmodels.APIKey
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (r *fakeRepository) GetAPIKeyByHash(ctx utils.MyContext, hash string) (dbmodels.APIKey, bool, error) {
+	key, found := r.keys[hash]
+	return key, found, nil
+}
+
+func (r *fakeRepository) RevokeAPIKey(ctx utils.MyContext, id string) error {
+	for hash, key := range r.keys {
+		if key.Id == id {
+			now := time.Now()
+			key.RevokedAt = &now
+			r.keys[hash] = key
+			return nil
+		}
+	}
+	return utils.NewNotFoundError(utils.CodeAPIKeyNotFound, "API key with id %s not found", id)
+}
+
+func (r *fakeRepository) TouchAPIKey(ctx utils.MyContext, id string) error {
+	r.touched = append(r.touched, id)
+	return nil
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	repo := &fakeRepository{keys: map[string]dbmodels.APIKey{}}
+	service := NewAPIKeyService(repo)
+
+	created, err := service.Create(ctx, models.CreateAPIKeyRequest{Name: "ci", Scopes: []string{auth.ScopeSongsRead}})
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, KeyPrefix) || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Errorf("key %q does not start with its prefix %q", created.Key, created.Prefix)
+	}
+	for _, key := range repo.keys {
+		if strings.Contains(key.Hash, created.Key) || key.Hash != HashKey(created.Key) {
+			t.Errorf("expected only the hash of the key to be stored")
+		}
+	}
+
+	principal, err := service.Authenticate(ctx, created.Key)
+	if err != nil {
+		t.Fatalf("Authenticate() error: %v", err)
+	}
+	if principal.Id != created.Id || !principal.HasScope(auth.ScopeSongsRead) || principal.HasScope(auth.ScopeSongsWrite) {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+	if len(repo.touched) != 1 {
+		t.Errorf("expected the use of the key to be recorded")
+	}
+
+	if _, err = service.Authenticate(ctx, created.Key+"x"); utils.KindOf(err) != utils.KindUnauthorized {
+		t.Errorf("Authenticate() of an unknown key: %v", err)
+	}
+
+	if err = service.Revoke(ctx, created.Id); err != nil {
+		t.Fatalf("Revoke() error: %v", err)
+	}
+	if _, err = service.Authenticate(ctx, created.Key); utils.KindOf(err) != utils.KindUnauthorized {
+		t.Errorf("Authenticate() of a revoked key: %v", err)
+	}
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	service := NewAPIKeyService(&fakeRepository{keys: map[string]dbmodels.APIKey{}})
+
+	expiresAt := time.Now().Add(time.Hour)
+	created, err := service.Create(ctx, models.CreateAPIKeyRequest{Name: "temp", Scopes: []string{auth.ScopeAdmin}, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	service.now = func() time.Time { return expiresAt.Add(time.Second) }
+	if _, err = service.Authenticate(ctx, created.Key); utils.KindOf(err) != utils.KindUnauthorized {
+		t.Errorf("Authenticate() of an expired key: %v", err)
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	ctx := utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+	service := NewAPIKeyService(&fakeRepository{keys: map[string]dbmodels.APIKey{}})
+
+	past := time.Now().Add(-time.Hour)
+	_, err := service.Create(ctx, models.CreateAPIKeyRequest{Scopes: []string{"songs:everything"}, ExpiresAt: &past})
+
+	var domainErr *utils.Error
+	if !errors.As(err, &domainErr) || domainErr.Kind != utils.KindValidation {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(domainErr.Fields) != 3 {
+		t.Errorf("expected errors for name, scopes and expiresAt, got %+v", domainErr.Fields)
+	}
+}
@@ -0,0 +1,159 @@
+package details
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/utils"
+)
+
+// ErrCircuitOpen is returned without calling the upstream while its circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Breaker is a circuit breaker. After FailureThreshold consecutive failures it
+// opens and rejects calls for OpenTimeout, then lets a single trial call
+// through: success closes it again, failure reopens it.
+type Breaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	openTimeout      time.Duration
+	state            string
+	failures         int
+	openedAt         time.Time
+	trialInFlight    bool
+	now              func() time.Time
+}
+
+func NewBreaker(failureThreshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		state:            BreakerClosed,
+		now:              time.Now,
+	}
+}
+
+// Allow reports whether a call may go through. Every allowed call must be
+// followed by Record or Ignore.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.trialInFlight = true
+		return nil
+	case BreakerHalfOpen:
+		if b.trialInFlight {
+			return ErrCircuitOpen
+		}
+		b.trialInFlight = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record counts the outcome of an allowed call.
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trialInFlight = false
+
+	if success {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Ignore releases an allowed call whose outcome says nothing about the
+// upstream, such as a call cancelled by the client.
+func (b *Breaker) Ignore() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trialInFlight = false
+}
+
+func (b *Breaker) Status() models.BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := models.BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		retryAt := openedAt.Add(b.openTimeout)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+
+	return status
+}
+
+// StatusReporter is implemented by providers that can describe the health of
+// their upstreams.
+type StatusReporter interface {
+	Status() []models.ProviderStatus
+}
+
+// BreakerProvider guards a provider with a circuit breaker. Not-found answers
+// count as successful calls; requests turned away by a Limiter do not count.
+type BreakerProvider struct {
+	provider Provider
+	breaker  *Breaker
+}
+
+func NewBreakerProvider(provider Provider, breaker *Breaker) *BreakerProvider {
+	return &BreakerProvider{provider: provider, breaker: breaker}
+}
+
+func (p *BreakerProvider) Name() string {
+	return p.provider.Name()
+}
+
+func (p *BreakerProvider) FetchSongDetails(ctx utils.MyContext, group, song string) (models.SongDetails, error) {
+	if err := p.breaker.Allow(); err != nil {
+		return models.SongDetails{}, fmt.Errorf("%w: upstream %s is unavailable", err, p.Name())
+	}
+
+	details, err := p.provider.FetchSongDetails(ctx, group, song)
+	switch {
+	case err == nil || errors.Is(err, ErrNotFound):
+		p.breaker.Record(true)
+	case errors.Is(err, context.Canceled) && ctx.Ctx.Err() != nil, errors.Is(err, ErrOverloaded):
+		p.breaker.Ignore()
+	default:
+		p.breaker.Record(false)
+	}
+
+	return details, err
+}
+
+func (p *BreakerProvider) Status() []models.ProviderStatus {
+	return []models.ProviderStatus{{Name: p.Name(), Breaker: p.breaker.Status()}}
+}
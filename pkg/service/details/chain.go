@@ -0,0 +1,113 @@
+package details
+
+import (
+	"errors"
+	"fmt"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/utils"
+)
+
+// Names of the song details fields as recorded in models.SongDetails.Sources.
+const (
+	FieldReleaseDate = "releaseDate"
+	FieldText        = "text"
+	FieldLink        = "link"
+)
+
+// Chain asks providers in priority order and merges their answers field by
+// field: a field is taken from the first provider that returns it non-empty.
+// It stops as soon as all fields are filled, so fallbacks are only called when
+// the providers before them fail or return partial details. Answers are
+// normalized first, so a field a provider returned invalid is taken from the
+// next one.
+type Chain struct {
+	providers []Provider
+}
+
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{providers: providers}
+}
+
+func (c *Chain) Name() string {
+	return "chain"
+}
+
+func (c *Chain) FetchSongDetails(ctx utils.MyContext, group, song string) (models.SongDetails, error) {
+	merged := models.SongDetails{Sources: make(map[string]string)}
+
+	var errs []error
+	for _, provider := range c.providers {
+		details, err := provider.FetchSongDetails(ctx, group, song)
+		if err != nil {
+			ctx.Logger.Warnf("provider %s failed to fetch song details: %v", provider.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+
+		details, repairs := Normalize(details)
+		for _, repair := range repairs {
+			ctx.Logger.Warnf("provider %s returned %s %s: %s", provider.Name(), repair.Action, repair.Field, repair.Reason)
+			repair.Provider, repair.Group, repair.Title = provider.Name(), group, song
+			merged.Repairs = append(merged.Repairs, repair)
+		}
+
+		mergeField(&merged, &merged.ReleaseDate, details.ReleaseDate, FieldReleaseDate, provider.Name())
+		mergeField(&merged, &merged.Text, details.Text, FieldText, provider.Name())
+		mergeField(&merged, &merged.Link, details.Link, FieldLink, provider.Name())
+
+		if merged.ReleaseDate != "" && merged.Text != "" && merged.Link != "" {
+			break
+		}
+	}
+
+	// repairs are returned with the error too, so that rejected fields that
+	// left nothing to use can still be reported
+	if len(merged.Sources) == 0 {
+		if len(errs) == 0 {
+			return models.SongDetails{Repairs: merged.Repairs}, ErrNotFound
+		}
+		return models.SongDetails{Repairs: merged.Repairs}, chainError(errors.Join(errs...))
+	}
+
+	return merged, nil
+}
+
+// chainError classifies the joined errors of all providers: not found when
+// every provider answered so, unavailable when a provider was overloaded or
+// its circuit breaker open, and an upstream error otherwise.
+func chainError(err error) error {
+	var overload *OverloadError
+	switch {
+	case IsNotFound(err):
+		return ErrNotFound
+	case errors.As(err, &overload):
+		return utils.NewUnavailableError(utils.CodeDetailsUnavailable, "song details providers are overloaded", overload.RetryAfter(), err)
+	case errors.Is(err, ErrCircuitOpen):
+		return utils.NewUnavailableError(utils.CodeDetailsUnavailable, "song details providers are unavailable", 0, err)
+	default:
+		return utils.NewUpstreamError(utils.CodeDetailsUpstream, "song details providers failed", err)
+	}
+}
+
+func mergeField(merged *models.SongDetails, field *string, value, name, provider string) {
+	if *field != "" || value == "" {
+		return
+	}
+
+	*field = value
+	merged.Sources[name] = provider
+}
+
+func (c *Chain) Status() []models.ProviderStatus {
+	var statuses []models.ProviderStatus
+	for _, provider := range c.providers {
+		if reporter, ok := provider.(StatusReporter); ok {
+			statuses = append(statuses, reporter.Status()...)
+			continue
+		}
+		statuses = append(statuses, models.ProviderStatus{Name: provider.Name()})
+	}
+
+	return statuses
+}
@@ -0,0 +1,104 @@
+package details
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/utils"
+)
+
+type stubProvider struct {
+	name    string
+	details models.SongDetails
+	err     error
+	calls   int
+}
+
+func (p *stubProvider) Name() string {
+	return p.name
+}
+
+func (p *stubProvider) FetchSongDetails(_ utils.MyContext, _, _ string) (models.SongDetails, error) {
+	p.calls++
+	return p.details, p.err
+}
+
+func testContext() utils.MyContext {
+	return utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+}
+
+func TestChainMergesFields(t *testing.T) {
+	primary := &stubProvider{name: "primary", details: models.SongDetails{Text: "lyrics"}}
+	broken := &stubProvider{name: "broken", err: errors.New("connection refused")}
+	secondary := &stubProvider{name: "secondary", details: models.SongDetails{Text: "other", ReleaseDate: "16.07.2006", Link: "http://example.com"}}
+	unused := &stubProvider{name: "unused"}
+
+	result, err := NewChain(primary, broken, secondary, unused).FetchSongDetails(testContext(), "group", "song")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := models.SongDetails{
+		ReleaseDate: "16.07.2006",
+		Text:        "lyrics",
+		Link:        "http://example.com",
+		Sources: map[string]string{
+			FieldReleaseDate: "secondary",
+			FieldText:        "primary",
+			FieldLink:        "secondary",
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("FetchSongDetails() = %+v, want %+v", result, expected)
+	}
+	if unused.calls != 0 {
+		t.Errorf("expected the chain to stop once all fields are filled")
+	}
+}
+
+func TestChainErrors(t *testing.T) {
+	notFound := &stubProvider{name: "primary", err: ErrNotFound}
+	failing := &stubProvider{name: "secondary", err: errors.New("timeout")}
+
+	_, err := NewChain(notFound).FetchSongDetails(testContext(), "group", "song")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	_, err = NewChain(notFound, failing).FetchSongDetails(testContext(), "group", "song")
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected errors of every provider, got %v", err)
+	}
+	if IsNotFound(err) {
+		t.Errorf("expected a failing provider not to count as not found")
+	}
+	if kind := utils.KindOf(err); kind != utils.KindUpstream {
+		t.Errorf("expected an upstream error, got kind %d", kind)
+	}
+
+	_, err = NewChain(notFound, &stubProvider{name: "fallback", err: ErrNotFound}).FetchSongDetails(testContext(), "group", "song")
+	if !IsNotFound(err) {
+		t.Errorf("expected not found from every provider to count as not found, got %v", err)
+	}
+}
+
+func TestChainOverloaded(t *testing.T) {
+	overloaded := &stubProvider{name: "primary", err: &OverloadError{Provider: "primary", Reason: "queue is full", retryAfter: 3 * time.Second}}
+	failing := &stubProvider{name: "secondary", err: errors.New("timeout")}
+
+	_, err := NewChain(overloaded, failing).FetchSongDetails(testContext(), "group", "song")
+
+	var domainErr *utils.Error
+	if !errors.As(err, &domainErr) || domainErr.Kind != utils.KindUnavailable {
+		t.Fatalf("expected an unavailable error, got %v", err)
+	}
+	if domainErr.RetryAfter != 3*time.Second {
+		t.Errorf("RetryAfter = %s, want 3s", domainErr.RetryAfter)
+	}
+}
@@ -0,0 +1,283 @@
+package details
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/utils"
+)
+
+// ErrOverloaded is wrapped by the errors of a Limiter that cannot take more
+// requests.
+var ErrOverloaded = errors.New("details provider is overloaded")
+
+// OverloadError is returned when the wait queue of a Limiter is full or a
+// request waited in it for too long. RetryAfter estimates when a new request
+// would get through.
+type OverloadError struct {
+	Provider   string
+	Reason     string
+	retryAfter time.Duration
+}
+
+func (e *OverloadError) Error() string {
+	return fmt.Sprintf("%s: %s %s, retry after %s", ErrOverloaded, e.Provider, e.Reason, e.retryAfter)
+}
+
+func (e *OverloadError) Unwrap() error {
+	return ErrOverloaded
+}
+
+func (e *OverloadError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// LimiterConfig sets the request rate and concurrency allowed toward one
+// provider. Zero Rate or MaxInFlight disables that limit. Up to MaxQueue
+// requests wait for their turn, each for at most MaxWait.
+type LimiterConfig struct {
+	Rate        float64
+	Burst       int
+	MaxInFlight int
+	MaxQueue    int
+	MaxWait     time.Duration
+}
+
+// Limiter combines a token bucket with a cap on requests in flight. Requests
+// over the limits wait in a bounded queue instead of failing right away.
+type Limiter struct {
+	cfg   LimiterConfig
+	slots chan struct{}
+
+	mu       sync.Mutex
+	tokens   float64
+	last     time.Time
+	queued   int
+	rejected int64
+}
+
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	l := &Limiter{cfg: cfg, tokens: float64(max(cfg.Burst, 1)), last: time.Now()}
+	if cfg.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+
+	return l
+}
+
+// Acquire waits until a request may be sent and returns the function that
+// marks it finished. It fails with an *OverloadError when the queue is full or
+// the wait exceeds MaxWait, and with the context error when ctx is done.
+func (l *Limiter) Acquire(ctx context.Context, provider string) (func(), error) {
+	l.mu.Lock()
+	if l.queued >= l.cfg.MaxQueue && !l.idle() {
+		l.rejected++
+		retryAfter := l.estimateWait(l.queued + 1)
+		l.mu.Unlock()
+		return nil, &OverloadError{Provider: provider, Reason: "queue is full", retryAfter: retryAfter}
+	}
+	l.queued++
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.queued--
+		l.mu.Unlock()
+	}()
+
+	waitCtx := ctx
+	if l.cfg.MaxWait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, l.cfg.MaxWait)
+		defer cancel()
+	}
+
+	overloaded := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.rejected++
+		return &OverloadError{Provider: provider, Reason: "wait timed out", retryAfter: l.estimateWait(l.queued)}
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-waitCtx.Done():
+			return nil, overloaded()
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	if wait := l.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-waitCtx.Done():
+			l.cancelReservation()
+			release()
+			return nil, overloaded()
+		}
+	}
+
+	return release, nil
+}
+
+// idle reports whether a request would go through without waiting, so that a
+// zero MaxQueue still lets requests under the limits pass.
+func (l *Limiter) idle() bool {
+	l.refill(time.Now())
+	freeSlot := l.slots == nil || len(l.slots) < cap(l.slots)
+	return freeSlot && (l.cfg.Rate <= 0 || l.tokens >= 1)
+}
+
+// reserve takes a token, going into debt if the bucket is empty, and returns
+// how long to wait until the token is actually available.
+func (l *Limiter) reserve() time.Duration {
+	if l.cfg.Rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.cfg.Rate * float64(time.Second))
+}
+
+func (l *Limiter) cancelReservation() {
+	if l.cfg.Rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+func (l *Limiter) refill(now time.Time) {
+	if l.cfg.Rate <= 0 {
+		return
+	}
+
+	l.tokens = math.Min(float64(max(l.cfg.Burst, 1)), l.tokens+now.Sub(l.last).Seconds()*l.cfg.Rate)
+	l.last = now
+}
+
+// estimateWait guesses how long the given number of queued requests take to
+// drain at the configured rate. Without a rate limit it falls back to one second.
+func (l *Limiter) estimateWait(queued int) time.Duration {
+	if l.cfg.Rate <= 0 {
+		return time.Second
+	}
+
+	wait := time.Duration(float64(queued) / l.cfg.Rate * float64(time.Second))
+	return max(wait.Round(time.Second), time.Second)
+}
+
+func (l *Limiter) Status() models.LimiterStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return models.LimiterStatus{
+		InFlight: len(l.slots),
+		Queued:   l.queued,
+		Rejected: l.rejected,
+	}
+}
+
+// LimitedTransport sends every request, retries included, through a Limiter.
+// It goes below RetryTransport, so that each attempt takes its own token and
+// the limits hold while an upstream is failing. A request keeps its slot until
+// its response body is closed.
+type LimitedTransport struct {
+	next     http.RoundTripper
+	limiter  *Limiter
+	provider string
+}
+
+func NewLimitedTransport(next http.RoundTripper, limiter *Limiter, provider string) *LimitedTransport {
+	return &LimitedTransport{next: next, limiter: limiter, provider: provider}
+}
+
+func (t *LimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.Acquire(req.Context(), t.provider)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// LimitedProvider reports the status of the Limiter that the HTTP client of a
+// provider sends its requests through.
+type LimitedProvider struct {
+	provider Provider
+	limiter  *Limiter
+}
+
+func NewLimitedProvider(provider Provider, limiter *Limiter) *LimitedProvider {
+	return &LimitedProvider{provider: provider, limiter: limiter}
+}
+
+func (p *LimitedProvider) Name() string {
+	return p.provider.Name()
+}
+
+func (p *LimitedProvider) FetchSongDetails(ctx utils.MyContext, group, song string) (models.SongDetails, error) {
+	return p.provider.FetchSongDetails(ctx, group, song)
+}
+
+func (p *LimitedProvider) Status() []models.ProviderStatus {
+	statuses := []models.ProviderStatus{{Name: p.Name()}}
+	if reporter, ok := p.provider.(StatusReporter); ok {
+		statuses = reporter.Status()
+	}
+
+	limiter := p.limiter.Status()
+	for i := range statuses {
+		statuses[i].Limiter = &limiter
+	}
+
+	return statuses
+}
@@ -0,0 +1,94 @@
+package details
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterRate(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{Rate: 20, Burst: 2, MaxQueue: 10, MaxWait: time.Second})
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		release, err := limiter.Acquire(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		release()
+	}
+
+	// the burst of 2 passes at once, the other 2 wait 50ms each
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("4 requests at 20/s with burst 2 took %s, want at least 100ms", elapsed)
+	}
+}
+
+func TestLimiterQueueFull(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{MaxInFlight: 1, MaxQueue: 0, MaxWait: time.Second})
+
+	release, err := limiter.Acquire(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	_, err = limiter.Acquire(context.Background(), "test")
+
+	var overload *OverloadError
+	if !errors.As(err, &overload) || !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected an overload error, got %v", err)
+	}
+	if overload.RetryAfter() < time.Second {
+		t.Errorf("RetryAfter() = %s, want at least 1s", overload.RetryAfter())
+	}
+	if status := limiter.Status(); status.InFlight != 1 || status.Rejected != 1 {
+		t.Errorf("Status() = %+v", status)
+	}
+}
+
+func TestLimiterWaitBounds(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{MaxInFlight: 1, MaxQueue: 5, MaxWait: 20 * time.Millisecond})
+
+	release, err := limiter.Acquire(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = limiter.Acquire(context.Background(), "test"); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("expected the wait to time out with an overload error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = limiter.Acquire(ctx, "test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+
+	release()
+
+	next, err := limiter.Acquire(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("expected the released slot to be reused, got %v", err)
+	}
+	next()
+
+	if status := limiter.Status(); status.InFlight != 0 || status.Queued != 0 {
+		t.Errorf("Status() = %+v, want nothing in flight or queued", status)
+	}
+}
+
+func TestLimitedProviderStatus(t *testing.T) {
+	breaker := NewBreakerProvider(&stubProvider{name: "primary"}, NewBreaker(3, time.Second))
+	provider := NewLimitedProvider(breaker, NewLimiter(LimiterConfig{MaxInFlight: 2}))
+
+	if _, err := provider.FetchSongDetails(testContext(), "group", "song"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	statuses := NewChain(provider).Status()
+	if len(statuses) != 1 || statuses[0].Limiter == nil || statuses[0].Breaker.State == "" {
+		t.Errorf("Status() = %+v, want breaker and limiter status", statuses)
+	}
+}
@@ -0,0 +1,187 @@
+package details
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+
+	"effectiveMobileTest/models"
+)
+
+// Actions recorded in models.DetailsRepair.
+const (
+	RepairRepaired = "repaired"
+	RepairRejected = "rejected"
+)
+
+// releaseDateLayout is the release date format of the details API, which the
+// rest of the service expects.
+const releaseDateLayout = "02.01.2006"
+
+// releaseDateLayouts are the other date formats seen from providers. Slashed
+// dates are read as month first, as US sources write them.
+var releaseDateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006/01/02",
+	"01/02/2006",
+	"2.1.2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// Normalize validates details returned by a provider and brings them into
+// canonical form: NFC text with \n line endings, HTML entities decoded, one
+// blank line between verses, absolute http(s) links with lowercase host and
+// no default port, and DD.MM.YYYY dates.
+// Fields that cannot be fixed are cleared, so that another provider may fill
+// them. Every change is reported as a repair.
+func Normalize(details models.SongDetails) (models.SongDetails, []models.DetailsRepair) {
+	var repairs []models.DetailsRepair
+	record := func(field, action, reason, original string) {
+		repairs = append(repairs, models.DetailsRepair{Field: field, Action: action, Reason: reason, Original: original})
+	}
+
+	if details.ReleaseDate != "" {
+		date, reason, ok := normalizeReleaseDate(details.ReleaseDate)
+		switch {
+		case !ok:
+			record(FieldReleaseDate, RepairRejected, reason, details.ReleaseDate)
+			date = ""
+		case date != details.ReleaseDate:
+			record(FieldReleaseDate, RepairRepaired, reason, details.ReleaseDate)
+		}
+		details.ReleaseDate = date
+	}
+
+	if details.Text != "" {
+		text, reasons := normalizeText(details.Text)
+		switch {
+		case text == "":
+			record(FieldText, RepairRejected, "empty lyrics", details.Text)
+		case len(reasons) > 0:
+			record(FieldText, RepairRepaired, strings.Join(reasons, ", "), details.Text)
+		}
+		details.Text = text
+	}
+
+	if details.Link != "" {
+		link, reason, ok := normalizeLink(details.Link)
+		switch {
+		case !ok:
+			record(FieldLink, RepairRejected, reason, details.Link)
+			link = ""
+		case link != details.Link:
+			record(FieldLink, RepairRepaired, reason, details.Link)
+		}
+		details.Link = link
+	}
+
+	return details, repairs
+}
+
+func normalizeReleaseDate(value string) (string, string, bool) {
+	value = strings.TrimSpace(value)
+
+	if date, err := time.Parse(releaseDateLayout, value); err == nil {
+		return date.Format(releaseDateLayout), "whitespace", true
+	}
+
+	for _, layout := range releaseDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Format(releaseDateLayout), "date format " + layout, true
+		}
+	}
+
+	// Unix timestamps in seconds; shorter numbers are more likely years.
+	if len(value) >= 9 {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC().Format(releaseDateLayout), "unix timestamp", true
+		}
+	}
+
+	return "", "unrecognized date format", false
+}
+
+func normalizeText(text string) (string, []string) {
+	var reasons []string
+	apply := func(reason string, fix func(string) string) {
+		if fixed := fix(text); fixed != text {
+			text = fixed
+			reasons = append(reasons, reason)
+		}
+	}
+
+	apply("html entities", html.UnescapeString)
+	apply("line endings", func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+	})
+	apply("trailing whitespace", func(s string) string {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, " \t\u00a0")
+		}
+		return strings.Join(lines, "\n")
+	})
+	apply("verse separators", func(s string) string {
+		return strings.Trim(blankLines.ReplaceAllString(s, "\n\n"), "\n")
+	})
+	// last, as unescaped entities may form combining sequences
+	apply("unicode normalization", norm.NFC.String)
+
+	if strings.TrimSpace(text) == "" {
+		return "", reasons
+	}
+
+	return text, reasons
+}
+
+func normalizeLink(value string) (string, string, bool) {
+	var reasons []string
+
+	link := strings.TrimSpace(value)
+	if link != value {
+		reasons = append(reasons, "whitespace")
+	}
+
+	if !strings.Contains(link, "://") && strings.Contains(strings.SplitN(link, "/", 2)[0], ".") {
+		link = "https://" + link
+		reasons = append(reasons, "missing scheme")
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", "invalid URL", false
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", "unsupported URL scheme", false
+	}
+	if parsed.Hostname() == "" {
+		return "", "URL without host", false
+	}
+
+	parsed.Host = strings.ToLower(parsed.Host)
+	if port := parsed.Port(); (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		parsed.Host = parsed.Hostname()
+		if strings.Contains(parsed.Host, ":") {
+			// keeps the brackets of an IPv6 address
+			parsed.Host = "[" + parsed.Host + "]"
+		}
+	}
+
+	canonical := parsed.String()
+	if canonical != link {
+		reasons = append(reasons, "canonical form")
+	}
+
+	return canonical, strings.Join(reasons, ", "), true
+}
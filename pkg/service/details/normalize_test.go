@@ -0,0 +1,120 @@
+package details
+
+import (
+	"testing"
+
+	"effectiveMobileTest/models"
+)
+
+func TestNormalizeReleaseDate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		action   string
+	}{
+		{"16.07.2006", "16.07.2006", ""},
+		{" 16.07.2006 ", "16.07.2006", RepairRepaired},
+		{"2006-07-16", "16.07.2006", RepairRepaired},
+		{"07/16/2006", "16.07.2006", RepairRepaired},
+		{"July 16, 2006", "16.07.2006", RepairRepaired},
+		{"1153008000", "16.07.2006", RepairRepaired},
+		{"sometime in 2006", "", RepairRejected},
+		{"2006", "", RepairRejected},
+	}
+
+	for _, test := range tests {
+		result, repairs := Normalize(models.SongDetails{ReleaseDate: test.input})
+		if result.ReleaseDate != test.expected {
+			t.Errorf("Normalize(%q).ReleaseDate = %q, want %q", test.input, result.ReleaseDate, test.expected)
+		}
+		if action := repairAction(repairs, FieldReleaseDate); action != test.action {
+			t.Errorf("Normalize(%q) recorded %q, want %q", test.input, action, test.action)
+		}
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		action   string
+	}{
+		{"line one\nline two\n\nline three", "line one\nline two\n\nline three", ""},
+		{"line one\r\nline two  \r\n\r\n\r\n\r\nline three\r\n", "line one\nline two\n\nline three", RepairRepaired},
+		{"Rock &amp; Roll", "Rock & Roll", RepairRepaired},
+		{"Cafe\u0301", "Caf\u00e9", RepairRepaired},
+		{"Cafe&#x301;", "Caf\u00e9", RepairRepaired},
+		{" \r\n\n ", "", RepairRejected},
+	}
+
+	for _, test := range tests {
+		result, repairs := Normalize(models.SongDetails{Text: test.input})
+		if result.Text != test.expected {
+			t.Errorf("Normalize(%q).Text = %q, want %q", test.input, result.Text, test.expected)
+		}
+		if action := repairAction(repairs, FieldText); action != test.action {
+			t.Errorf("Normalize(%q) recorded %q, want %q", test.input, action, test.action)
+		}
+	}
+}
+
+func TestNormalizeLink(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		action   string
+	}{
+		{"https://www.youtube.com/watch?v=Xsp3_a-PMTw", "https://www.youtube.com/watch?v=Xsp3_a-PMTw", ""},
+		{" HTTPS://WWW.YouTube.com:443/watch?v=1 ", "https://www.youtube.com/watch?v=1", RepairRepaired},
+		{"http://example.com:80/song#chorus", "http://example.com/song#chorus", RepairRepaired},
+		{"example.com/song", "https://example.com/song", RepairRepaired},
+		{"https://[::1]:443/song", "https://[::1]/song", RepairRepaired},
+		{"http://[2001:DB8::1]:8080/song", "http://[2001:db8::1]:8080/song", RepairRepaired},
+		{"ftp://example.com/song.mp3", "", RepairRejected},
+		{"javascript:alert(1)", "", RepairRejected},
+		{"/relative/path", "", RepairRejected},
+	}
+
+	for _, test := range tests {
+		result, repairs := Normalize(models.SongDetails{Link: test.input})
+		if result.Link != test.expected {
+			t.Errorf("Normalize(%q).Link = %q, want %q", test.input, result.Link, test.expected)
+		}
+		if action := repairAction(repairs, FieldLink); action != test.action {
+			t.Errorf("Normalize(%q) recorded %q, want %q", test.input, action, test.action)
+		}
+	}
+}
+
+func TestChainFallsBackOnRejectedField(t *testing.T) {
+	primary := &stubProvider{name: "primary", details: models.SongDetails{Text: "lyrics", ReleaseDate: "soon", Link: "https://example.com"}}
+	secondary := &stubProvider{name: "secondary", details: models.SongDetails{ReleaseDate: "2006-07-16"}}
+
+	result, err := NewChain(primary, secondary).FetchSongDetails(testContext(), "group", "song")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.ReleaseDate != "16.07.2006" || result.Sources[FieldReleaseDate] != "secondary" {
+		t.Errorf("expected the release date from the secondary provider, got %+v", result)
+	}
+	if len(result.Repairs) != 2 {
+		t.Fatalf("expected 2 repairs, got %+v", result.Repairs)
+	}
+	if repair := result.Repairs[0]; repair.Provider != "primary" || repair.Action != RepairRejected || repair.Group != "group" {
+		t.Errorf("unexpected first repair: %+v", repair)
+	}
+	if repair := result.Repairs[1]; repair.Provider != "secondary" || repair.Action != RepairRepaired {
+		t.Errorf("unexpected second repair: %+v", repair)
+	}
+}
+
+func repairAction(repairs []models.DetailsRepair, field string) string {
+	for _, repair := range repairs {
+		if repair.Field == field {
+			return repair.Action
+		}
+	}
+
+	return ""
+}
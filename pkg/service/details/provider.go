@@ -0,0 +1,141 @@
+package details
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/pkg/metrics"
+	"effectiveMobileTest/pkg/tracing"
+	"effectiveMobileTest/utils"
+)
+
+// ErrNotFound is returned by providers that do not know the requested song.
+var ErrNotFound error = utils.NewNotFoundError(utils.CodeDetailsNotFound, "song details not found")
+
+// IsNotFound reports whether err means that every provider answered it does not
+// know the song. Errors joined by Chain count only if none of them is an outage,
+// and ErrNotFound wrapped in an error of another kind does not count.
+func IsNotFound(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err = range joined.Unwrap() {
+			if !IsNotFound(err) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return errors.Is(err, ErrNotFound) && utils.KindOf(err) == utils.KindNotFound
+}
+
+// Provider looks up release date, lyrics and link of a song in an external source.
+type Provider interface {
+	Name() string
+	FetchSongDetails(ctx utils.MyContext, group, song string) (models.SongDetails, error)
+}
+
+// HTTPProvider fetches song details from an API answering with a JSON
+// models.SongDetails object. The URL is either a base URL, to which the
+// /info?group=&song= path is appended, or a template with {group} and {song}
+// placeholders.
+type HTTPProvider struct {
+	name        string
+	urlTemplate string
+	client      *http.Client
+}
+
+func NewHTTPProvider(name, urlTemplate string, client *http.Client) *HTTPProvider {
+	return &HTTPProvider{
+		name:        name,
+		urlTemplate: urlTemplate,
+		client:      client,
+	}
+}
+
+func (p *HTTPProvider) Name() string {
+	return p.name
+}
+
+// FetchSongDetails requests the details in a client span and records the
+// latency and outcome of the request.
+func (p *HTTPProvider) FetchSongDetails(ctx utils.MyContext, group, song string) (models.SongDetails, error) {
+	ctx, span := tracing.Start(ctx, "details."+p.name, trace.SpanKindClient, attribute.String("details.provider", p.name))
+
+	start := time.Now()
+	details, err := p.fetch(ctx, group, song)
+	result := outcome(ctx, err)
+	metrics.ObserveDetailsRequest(p.name, result, time.Since(start))
+
+	span.SetAttributes(attribute.String("details.outcome", result))
+	if result == metrics.OutcomeNotFound {
+		span.End()
+	} else {
+		tracing.End(span, err)
+	}
+
+	return details, err
+}
+
+func (p *HTTPProvider) fetch(ctx utils.MyContext, group, song string) (models.SongDetails, error) {
+	requestUrl := p.url(group, song)
+
+	ctx.Logger.Debugf("fetching song details from provider %s: URL=%s", p.name, requestUrl)
+
+	req, err := http.NewRequestWithContext(ctx.Ctx, http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return models.SongDetails{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	otel.GetTextMapPropagator().Inject(ctx.Ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return models.SongDetails{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return models.SongDetails{}, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return models.SongDetails{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var details models.SongDetails
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		return models.SongDetails{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return details, nil
+}
+
+func outcome(ctx utils.MyContext, err error) string {
+	switch {
+	case err == nil:
+		return metrics.OutcomeSuccess
+	case errors.Is(err, ErrNotFound):
+		return metrics.OutcomeNotFound
+	case ctx.Ctx.Err() != nil:
+		return metrics.OutcomeCanceled
+	default:
+		return metrics.OutcomeError
+	}
+}
+
+func (p *HTTPProvider) url(group, song string) string {
+	if strings.Contains(p.urlTemplate, "{group}") || strings.Contains(p.urlTemplate, "{song}") {
+		return strings.NewReplacer("{group}", url.QueryEscape(group), "{song}", url.QueryEscape(song)).Replace(p.urlTemplate)
+	}
+
+	return fmt.Sprintf("%s/info?group=%s&song=%s", strings.TrimSuffix(p.urlTemplate, "/"), url.QueryEscape(group), url.QueryEscape(song))
+}
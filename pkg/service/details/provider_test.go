@@ -0,0 +1,51 @@
+package details
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/pkg/tracing"
+	"effectiveMobileTest/utils"
+)
+
+func TestHTTPProviderInjectsTraceparent(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"releaseDate":"16.07.2006","text":"Ooh baby","link":"https://example.com"}`))
+	}))
+	defer server.Close()
+
+	ctx, parent := tracing.Start(utils.NewMyContext(context.Background(), zap.NewNop().Sugar()), "test", trace.SpanKindInternal)
+	provider := NewHTTPProvider("test", server.URL, server.Client())
+	if _, err := provider.FetchSongDetails(ctx, "Muse", "Supermassive Black Hole"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	ended := spans.Ended()
+	if len(ended) != 2 || ended[0].Name() != "details.test" {
+		t.Fatalf("expected the provider span and its parent, got %d spans", len(ended))
+	}
+	client := ended[0].SpanContext()
+	want := "00-" + client.TraceID().String() + "-" + client.SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("traceparent = %q, want %q", traceparent, want)
+	}
+	if ended[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected the provider span to be a child of the caller's span")
+	}
+}
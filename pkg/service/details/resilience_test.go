@@ -0,0 +1,168 @@
+package details
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(http.DefaultTransport, RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxRetryAfter:  time.Second,
+	})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("got status %d after %d calls, want 200 after 3 calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestRetryTransportGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/later" {
+			w.Header().Set("Retry-After", "120")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(http.DefaultTransport, RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxRetryAfter:  time.Second,
+	})}
+
+	tests := []struct {
+		path  string
+		calls int32
+	}{
+		{path: "/", calls: 2},
+		{path: "/later", calls: 1},
+	}
+
+	for _, tt := range tests {
+		calls.Store(0)
+
+		resp, err := client.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != tt.calls {
+			t.Errorf("%s: got status %d after %d calls, want 503 after %d calls", tt.path, resp.StatusCode, calls.Load(), tt.calls)
+		}
+	}
+
+	calls.Store(0)
+	resp, err := client.Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if calls.Load() != 1 {
+		t.Errorf("expected non-idempotent requests not to be retried, got %d calls", calls.Load())
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("expected closed breaker to allow calls, got %v", err)
+		}
+		breaker.Record(false)
+	}
+
+	if err := breaker.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("expected open breaker to reject calls, got %v", err)
+	}
+	if state := breaker.Status().State; state != BreakerOpen {
+		t.Errorf("state = %s, want %s", state, BreakerOpen)
+	}
+
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected a trial call after the timeout, got %v", err)
+	}
+	if err := breaker.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("expected a single trial call, got %v", err)
+	}
+
+	breaker.Record(false)
+	if state := breaker.Status().State; state != BreakerOpen {
+		t.Errorf("state after failed trial = %s, want %s", state, BreakerOpen)
+	}
+
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected a trial call after the timeout, got %v", err)
+	}
+	breaker.Record(true)
+
+	if status := breaker.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("status after successful trial = %+v, want closed", status)
+	}
+}
+
+func TestRetryTransportAttemptsTakeTokens(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	limiter := NewLimiter(LimiterConfig{Rate: 1, Burst: 2, MaxInFlight: 1, MaxQueue: 0})
+	client := &http.Client{Transport: NewRetryTransport(NewLimitedTransport(http.DefaultTransport, limiter, "test"), RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxRetryAfter:  time.Second,
+	})}
+
+	// the burst of 2 lets two attempts through, the third is turned away
+	// instead of reaching the upstream
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected an overload error, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("upstream got %d calls, want 2", calls.Load())
+	}
+	if status := limiter.Status(); status.InFlight != 0 {
+		t.Errorf("Status() = %+v, want nothing in flight", status)
+	}
+}
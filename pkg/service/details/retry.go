@@ -0,0 +1,105 @@
+package details
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures RetryTransport. MaxRetryAfter caps how long a
+// Retry-After header is honored; an upstream asking to wait longer gets its
+// response returned instead of being retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	MaxRetryAfter  time.Duration
+}
+
+// RetryTransport retries idempotent requests that failed with a network
+// error, 429 or a 5xx status. Waits grow exponentially with full jitter, and a
+// Retry-After header from the upstream takes precedence over the backoff.
+type RetryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+}
+
+func NewRetryTransport(next http.RoundTripper, policy RetryPolicy) *RetryTransport {
+	return &RetryTransport{next: next, policy: policy}
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.policy.MaxAttempts || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if retryAfter > t.policy.MaxRetryAfter {
+					return resp, nil
+				}
+				wait = retryAfter
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	backoff := t.policy.InitialBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > t.policy.MaxBackoff {
+		backoff = t.policy.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// an overloaded limiter already waited as long as it may
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrOverloaded)
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
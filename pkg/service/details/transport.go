@@ -0,0 +1,194 @@
+package details
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransportConfig describes the connection to the details providers. Empty
+// fields keep the defaults of http.DefaultTransport; without ProxyURL the
+// HTTP_PROXY/HTTPS_PROXY environment variables are used.
+type TransportConfig struct {
+	ProxyURL            string
+	CAFile              string
+	ClientCertFile      string
+	ClientKeyFile       string
+	ConnectTimeout      time.Duration
+	TLSHandshakeTimeout time.Duration
+	ResponseTimeout     time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+}
+
+// NewTransport builds the transport for requests to the details providers.
+// The CA bundle is added to the system roots rather than replacing them.
+func NewTransport(cfg TransportConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.ResponseTimeout > 0 {
+		transport.ResponseHeaderTimeout = cfg.ResponseTimeout
+	}
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+func newTLSConfig(cfg TransportConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Header is a header added to every request to the details providers. Its
+// value is either Value or the trimmed contents of File, prefixed with Prefix
+// (e.g. "Bearer "). File is read again whenever it changes, so rotated tokens
+// are picked up without a restart.
+type Header struct {
+	Name   string
+	Value  string
+	File   string
+	Prefix string
+}
+
+// HeaderTransport sets static or file-based headers, such as API tokens, on
+// outgoing requests.
+type HeaderTransport struct {
+	next    http.RoundTripper
+	headers []Header
+	files   map[string]*fileValue
+}
+
+func NewHeaderTransport(next http.RoundTripper, headers []Header) (*HeaderTransport, error) {
+	t := &HeaderTransport{next: next, headers: headers, files: make(map[string]*fileValue)}
+
+	for _, header := range headers {
+		if header.File == "" {
+			continue
+		}
+		value := &fileValue{path: header.File}
+		if _, err := value.Get(); err != nil {
+			return nil, fmt.Errorf("failed to read %s header: %w", header.Name, err)
+		}
+		t.files[header.File] = value
+	}
+
+	return t, nil
+}
+
+func (t *HeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	for _, header := range t.headers {
+		value := header.Value
+		if header.File != "" {
+			var err error
+			if value, err = t.files[header.File].Get(); err != nil {
+				return nil, fmt.Errorf("failed to read %s header: %w", header.Name, err)
+			}
+		}
+		req.Header.Set(header.Name, header.Prefix+value)
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// fileValue caches the contents of a secret file until its modification time
+// changes.
+type fileValue struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	value   string
+}
+
+func (f *fileValue) Get() (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !info.ModTime().Equal(f.modTime) || f.modTime.IsZero() {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return "", err
+		}
+		f.value = strings.TrimSpace(string(data))
+		f.modTime = info.ModTime()
+	}
+
+	return f.value, nil
+}
@@ -0,0 +1,98 @@
+package details
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewTransportTrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	transport, err := NewTransport(TransportConfig{CAFile: caFile, ConnectTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with CA bundle failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err = http.Get(server.URL); err == nil {
+		t.Errorf("expected the default transport not to trust the test server")
+	}
+}
+
+func TestNewTransportErrors(t *testing.T) {
+	if _, err := NewTransport(TransportConfig{CAFile: "missing.pem"}); err == nil {
+		t.Errorf("expected an error for a missing CA bundle")
+	}
+	if _, err := NewTransport(TransportConfig{ClientCertFile: "cert.pem"}); err == nil {
+		t.Errorf("expected an error for a client certificate without a key")
+	}
+	if _, err := NewTransport(TransportConfig{ProxyURL: "://proxy"}); err == nil {
+		t.Errorf("expected an error for an invalid proxy URL")
+	}
+}
+
+func TestHeaderTransportReloadsFiles(t *testing.T) {
+	var got []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Clone())
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	transport, err := NewHeaderTransport(http.DefaultTransport, []Header{
+		{Name: "X-Api-Key", Value: "static"},
+		{Name: "Authorization", File: tokenFile, Prefix: "Bearer "},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if err = os.WriteFile(tokenFile, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err = os.Chtimes(tokenFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got[0].Get("X-Api-Key") != "static" || got[0].Get("Authorization") != "Bearer first" {
+		t.Errorf("first request headers = %v", got[0])
+	}
+	if got[1].Get("Authorization") != "Bearer second" {
+		t.Errorf("expected the rotated token, got %q", got[1].Get("Authorization"))
+	}
+}
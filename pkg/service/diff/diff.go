@@ -0,0 +1,158 @@
+package diff
+
+// Op is the kind of change an Edit describes.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+func (o Op) String() string {
+	switch o {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+// Edit is one step of an edit script turning a into b. OldIndex points into a
+// for Equal and Delete edits, NewIndex points into b for Equal and Insert edits;
+// the other index is -1.
+type Edit struct {
+	Op       Op
+	OldIndex int
+	NewIndex int
+}
+
+// Diff returns the shortest edit script between a and b. It uses the linear
+// space variant of Myers' O(ND) algorithm, so memory stays proportional to the
+// input size and time to the input size multiplied by the number of changes.
+// Within a changed block deletions always come before insertions.
+func Diff[T comparable](a, b []T) []Edit {
+	size := (len(a)+len(b)+1)/2 + 1
+	d := differ[T]{
+		a:        a,
+		b:        b,
+		deleted:  make([]bool, len(a)),
+		inserted: make([]bool, len(b)),
+		vf:       make([]int, 2*size+1),
+		vb:       make([]int, 2*size+1),
+		offset:   size,
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	edits := make([]Edit, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			edits = append(edits, Edit{Op: Delete, OldIndex: i, NewIndex: -1})
+			i++
+		case j < len(b) && d.inserted[j]:
+			edits = append(edits, Edit{Op: Insert, OldIndex: -1, NewIndex: j})
+			j++
+		default:
+			edits = append(edits, Edit{Op: Equal, OldIndex: i, NewIndex: j})
+			i++
+			j++
+		}
+	}
+
+	return edits
+}
+
+type differ[T comparable] struct {
+	a, b     []T
+	deleted  []bool
+	inserted []bool
+	vf, vb   []int
+	offset   int
+}
+
+func (d *differ[T]) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aHi > aLo && bHi > bLo && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+	default:
+		x, y := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+}
+
+// middleSnake finds a point on a shortest edit path between a[aLo:aHi] and
+// b[bLo:bHi] that splits the path into two halves of roughly equal cost. The
+// ranges must differ at both ends, so each half is strictly smaller.
+func (d *differ[T]) middleSnake(aLo, aHi, bLo, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta&1 != 0
+	vf, vb, off := d.vf, d.vb, d.offset
+
+	vf[off+1] = 0
+	vb[off+1] = 0
+
+	for depth := 0; depth <= (n+m+1)/2; depth++ {
+		for k := -depth; k <= depth; k += 2 {
+			var x int
+			if k == -depth || (k != depth && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+
+			if odd && k >= delta-(depth-1) && k <= delta+(depth-1) && x+vb[off+delta-k] >= n {
+				return aLo + startX, bLo + startY
+			}
+		}
+
+		for k := -depth; k <= depth; k += 2 {
+			var x int
+			if k == -depth || (k != depth && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+
+			if !odd && delta-k >= -depth && delta-k <= depth && x+vf[off+delta-k] >= n {
+				return aHi - x, bHi - y
+			}
+		}
+	}
+
+	// unreachable for ranges that differ at both ends
+	return aLo + n/2, bLo + m/2
+}
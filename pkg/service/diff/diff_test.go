@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func apply(a, b []string, edits []Edit) ([]string, []string) {
+	var oldSide, newSide []string
+	for _, edit := range edits {
+		switch edit.Op {
+		case Equal:
+			if a[edit.OldIndex] != b[edit.NewIndex] {
+				return nil, nil
+			}
+			oldSide = append(oldSide, a[edit.OldIndex])
+			newSide = append(newSide, b[edit.NewIndex])
+		case Delete:
+			oldSide = append(oldSide, a[edit.OldIndex])
+		case Insert:
+			newSide = append(newSide, b[edit.NewIndex])
+		}
+	}
+	return oldSide, newSide
+}
+
+func cost(edits []Edit) int {
+	n := 0
+	for _, edit := range edits {
+		if edit.Op != Equal {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		cost int
+	}{
+		{a: "", b: "", cost: 0},
+		{a: "abc", b: "abc", cost: 0},
+		{a: "", b: "abc", cost: 3},
+		{a: "abc", b: "", cost: 3},
+		{a: "abcabba", b: "cbabac", cost: 5},
+		{a: "kitten", b: "sitting", cost: 5},
+	}
+
+	for _, tt := range tests {
+		a, b := strings.Split(tt.a, ""), strings.Split(tt.b, "")
+		edits := Diff(a, b)
+
+		oldSide, newSide := apply(a, b, edits)
+		if len(oldSide) != len(a) || len(newSide) != len(b) {
+			t.Errorf("Diff(%q, %q) does not reproduce the inputs", tt.a, tt.b)
+		}
+		if cost(edits) != tt.cost {
+			t.Errorf("Diff(%q, %q) cost = %d, want %d", tt.a, tt.b, cost(edits), tt.cost)
+		}
+	}
+}
+
+func TestDiffRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "c", "d"}
+
+	for i := 0; i < 500; i++ {
+		a := make([]string, rnd.Intn(40))
+		b := make([]string, rnd.Intn(40))
+		for j := range a {
+			a[j] = alphabet[rnd.Intn(len(alphabet))]
+		}
+		for j := range b {
+			b[j] = alphabet[rnd.Intn(len(alphabet))]
+		}
+
+		edits := Diff(a, b)
+		oldSide, newSide := apply(a, b, edits)
+		if len(oldSide) != len(a) || len(newSide) != len(b) {
+			t.Fatalf("Diff(%v, %v) does not reproduce the inputs", a, b)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); cost(edits) != want {
+			t.Fatalf("Diff(%v, %v) cost = %d, want %d", a, b, cost(edits), want)
+		}
+	}
+}
+
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestWords(t *testing.T) {
+	segments := Words("Группа крови на рукаве", "Группа крови — на рукаве!")
+
+	var oldText, newText strings.Builder
+	for _, segment := range segments {
+		if segment.Op != Insert {
+			oldText.WriteString(segment.Text)
+		}
+		if segment.Op != Delete {
+			newText.WriteString(segment.Text)
+		}
+	}
+
+	if oldText.String() != "Группа крови на рукаве" || newText.String() != "Группа крови — на рукаве!" {
+		t.Errorf("Words() = %+v does not reproduce the inputs", segments)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := []string{"one", "two", "three", "four", "five", "six", "seven", "eight"}
+	b := []string{"one", "two", "3", "four", "five", "six", "seven", "eight", "nine"}
+
+	result := Unified(a, b, Diff(a, b), "a", "b", 1)
+	expected := "--- a\n+++ b\n" +
+		"@@ -2,3 +2,3 @@\n two\n-three\n+3\n four\n" +
+		"@@ -8 +8,2 @@\n eight\n+nine\n"
+
+	if result != expected {
+		t.Errorf("Unified() =\n%s\nwant\n%s", result, expected)
+	}
+}
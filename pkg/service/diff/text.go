@@ -0,0 +1,145 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Segment is a run of text with the same Op in a word-level diff.
+type Segment struct {
+	Op   Op
+	Text string
+}
+
+// Words diffs two lines word by word. Whitespace and punctuation are kept as
+// separate tokens, so joining the Equal and Insert segments reproduces b and
+// joining the Equal and Delete segments reproduces a.
+func Words(a, b string) []Segment {
+	aTokens, bTokens := tokenize(a), tokenize(b)
+
+	var segments []Segment
+	for _, edit := range Diff(aTokens, bTokens) {
+		text := ""
+		if edit.Op == Insert {
+			text = bTokens[edit.NewIndex]
+		} else {
+			text = aTokens[edit.OldIndex]
+		}
+
+		if last := len(segments) - 1; last >= 0 && segments[last].Op == edit.Op {
+			segments[last].Text += text
+			continue
+		}
+		segments = append(segments, Segment{Op: edit.Op, Text: text})
+	}
+
+	return segments
+}
+
+const (
+	wordToken = iota
+	spaceToken
+	punctToken
+)
+
+func tokenize(s string) []string {
+	var (
+		tokens []string
+		start  = -1
+		class  int
+	)
+
+	for i, r := range s {
+		current := punctToken
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			current = wordToken
+		} else if unicode.IsSpace(r) {
+			current = spaceToken
+		}
+
+		if start >= 0 && (current != class || class == punctToken) {
+			tokens = append(tokens, s[start:i])
+			start = -1
+		}
+		if start < 0 {
+			start = i
+			class = current
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, s[start:])
+	}
+
+	return tokens
+}
+
+// Unified renders a line-level edit script between a and b as a unified diff
+// with the given number of context lines around each change.
+func Unified(a, b []string, edits []Edit, fromName, toName string, context int) string {
+	var out strings.Builder
+
+	oldPos := make([]int, len(edits)+1)
+	newPos := make([]int, len(edits)+1)
+	for i, edit := range edits {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if edit.Op != Insert {
+			oldPos[i+1]++
+		}
+		if edit.Op != Delete {
+			newPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+
+		start := max(i-context, 0)
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].Op != Equal {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*context {
+				break
+			}
+		}
+		end = min(end+context, len(edits))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldPos[start], oldPos[end]-oldPos[start]),
+			hunkRange(newPos[start], newPos[end]-newPos[start]))
+
+		for _, edit := range edits[start:end] {
+			switch edit.Op {
+			case Equal:
+				out.WriteString(" " + a[edit.OldIndex] + "\n")
+			case Delete:
+				out.WriteString("-" + a[edit.OldIndex] + "\n")
+			case Insert:
+				out.WriteString("+" + b[edit.NewIndex] + "\n")
+			}
+		}
+
+		i = end
+	}
+
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
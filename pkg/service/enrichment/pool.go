@@ -0,0 +1,89 @@
+// Package enrichment runs the background workers that fetch details of songs
+// accepted in asynchronous mode and the scheduled refresh of stale details.
+package enrichment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"effectiveMobileTest/utils"
+)
+
+// Processor handles one due enrichment job. It reports false when there was
+// no job to handle.
+type Processor interface {
+	EnrichNext(ctx utils.MyContext) (bool, error)
+}
+
+// Pool polls the enrichment queue with a fixed number of workers. A worker
+// keeps taking jobs while there are any and sleeps for the poll interval once
+// the queue is empty or an error occurs.
+type Pool struct {
+	processor    Processor
+	workers      int
+	pollInterval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewPool(processor Processor, workers int, pollInterval time.Duration) *Pool {
+	return &Pool{
+		processor:    processor,
+		workers:      max(workers, 1),
+		pollInterval: pollInterval,
+	}
+}
+
+// Start launches the workers. They run until Stop is called or ctx is done.
+func (p *Pool) Start(ctx utils.MyContext) {
+	workerCtx, cancel := context.WithCancel(ctx.Ctx)
+	p.cancel = cancel
+
+	ctx.Logger.Infof("starting %d enrichment workers", p.workers)
+
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.run(utils.NewMyContext(workerCtx, ctx.Logger.With("worker", i+1)))
+	}
+}
+
+// Stop signals the workers to exit and waits for the jobs in progress to finish.
+// Jobs interrupted by the canceled context are picked up again after their lease.
+func (p *Pool) Stop() {
+	if p.cancel == nil {
+		return
+	}
+
+	p.cancel()
+	p.wg.Wait()
+}
+
+func (p *Pool) run(ctx utils.MyContext) {
+	defer p.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		for ctx.Ctx.Err() == nil {
+			processed, err := p.processor.EnrichNext(ctx)
+			if err != nil {
+				ctx.Logger.Errorf("failed to process enrichment job: %v", err)
+				break
+			}
+			if !processed {
+				break
+			}
+		}
+
+		timer.Reset(p.pollInterval)
+	}
+}
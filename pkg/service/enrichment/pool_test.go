@@ -0,0 +1,74 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/utils"
+)
+
+type fakeProcessor struct {
+	mu    sync.Mutex
+	jobs  int
+	calls int
+	fail  bool
+}
+
+func (p *fakeProcessor) EnrichNext(utils.MyContext) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.fail {
+		return false, errors.New("boom")
+	}
+	if p.jobs == 0 {
+		return false, nil
+	}
+	p.jobs--
+	return true, nil
+}
+
+func (p *fakeProcessor) remaining() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.jobs, p.calls
+}
+
+func TestPoolDrainsQueue(t *testing.T) {
+	processor := &fakeProcessor{jobs: 10}
+	pool := NewPool(processor, 3, time.Hour)
+	pool.Start(utils.NewMyContext(context.Background(), zap.NewNop().Sugar()))
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if jobs, _ := processor.remaining(); jobs == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queue was not drained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	pool.Stop()
+}
+
+func TestPoolBacksOffOnError(t *testing.T) {
+	processor := &fakeProcessor{fail: true}
+	pool := NewPool(processor, 1, time.Hour)
+	pool.Start(utils.NewMyContext(context.Background(), zap.NewNop().Sugar()))
+
+	time.Sleep(20 * time.Millisecond)
+	pool.Stop()
+
+	if _, calls := processor.remaining(); calls != 1 {
+		t.Errorf("calls = %d, want 1 before the poll interval elapses", calls)
+	}
+}
@@ -0,0 +1,71 @@
+package enrichment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"effectiveMobileTest/utils"
+)
+
+// Refresher refreshes the details of songs that were enriched too long ago.
+type Refresher interface {
+	RefreshStale(ctx utils.MyContext) error
+}
+
+// Scheduler runs the stale details refresh periodically, the first time one
+// interval after Start.
+type Scheduler struct {
+	refresher Refresher
+	interval  time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(refresher Refresher, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		refresher: refresher,
+		interval:  interval,
+	}
+}
+
+// Start launches the scheduler. It runs until Stop is called or ctx is done.
+func (s *Scheduler) Start(ctx utils.MyContext) {
+	schedulerCtx, cancel := context.WithCancel(ctx.Ctx)
+	s.cancel = cancel
+
+	ctx.Logger.Infof("scheduling details refresh every %s", s.interval)
+
+	s.wg.Add(1)
+	go s.run(utils.NewMyContext(schedulerCtx, ctx.Logger))
+}
+
+// Stop cancels the scheduler and waits for a running refresh to return.
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run(ctx utils.MyContext) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.refresher.RefreshStale(ctx); err != nil {
+			ctx.Logger.Errorf("failed to refresh stale song details: %v", err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package lyrics
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	verseSeparator = "\n\n"
+	lineSeparator  = "\n"
+)
+
+// Hit is an occurrence of a phrase in lyrics. Verse is the 1-based index of the
+// verse in the same split GetLyrics paginates by, Line is the 1-based line
+// within that verse where the phrase starts.
+type Hit struct {
+	Verse int
+	Line  int
+	Text  string
+}
+
+// Verses splits lyrics into verses the same way verse pagination does.
+func Verses(text string) []string {
+	return strings.Split(text, verseSeparator)
+}
+
+// Tokens splits text into lowercase words, folding ё into е and dropping
+// punctuation, so that phrases compare regardless of case and punctuation.
+func Tokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Words returns the tokens of text with ё folded into е.
+func Words(text string) []string {
+	tokens := Tokens(text)
+	for i, token := range tokens {
+		tokens[i] = normalizeToken(token)
+	}
+
+	return tokens
+}
+
+func normalizeToken(token string) string {
+	return strings.ReplaceAll(token, "ё", "е")
+}
+
+// SearchText returns the form of text stored for phrase lookups: normalized
+// tokens separated and surrounded by single spaces, so that a phrase built with
+// SearchText matches only on word boundaries.
+func SearchText(text string) string {
+	return " " + strings.Join(Words(text), " ") + " "
+}
+
+// Find returns every occurrence of phrase in text. The phrase may span lines
+// and verses; a hit is reported at the line where it starts.
+func Find(text, phrase string) []Hit {
+	needle := Words(phrase)
+	if len(needle) == 0 {
+		return nil
+	}
+
+	type position struct {
+		verse, line int
+		text        string
+	}
+
+	var (
+		tokens    []string
+		positions []position
+	)
+	for v, verse := range Verses(text) {
+		for l, line := range strings.Split(verse, lineSeparator) {
+			for _, token := range Tokens(line) {
+				tokens = append(tokens, normalizeToken(token))
+				positions = append(positions, position{verse: v + 1, line: l + 1, text: line})
+			}
+		}
+	}
+
+	var hits []Hit
+	for i := 0; i+len(needle) <= len(tokens); i++ {
+		if !matchAt(tokens[i:], needle) {
+			continue
+		}
+
+		hit := Hit{Verse: positions[i].verse, Line: positions[i].line, Text: positions[i].text}
+		if len(hits) > 0 && hits[len(hits)-1] == hit {
+			continue
+		}
+		hits = append(hits, hit)
+	}
+
+	return hits
+}
+
+func matchAt(tokens, needle []string) bool {
+	for i, token := range needle {
+		if tokens[i] != token {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package lyrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+const song = `Теплое место, но улицы ждут
+Отпечатков наших ног.
+
+Звездная пыль на сапогах,
+Мягкое кресло, клетчатый плед.
+
+Группа крови на рукаве,
+Мой порядковый номер на рукаве.
+Пожелай мне удачи в бою, пожелай мне
+Не остаться в этой траве.`
+
+func TestSearchText(t *testing.T) {
+	result := SearchText("Ёлки-палки, ЛЕС  густой!")
+	expected := " елки палки лес густой "
+
+	if result != expected {
+		t.Errorf("SearchText() = %q, want %q", result, expected)
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		phrase   string
+		expected []Hit
+	}{
+		{
+			phrase:   "группа крови, на рукаве!",
+			expected: []Hit{{Verse: 3, Line: 1, Text: "Группа крови на рукаве,"}},
+		},
+		{
+			phrase: "на рукаве",
+			expected: []Hit{
+				{Verse: 3, Line: 1, Text: "Группа крови на рукаве,"},
+				{Verse: 3, Line: 2, Text: "Мой порядковый номер на рукаве."},
+			},
+		},
+		{
+			phrase:   "пожелай мне не остаться",
+			expected: []Hit{{Verse: 3, Line: 3, Text: "Пожелай мне удачи в бою, пожелай мне"}},
+		},
+		{
+			phrase:   "ЗВЕЗДНАЯ ПЫЛЬ",
+			expected: []Hit{{Verse: 2, Line: 1, Text: "Звездная пыль на сапогах,"}},
+		},
+		{
+			phrase:   "звёздная пыль",
+			expected: []Hit{{Verse: 2, Line: 1, Text: "Звездная пыль на сапогах,"}},
+		},
+		{
+			phrase:   "кровь",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		result := Find(song, tt.phrase)
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Find(%q) = %+v, want %+v", tt.phrase, result, tt.expected)
+		}
+	}
+}
@@ -3,20 +3,151 @@ package mappers
 import (
 	"effectiveMobileTest/models"
 	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/pkg/service/lyrics"
+	"effectiveMobileTest/pkg/service/similarity"
 )
 
 func MapFromSongs(repositorySongs []dbmodels.Song) []models.Song {
 	serviceSongs := make([]models.Song, len(repositorySongs))
 	for i, repositorySong := range repositorySongs {
 		serviceSongs[i] = models.Song{
-			Id:          repositorySong.Id,
-			Group:       repositorySong.Group,
-			Title:       repositorySong.Title,
-			ReleaseDate: repositorySong.ReleaseDate,
-			Text:        repositorySong.Text,
-			Link:        repositorySong.Link,
+			Id:               repositorySong.Id,
+			Group:            repositorySong.Group,
+			Title:            repositorySong.Title,
+			ReleaseDate:      repositorySong.ReleaseDate.Time,
+			Text:             repositorySong.Text,
+			Link:             repositorySong.Link,
+			DetailsSources:   repositorySong.DetailsSources,
+			EnrichmentStatus: repositorySong.EnrichmentStatus,
+			EnrichmentError:  repositorySong.EnrichmentError,
+			EnrichedAt:       repositorySong.EnrichedAt,
 		}
 	}
 
 	return serviceSongs
 }
+
+func MapFromDetailsCacheEntry(entry dbmodels.DetailsCacheEntry) models.SongDetails {
+	return models.SongDetails{
+		ReleaseDate: entry.ReleaseDate,
+		Text:        entry.Text,
+		Link:        entry.Link,
+		Sources:     entry.DetailsSources,
+	}
+}
+
+func MapFromLyricsRevisions(repositoryRevisions []dbmodels.LyricsRevision) []models.LyricsRevision {
+	serviceRevisions := make([]models.LyricsRevision, len(repositoryRevisions))
+	for i, repositoryRevision := range repositoryRevisions {
+		serviceRevisions[i] = models.LyricsRevision{
+			Revision:  repositoryRevision.Revision,
+			CreatedAt: repositoryRevision.CreatedAt,
+		}
+	}
+
+	return serviceRevisions
+}
+
+func MapFromLookupResult(repositorySong dbmodels.Song, hits []lyrics.Hit) models.LyricsLookupResult {
+	result := models.LyricsLookupResult{
+		SongId: repositorySong.Id,
+		Group:  repositorySong.Group,
+		Title:  repositorySong.Title,
+		Hits:   make([]models.LyricsHit, len(hits)),
+	}
+	for i, hit := range hits {
+		result.Hits[i] = models.LyricsHit{
+			Verse: hit.Verse,
+			Line:  hit.Line,
+			Text:  hit.Text,
+		}
+	}
+
+	return result
+}
+
+func MapFromMatches(matches []similarity.Match) []models.SimilarSong {
+	serviceSongs := make([]models.SimilarSong, len(matches))
+	for i, match := range matches {
+		serviceSongs[i] = models.SimilarSong{
+			Id:          match.Document.Id,
+			Group:       match.Document.Group,
+			Title:       match.Document.Title,
+			ReleaseDate: match.Document.ReleaseDate,
+			Score:       match.Score,
+		}
+	}
+
+	return serviceSongs
+}
+
+func MapFromAnnotations(repositoryAnnotations []dbmodels.Annotation) []models.Annotation {
+	serviceAnnotations := make([]models.Annotation, len(repositoryAnnotations))
+	for i, repositoryAnnotation := range repositoryAnnotations {
+		serviceAnnotations[i] = models.Annotation{
+			Id:        repositoryAnnotation.Id,
+			SongId:    repositoryAnnotation.SongId,
+			Verse:     repositoryAnnotation.Verse,
+			Line:      repositoryAnnotation.Line,
+			Start:     repositoryAnnotation.StartChar,
+			End:       repositoryAnnotation.EndChar,
+			Quote:     repositoryAnnotation.Quote,
+			Author:    repositoryAnnotation.Author,
+			Body:      repositoryAnnotation.Body,
+			Orphaned:  repositoryAnnotation.Orphaned,
+			CreatedAt: repositoryAnnotation.CreatedAt,
+		}
+	}
+
+	return serviceAnnotations
+}
+
+func MapFromAnchor(repositoryAnnotation dbmodels.Annotation) models.AnnotationAnchor {
+	return models.AnnotationAnchor{
+		Id:    repositoryAnnotation.Id,
+		Verse: repositoryAnnotation.Verse,
+		Line:  repositoryAnnotation.Line,
+		Start: repositoryAnnotation.StartChar,
+		End:   repositoryAnnotation.EndChar,
+	}
+}
+
+func MapFromDetailsRepairs(repositoryRepairs []dbmodels.DetailsRepair) []models.DetailsRepair {
+	repairs := make([]models.DetailsRepair, len(repositoryRepairs))
+	for i, repair := range repositoryRepairs {
+		repairs[i] = models.DetailsRepair{
+			Provider:  repair.Provider,
+			Group:     repair.Group,
+			Title:     repair.Title,
+			Field:     repair.Field,
+			Action:    repair.Action,
+			Reason:    repair.Reason,
+			Original:  repair.Original,
+			CreatedAt: repair.CreatedAt,
+		}
+	}
+
+	return repairs
+}
+
+func MapFromAPIKey(key dbmodels.APIKey) models.APIKey {
+	return models.APIKey{
+		Id:         key.Id,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func MapFromAPIKeys(repositoryKeys []dbmodels.APIKey) []models.APIKey {
+	keys := make([]models.APIKey, len(repositoryKeys))
+	for i, key := range repositoryKeys {
+		keys[i] = MapFromAPIKey(key)
+	}
+
+	return keys
+}
@@ -1,11 +1,19 @@
 package mappers
 
 import (
+	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"effectiveMobileTest/models"
 	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/pkg/service/annotations"
+	"effectiveMobileTest/pkg/service/details"
+	"effectiveMobileTest/pkg/service/lyrics"
+	"effectiveMobileTest/pkg/service/similarity"
+	"effectiveMobileTest/pkg/service/translit"
+	"effectiveMobileTest/utils"
 )
 
 func MapUpdateToSong(id string, updateSong models.UpdateSongRequest) dbmodels.Song {
@@ -13,32 +21,188 @@ func MapUpdateToSong(id string, updateSong models.UpdateSongRequest) dbmodels.So
 		Id:          id,
 		Group:       updateSong.Group,
 		Title:       updateSong.Title,
-		ReleaseDate: updateSong.ReleaseDate,
+		ReleaseDate: mapToNullDate(updateSong.ReleaseDate),
 		Text:        updateSong.Text,
 		Link:        updateSong.Link,
+		GroupSearch: MapToSearchKeys(updateSong.Group),
+		TitleSearch: MapToSearchKeys(updateSong.Title),
+		TextSearch:  MapToTextSearch(updateSong.Text),
 	}
 }
 
+// MapDetailsToSong builds a song from normalized song details. The release
+// date is DD.MM.YYYY and may be missing if no provider returned a valid one.
 func MapDetailsToSong(req models.AddSongRequest, details models.SongDetails) (dbmodels.Song, error) {
-	parsedDate, err := time.Parse("02.01.2006", details.ReleaseDate)
-	if err != nil {
-		return dbmodels.Song{}, fmt.Errorf("invalid release date format: %w", err)
+	var parsedDate time.Time
+	if details.ReleaseDate != "" {
+		var err error
+		if parsedDate, err = time.Parse("02.01.2006", details.ReleaseDate); err != nil {
+			return dbmodels.Song{}, fmt.Errorf("invalid release date format: %w", err)
+		}
 	}
 
-	return dbmodels.Song{
-		Id:          "",
-		Group:       req.Group,
-		Title:       req.Title,
-		ReleaseDate: parsedDate,
-		Text:        details.Text,
-		Link:        details.Link,
-	}, nil
+	song := dbmodels.Song{
+		Id:               "",
+		Group:            req.Group,
+		Title:            req.Title,
+		ReleaseDate:      mapToNullDate(parsedDate),
+		Text:             details.Text,
+		Link:             details.Link,
+		GroupSearch:      MapToSearchKeys(req.Group),
+		TitleSearch:      MapToSearchKeys(req.Title),
+		TextSearch:       lyrics.SearchText(details.Text),
+		DetailsSources:   details.Sources,
+		EnrichmentStatus: models.EnrichmentEnriched,
+	}
+	song.EnrichedDetails = MapToEnrichedDetails(song)
+
+	return song, nil
+}
+
+// MapRequestToSong builds a song from the fields supplied by the client,
+// recording them in the details sources. The release date is YYYY-MM-DD.
+func MapRequestToSong(req models.AddSongRequest) (dbmodels.Song, error) {
+	song := dbmodels.Song{
+		Group:          req.Group,
+		Title:          req.Title,
+		Text:           req.Text,
+		Link:           req.Link,
+		GroupSearch:    MapToSearchKeys(req.Group),
+		TitleSearch:    MapToSearchKeys(req.Title),
+		TextSearch:     lyrics.SearchText(req.Text),
+		DetailsSources: make(dbmodels.DetailsSources),
+	}
+
+	if req.ReleaseDate != "" {
+		parsedDate, err := time.Parse("2006-01-02", req.ReleaseDate)
+		if err != nil {
+			return dbmodels.Song{}, utils.NewValidationError("invalid release date format, try yyyy-mm-dd",
+				utils.FieldError{Field: "releaseDate", Message: "must be in yyyy-mm-dd format"})
+		}
+		song.ReleaseDate = mapToNullDate(parsedDate)
+		song.DetailsSources[details.FieldReleaseDate] = models.DetailsSourceClient
+	}
+	if req.Text != "" {
+		song.DetailsSources[details.FieldText] = models.DetailsSourceClient
+	}
+	if req.Link != "" {
+		song.DetailsSources[details.FieldLink] = models.DetailsSourceClient
+	}
+
+	return song, nil
+}
+
+// MergeDetails fills the details fields of a song with fetched details,
+// keeping the fields supplied by the client. The fetched values become the
+// enrichment snapshot, so client-supplied values that differ from them count
+// as manual edits and are kept on refresh.
+func MergeDetails(song dbmodels.Song, fetched models.SongDetails) (dbmodels.Song, error) {
+	clientSupplied := func(field string) bool {
+		return song.DetailsSources[field] == models.DetailsSourceClient
+	}
+
+	sources := make(dbmodels.DetailsSources)
+	for field, source := range song.DetailsSources {
+		if source == models.DetailsSourceClient {
+			sources[field] = source
+		}
+	}
+
+	snapshot := dbmodels.EnrichedDetails{Text: fetched.Text, Link: fetched.Link}
+
+	if fetched.ReleaseDate != "" {
+		parsedDate, err := time.Parse("02.01.2006", fetched.ReleaseDate)
+		switch {
+		case err == nil:
+			snapshot.ReleaseDate = parsedDate.Format("2006-01-02")
+			if !clientSupplied(details.FieldReleaseDate) {
+				song.ReleaseDate = mapToNullDate(parsedDate)
+				sources[details.FieldReleaseDate] = fetched.Sources[details.FieldReleaseDate]
+			}
+		case !clientSupplied(details.FieldReleaseDate):
+			return dbmodels.Song{}, fmt.Errorf("invalid release date format: %w", err)
+		}
+	}
+	if fetched.Text != "" && !clientSupplied(details.FieldText) {
+		song.Text = fetched.Text
+		sources[details.FieldText] = fetched.Sources[details.FieldText]
+	}
+	if fetched.Link != "" && !clientSupplied(details.FieldLink) {
+		song.Link = fetched.Link
+		sources[details.FieldLink] = fetched.Sources[details.FieldLink]
+	}
+
+	song.TextSearch = lyrics.SearchText(song.Text)
+	song.DetailsSources = sources
+	song.EnrichedDetails = snapshot
+
+	return song, nil
+}
+
+// MissingDetails reports whether the client left any details field empty.
+func MissingDetails(req models.AddSongRequest) bool {
+	return req.ReleaseDate == "" || req.Text == "" || req.Link == ""
+}
+
+// MapToEnrichedDetails takes the details fields of a song in the form kept as
+// its enrichment snapshot.
+func MapToEnrichedDetails(song dbmodels.Song) dbmodels.EnrichedDetails {
+	details := dbmodels.EnrichedDetails{Text: song.Text, Link: song.Link}
+	if song.ReleaseDate.Valid {
+		details.ReleaseDate = song.ReleaseDate.Time.Format("2006-01-02")
+	}
+
+	return details
+}
+
+// MapRefreshToSong sets the details fields of a song to refreshed values.
+func MapRefreshToSong(song dbmodels.Song, refreshed dbmodels.EnrichedDetails) (dbmodels.Song, error) {
+	if refreshed.ReleaseDate != "" {
+		parsedDate, err := time.Parse("2006-01-02", refreshed.ReleaseDate)
+		if err != nil {
+			return dbmodels.Song{}, fmt.Errorf("invalid release date format: %w", err)
+		}
+		song.ReleaseDate = mapToNullDate(parsedDate)
+	}
+
+	song.Text = refreshed.Text
+	song.Link = refreshed.Link
+	song.TextSearch = lyrics.SearchText(refreshed.Text)
+
+	return song, nil
+}
+
+// MapToRefreshFilter selects the songs of a refresh request. Songs enriched
+// at or after enrichedBefore are skipped unless it is zero.
+func MapToRefreshFilter(req models.RefreshSongsRequest, enrichedBefore time.Time, limit int) dbmodels.RefreshFilter {
+	return dbmodels.RefreshFilter{
+		Ids:            req.Ids,
+		Group:          req.Group,
+		Title:          req.Title,
+		GroupKeys:      mapToFilterKeys(req.Group),
+		TitleKeys:      mapToFilterKeys(req.Title),
+		EnrichedBefore: enrichedBefore,
+		Limit:          limit,
+	}
+}
+
+func MapToDetailsCacheEntry(groupKey, titleKey string, details models.SongDetails) dbmodels.DetailsCacheEntry {
+	return dbmodels.DetailsCacheEntry{
+		GroupKey:       groupKey,
+		TitleKey:       titleKey,
+		ReleaseDate:    details.ReleaseDate,
+		Text:           details.Text,
+		Link:           details.Link,
+		DetailsSources: details.Sources,
+	}
 }
 
 func MapToFilter(serviceFilter models.SongFilter) dbmodels.SongFilter {
 	return dbmodels.SongFilter{
 		Group:       serviceFilter.Group,
 		Title:       serviceFilter.Title,
+		GroupKeys:   mapToFilterKeys(serviceFilter.Group),
+		TitleKeys:   mapToFilterKeys(serviceFilter.Title),
 		ReleaseDate: serviceFilter.ReleaseDate,
 		Text:        serviceFilter.Text,
 		Link:        serviceFilter.Link,
@@ -46,3 +210,101 @@ func MapToFilter(serviceFilter models.SongFilter) dbmodels.SongFilter {
 		Limit:       serviceFilter.Limit,
 	}
 }
+
+// mapToNullDate stores a missing release date as NULL rather than as the zero
+// time.
+func mapToNullDate(date time.Time) sql.NullTime {
+	return sql.NullTime{Time: date, Valid: !date.IsZero()}
+}
+
+// MapToSearchKeys joins the transliterated search keys of a group or title
+// into the form stored in the songs table.
+func MapToSearchKeys(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return strings.Join(translit.Keys(value), "\n")
+}
+
+func mapToFilterKeys(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return translit.Keys(value)
+}
+
+// MapToTextSearch returns the normalized form of lyrics used by phrase lookups,
+// or an empty string when text is not being changed.
+func MapToTextSearch(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	return lyrics.SearchText(text)
+}
+
+func MapToLookupFilter(serviceFilter models.LyricsLookupFilter) dbmodels.LyricsLookupFilter {
+	return dbmodels.LyricsLookupFilter{
+		Phrase: lyrics.SearchText(serviceFilter.Query),
+		Page:   serviceFilter.Page,
+		Limit:  serviceFilter.Limit,
+	}
+}
+
+func MapToDocument(song dbmodels.Song) similarity.Document {
+	return similarity.Document{
+		Id:          song.Id,
+		Group:       song.Group,
+		Title:       song.Title,
+		ReleaseDate: song.ReleaseDate.Time,
+		Text:        song.Text,
+	}
+}
+
+func MapAddToAnnotation(songId string, req models.AddAnnotationRequest, quote string) dbmodels.Annotation {
+	return dbmodels.Annotation{
+		SongId:    songId,
+		Verse:     req.Verse,
+		Line:      req.Line,
+		StartChar: req.Start,
+		EndChar:   req.End,
+		Quote:     quote,
+		Author:    req.Author,
+		Body:      req.Body,
+	}
+}
+
+func MapToAnchor(annotation dbmodels.Annotation) annotations.Anchor {
+	return annotations.Anchor{
+		Verse: annotation.Verse,
+		Line:  annotation.Line,
+		Start: annotation.StartChar,
+		End:   annotation.EndChar,
+	}
+}
+
+func MapToDetailsRepairs(repairs []models.DetailsRepair) []dbmodels.DetailsRepair {
+	repositoryRepairs := make([]dbmodels.DetailsRepair, len(repairs))
+	for i, repair := range repairs {
+		repositoryRepairs[i] = dbmodels.DetailsRepair{
+			Provider: repair.Provider,
+			Group:    repair.Group,
+			Title:    repair.Title,
+			Field:    repair.Field,
+			Action:   repair.Action,
+			Reason:   repair.Reason,
+			Original: repair.Original,
+		}
+	}
+
+	return repositoryRepairs
+}
+
+func MapToDetailsRepairFilter(filter models.DetailsRepairFilter) dbmodels.DetailsRepairFilter {
+	return dbmodels.DetailsRepairFilter{
+		Provider: filter.Provider,
+		Limit:    filter.Limit,
+	}
+}
@@ -1,6 +1,7 @@
 package mappers
 
 import (
+	"database/sql"
 	"testing"
 	"time"
 
@@ -22,7 +23,7 @@ func TestMapUpdateToSong(t *testing.T) {
 		Id:          "123",
 		Group:       "Test Group",
 		Title:       "Test Title",
-		ReleaseDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ReleaseDate: sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
 		Text:        "Some lyrics",
 		Link:        "http://example.com",
 	}
@@ -30,7 +31,7 @@ func TestMapUpdateToSong(t *testing.T) {
 	result := MapUpdateToSong(id, input)
 
 	if result.Id != expected.Id || result.Group != expected.Group || result.Title != expected.Title ||
-		!result.ReleaseDate.Equal(expected.ReleaseDate) || result.Text != expected.Text || result.Link != expected.Link {
+		!result.ReleaseDate.Time.Equal(expected.ReleaseDate.Time) || result.Text != expected.Text || result.Link != expected.Link {
 		t.Errorf("MapUpdateToSong() = %+v, want %+v", result, expected)
 	}
 }
@@ -51,7 +52,7 @@ func TestMapDetailsToSong(t *testing.T) {
 		Id:          "",
 		Group:       "Test Group",
 		Title:       "Test Title",
-		ReleaseDate: expectedDate,
+		ReleaseDate: sql.NullTime{Time: expectedDate, Valid: true},
 		Text:        "Some lyrics",
 		Link:        "http://example.com",
 	}
@@ -62,9 +63,96 @@ func TestMapDetailsToSong(t *testing.T) {
 	}
 
 	if result.Id != expected.Id || result.Group != expected.Group || result.Title != expected.Title ||
-		!result.ReleaseDate.Equal(expected.ReleaseDate) || result.Text != expected.Text || result.Link != expected.Link {
+		!result.ReleaseDate.Time.Equal(expected.ReleaseDate.Time) || result.Text != expected.Text || result.Link != expected.Link {
 		t.Errorf("MapDetailsToSong() = %+v, want %+v", result, expected)
 	}
+
+	details.ReleaseDate = ""
+	if result, err = MapDetailsToSong(req, details); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ReleaseDate.Valid {
+		t.Errorf("expected a missing release date to be NULL, got %v", result.ReleaseDate)
+	}
+}
+
+func TestMapRefreshToSong(t *testing.T) {
+	song := dbmodels.Song{
+		Id:          "123",
+		ReleaseDate: sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		Text:        "Old lyrics",
+		Link:        "http://example.com/old",
+	}
+
+	enriched := MapToEnrichedDetails(song)
+	if enriched.ReleaseDate != "2024-01-01" || enriched.Text != song.Text || enriched.Link != song.Link {
+		t.Fatalf("MapToEnrichedDetails() = %+v", enriched)
+	}
+
+	enriched.ReleaseDate = "2023-05-06"
+	enriched.Text = "New lyrics"
+
+	result, err := MapRefreshToSong(song, enriched)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Id != song.Id || !result.ReleaseDate.Time.Equal(time.Date(2023, 5, 6, 0, 0, 0, 0, time.UTC)) ||
+		result.Text != "New lyrics" || result.Link != song.Link || result.TextSearch == "" {
+		t.Errorf("MapRefreshToSong() = %+v", result)
+	}
+}
+
+func TestMergeDetails(t *testing.T) {
+	req := models.AddSongRequest{
+		Group:       "Test Group",
+		Title:       "Test Title",
+		ReleaseDate: "2020-02-03",
+		Text:        "Own lyrics",
+	}
+
+	song, err := MapRequestToSong(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !MissingDetails(req) {
+		t.Errorf("expected the link to be reported missing")
+	}
+
+	fetched := models.SongDetails{
+		ReleaseDate: "not a date",
+		Text:        "Fetched lyrics",
+		Link:        "http://example.com",
+		Sources:     map[string]string{"releaseDate": "api", "text": "api", "link": "api"},
+	}
+
+	result, err := MergeDetails(song, fetched)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !result.ReleaseDate.Time.Equal(time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC)) || result.Text != "Own lyrics" ||
+		result.Link != "http://example.com" {
+		t.Errorf("MergeDetails() = %+v", result)
+	}
+
+	expectedSources := dbmodels.DetailsSources{"releaseDate": "client", "text": "client", "link": "api"}
+	if len(result.DetailsSources) != len(expectedSources) {
+		t.Fatalf("sources = %v, want %v", result.DetailsSources, expectedSources)
+	}
+	for field, source := range expectedSources {
+		if result.DetailsSources[field] != source {
+			t.Errorf("sources = %v, want %v", result.DetailsSources, expectedSources)
+		}
+	}
+
+	if result.EnrichedDetails.Text != "Fetched lyrics" {
+		t.Errorf("expected the fetched lyrics in the snapshot, got %+v", result.EnrichedDetails)
+	}
+
+	if _, err = MergeDetails(dbmodels.Song{}, fetched); err == nil {
+		t.Errorf("expected an error for an invalid fetched release date")
+	}
 }
 
 func TestMapToFilter(t *testing.T) {
@@ -102,7 +190,7 @@ func TestMapFromSongs(t *testing.T) {
 			Id:          "123",
 			Group:       "Group 1",
 			Title:       "Song 1",
-			ReleaseDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			ReleaseDate: sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
 			Text:        "Lyrics 1",
 			Link:        "http://example1.com",
 		},
@@ -110,7 +198,7 @@ func TestMapFromSongs(t *testing.T) {
 			Id:          "456",
 			Group:       "Group 2",
 			Title:       "Song 2",
-			ReleaseDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			ReleaseDate: sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
 			Text:        "Lyrics 2",
 			Link:        "http://example2.com",
 		},
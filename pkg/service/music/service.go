@@ -1,71 +1,206 @@
 package music
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
-	"net/url"
+	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"effectiveMobileTest/models"
 	"effectiveMobileTest/pkg/repository"
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/pkg/service/annotations"
+	"effectiveMobileTest/pkg/service/details"
+	"effectiveMobileTest/pkg/service/diff"
+	"effectiveMobileTest/pkg/service/lyrics"
 	"effectiveMobileTest/pkg/service/mappers"
+	"effectiveMobileTest/pkg/service/similarity"
+	"effectiveMobileTest/pkg/service/translit"
+	"effectiveMobileTest/pkg/tracing"
 	"effectiveMobileTest/utils"
 )
 
 type MusicService interface {
-	Create(ctx utils.MyContext, req models.AddSongRequest) (string, error)
+	Create(ctx utils.MyContext, req models.AddSongRequest) (models.AddSongResponse, error)
 	GetSongs(ctx utils.MyContext, filter models.SongFilter) ([]models.Song, error)
 	GetLyrics(ctx utils.MyContext, filter models.LyricsFilter) (string, error)
 	Update(ctx utils.MyContext, id string, input models.UpdateSongRequest) error
 	Delete(ctx utils.MyContext, id string) error
+	GetLyricsRevisions(ctx utils.MyContext, songId string) ([]models.LyricsRevision, error)
+	DiffLyrics(ctx utils.MyContext, filter models.LyricsDiffFilter) (models.LyricsDiff, error)
+	LookupLyrics(ctx utils.MyContext, filter models.LyricsLookupFilter) ([]models.LyricsLookupResult, error)
+	GetSimilar(ctx utils.MyContext, filter models.SimilarFilter) ([]models.SimilarSong, error)
+	CreateAnnotation(ctx utils.MyContext, songId string, req models.AddAnnotationRequest) (string, error)
+	GetAnnotations(ctx utils.MyContext, songId string) ([]models.Annotation, error)
+	GetAnnotationAnchors(ctx utils.MyContext, filter models.LyricsFilter) ([]models.AnnotationAnchor, error)
+	UpdateAnnotation(ctx utils.MyContext, songId, id string, input models.UpdateAnnotationRequest) error
+	DeleteAnnotation(ctx utils.MyContext, songId, id string) error
+	GetDetailsStatus(ctx utils.MyContext) models.DetailsStatus
+	GetDetailsRepairs(ctx utils.MyContext, filter models.DetailsRepairFilter) ([]models.DetailsRepair, error)
+	EnrichSong(ctx utils.MyContext, id string) (string, error)
+	RefreshSongs(ctx utils.MyContext, req models.RefreshSongsRequest) (models.RefreshSongsResponse, error)
+}
+
+// Enrichment policies decide whether Create fetches song details:
+// PolicyRequired fails when they cannot be fetched, PolicyBestEffort stores the
+// song with the client-supplied fields and marks it failed, PolicyDisabled never
+// fetches, and PolicyFillMissingOnly fetches only when the client left a field
+// empty, otherwise behaving like PolicyBestEffort.
+const (
+	PolicyRequired        = "required"
+	PolicyBestEffort      = "best-effort"
+	PolicyDisabled        = "disabled"
+	PolicyFillMissingOnly = "fill-missing-only"
+)
+
+const (
+	defaultRepairsLimit = 50
+	maxRepairsLimit     = 500
+)
+
+// Options holds the tunables of the music service.
+type Options struct {
+	// SimilarLimit is the number of similar songs returned when none is requested.
+	SimilarLimit int
+	// EnrichmentPolicy is one of the Policy constants.
+	EnrichmentPolicy string
+	// AsyncEnrichment makes Create store songs as pending and leave fetching
+	// their details to the enrichment workers.
+	AsyncEnrichment bool
+	// EnrichmentLease is how long a claimed enrichment job stays locked.
+	EnrichmentLease time.Duration
+	// EnrichmentMaxAttempts is the number of attempts before a song is marked failed.
+	EnrichmentMaxAttempts int
+	// EnrichmentRetryDelay is multiplied by the attempt number to get the delay
+	// before the next attempt.
+	EnrichmentRetryDelay time.Duration
+	// DetailsCacheTTL is how long fetched song details are cached. Zero
+	// disables the cache.
+	DetailsCacheTTL time.Duration
+	// DetailsCacheNegativeTTL is how long a "not found" answer is cached. Zero
+	// disables negative caching.
+	DetailsCacheNegativeTTL time.Duration
+	// RefreshBatchSize caps the number of songs refreshed by one request or
+	// one scheduled run.
+	RefreshBatchSize int
+	// RefreshStaleAfter is the age of details refreshed by the scheduled job.
+	RefreshStaleAfter time.Duration
 }
 
 type ImplMusic struct {
-	repo              repository.Repository
-	client            *http.Client
-	songDetailsAPIUrl string
+	repo    repository.Repository
+	details details.Provider
+	index   *similarity.Index
+	opts    Options
+
+	cacheHits         atomic.Int64
+	cacheNegativeHits atomic.Int64
+	cacheMisses       atomic.Int64
+	cacheBypassed     atomic.Int64
+}
+
+type detailsCacheBypassKey struct{}
+
+// WithoutDetailsCache returns a context whose song details lookups skip the
+// cache and refresh it from the providers.
+func WithoutDetailsCache(ctx utils.MyContext) utils.MyContext {
+	return utils.NewMyContext(context.WithValue(ctx.Ctx, detailsCacheBypassKey{}, true), ctx.Logger)
 }
 
-func NewMusicService(repo repository.Repository, songDetailsAPIUrl string) *ImplMusic {
+// DetailsCacheBypassed reports whether ctx was made by WithoutDetailsCache.
+func DetailsCacheBypassed(ctx utils.MyContext) bool {
+	bypass, _ := ctx.Ctx.Value(detailsCacheBypassKey{}).(bool)
+	return bypass
+}
+
+func NewMusicService(repo repository.Repository, provider details.Provider, index *similarity.Index, opts Options) *ImplMusic {
 	return &ImplMusic{
-		repo:              repo,
-		client:            &http.Client{Timeout: 10 * time.Second},
-		songDetailsAPIUrl: songDetailsAPIUrl,
+		repo:    repo,
+		details: provider,
+		index:   index,
+		opts:    opts,
 	}
 }
 
-func (s *ImplMusic) Create(ctx utils.MyContext, req models.AddSongRequest) (string, error) {
+// Create stores a new song. Whether its details are fetched, and what happens
+// when that fails, depends on the enrichment policy; details supplied by the
+// client are never replaced by fetched ones.
+func (s *ImplMusic) Create(ctx utils.MyContext, req models.AddSongRequest) (models.AddSongResponse, error) {
 	songId := uuid.New().String()
 
-	ctx.Logger.Debugf("fetching song details for group=%s, title=%s", req.Group, req.Title)
-
-	details, err := s.FetchSongDetails(req.Group, req.Title)
+	song, err := mappers.MapRequestToSong(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch song details: %w", err)
+		return models.AddSongResponse{}, err
+	}
+
+	song.Id = songId
+
+	var enrichmentCode string
+	switch {
+	case s.opts.EnrichmentPolicy == PolicyDisabled,
+		s.opts.EnrichmentPolicy == PolicyFillMissingOnly && !mappers.MissingDetails(req):
+		song.EnrichmentStatus = models.EnrichmentSkipped
+	case s.opts.AsyncEnrichment:
+		song.EnrichmentStatus = models.EnrichmentPending
+	default:
+		ctx.Logger.Debugf("fetching song details for group=%s, title=%s", req.Group, req.Title)
+
+		song, err = s.fetchAndMerge(ctx, song)
+		if err != nil {
+			if s.opts.EnrichmentPolicy == PolicyRequired {
+				return models.AddSongResponse{}, err
+			}
+
+			ctx.Logger.Warnf("saving song without fetched details: %v", err)
+			song.EnrichmentStatus = models.EnrichmentFailed
+			enrichmentCode, song.EnrichmentError = utils.PublicError(err)
+		} else {
+			song.EnrichmentStatus = models.EnrichmentEnriched
+		}
 	}
 
-	ctx.Logger.Debug("mapping song details to song model")
+	ctx.Logger.Debugf("saving song with id=%s, enrichment status=%s", songId, song.EnrichmentStatus)
 
-	song, err := mappers.MapDetailsToSong(req, details)
+	err = s.repo.Create(ctx, song)
 	if err != nil {
-		return "", fmt.Errorf("failed to map song details to song: %w", err)
+		return models.AddSongResponse{}, fmt.Errorf("failed to save song: %w", err)
 	}
 
-	song.Id = songId
+	if song.EnrichmentStatus != models.EnrichmentPending {
+		s.index.Upsert(mappers.MapToDocument(song))
+	}
 
-	ctx.Logger.Debugf("saving song with id=%s", songId)
+	return models.AddSongResponse{
+		Id:                  songId,
+		EnrichmentStatus:    song.EnrichmentStatus,
+		EnrichmentErrorCode: enrichmentCode,
+		EnrichmentError:     song.EnrichmentError,
+	}, nil
+}
 
-	err = s.repo.Create(ctx, song)
+// fetchAndMerge fetches the details of a song and merges them with the fields
+// supplied by the client. The returned song keeps the input song on error.
+func (s *ImplMusic) fetchAndMerge(ctx utils.MyContext, song dbmodels.Song) (dbmodels.Song, error) {
+	songDetails, err := s.FetchSongDetails(ctx, song.Group, song.Title)
+	if err != nil {
+		return song, fmt.Errorf("failed to fetch song details: %w", err)
+	}
+
+	ctx.Logger.Debug("merging fetched song details into song model")
+
+	merged, err := mappers.MergeDetails(song, songDetails)
 	if err != nil {
-		return "", fmt.Errorf("failed to save song: %w", err)
+		return song, fmt.Errorf("failed to map song details to song: %w", err)
 	}
 
-	return songId, nil
+	return merged, nil
 }
 
 func (s *ImplMusic) GetSongs(ctx utils.MyContext, filter models.SongFilter) ([]models.Song, error) {
@@ -94,7 +229,8 @@ func (s *ImplMusic) GetLyrics(ctx utils.MyContext, filter models.LyricsFilter) (
 	end := start + filter.Limit
 
 	if start > len(lyricsLines)-1 {
-		return "", fmt.Errorf("no lyrics found for the specified page: invalid pagination parameters")
+		return "", utils.NewValidationError("no lyrics found for the specified page: invalid pagination parameters",
+			utils.FieldError{Field: "page", Message: fmt.Sprintf("must be at most %d for this limit", (len(lyricsLines)-1)/filter.Limit+1)})
 	}
 	if end > len(lyricsLines) {
 		end = len(lyricsLines)
@@ -113,14 +249,22 @@ func (s *ImplMusic) Update(ctx utils.MyContext, id string, input models.UpdateSo
 
 	if input.Group == "" && input.Title == "" && input.ReleaseDate.IsZero() &&
 		input.Text == "" && input.Link == "" {
-		return fmt.Errorf("invalid or missing fields in the request body")
+		return utils.NewValidationError("invalid or missing fields in the request body",
+			utils.FieldError{Field: "group", Message: "at least one of group, title, releaseDate, text or link is required"})
+	}
+
+	var reanchor repository.Reanchor
+	if input.Text != "" {
+		reanchor = s.reanchorAnnotations(ctx, id, input.Text)
 	}
 
-	err := s.repo.Update(ctx, mappers.MapUpdateToSong(id, input))
+	err := s.repo.Update(ctx, mappers.MapUpdateToSong(id, input), reanchor)
 	if err != nil {
 		return fmt.Errorf("failed to update song: %w", err)
 	}
 
+	s.reindex(ctx, id)
+
 	return nil
 }
 
@@ -131,35 +275,844 @@ func (s *ImplMusic) Delete(ctx utils.MyContext, id string) error {
 		return fmt.Errorf("failed to delete song: %w", err)
 	}
 
+	s.index.Remove(id)
+
+	return nil
+}
+
+func (s *ImplMusic) GetLyricsRevisions(ctx utils.MyContext, songId string) ([]models.LyricsRevision, error) {
+	ctx.Logger.Debugf("retrieving lyrics revisions for song id=%s", songId)
+
+	revisions, err := s.repo.GetLyricsRevisions(ctx, songId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lyrics revisions: %w", err)
+	}
+
+	return mappers.MapFromLyricsRevisions(revisions), nil
+}
+
+func (s *ImplMusic) DiffLyrics(ctx utils.MyContext, filter models.LyricsDiffFilter) (models.LyricsDiff, error) {
+	ctx.Logger.Debugf("diffing lyrics for song id=%s from revision %d to %d", filter.SongId, filter.From, filter.To)
+
+	if filter.To == 0 {
+		revisions, err := s.repo.GetLyricsRevisions(ctx, filter.SongId)
+		if err != nil {
+			return models.LyricsDiff{}, fmt.Errorf("failed to get lyrics revisions: %w", err)
+		}
+		filter.To = revisions[len(revisions)-1].Revision
+	}
+	if filter.From == 0 {
+		filter.From = filter.To - 1
+	}
+	if filter.From < 0 || filter.To < 1 {
+		return models.LyricsDiff{}, utils.NewValidationError(fmt.Sprintf("invalid revision range: from=%d, to=%d", filter.From, filter.To),
+			utils.FieldError{Field: "from", Message: "must be a revision number of 1 or more"},
+			utils.FieldError{Field: "to", Message: "must be a revision number of 1 or more"})
+	}
+
+	// The first revision has nothing before it, so it is diffed against the
+	// empty text.
+	var from dbmodels.LyricsRevision
+	if filter.From > 0 {
+		var err error
+		if from, err = s.repo.GetLyricsRevision(ctx, filter.SongId, filter.From); err != nil {
+			return models.LyricsDiff{}, fmt.Errorf("failed to get lyrics revision: %w", err)
+		}
+	}
+
+	to, err := s.repo.GetLyricsRevision(ctx, filter.SongId, filter.To)
+	if err != nil {
+		return models.LyricsDiff{}, fmt.Errorf("failed to get lyrics revision: %w", err)
+	}
+
+	oldLines, newLines := splitLines(from.Text), splitLines(to.Text)
+	edits := diff.Diff(oldLines, newLines)
+
+	ctx.Logger.Debugf("lyrics diff has %d edits", len(edits))
+
+	return models.LyricsDiff{
+		SongId: filter.SongId,
+		From:   filter.From,
+		To:     filter.To,
+		Lines:  diffLines(oldLines, newLines, edits),
+		Unified: diff.Unified(oldLines, newLines, edits,
+			fmt.Sprintf("%s@%d", filter.SongId, filter.From), fmt.Sprintf("%s@%d", filter.SongId, filter.To), 3),
+	}, nil
+}
+
+func (s *ImplMusic) LookupLyrics(ctx utils.MyContext, filter models.LyricsLookupFilter) ([]models.LyricsLookupResult, error) {
+	ctx.Logger.Debugf("looking up lyrics with filter: %+v", filter)
+
+	if len(lyrics.Tokens(filter.Query)) == 0 {
+		return nil, utils.NewValidationError("invalid or missing lyrics query",
+			utils.FieldError{Field: "q", Message: "must contain at least one word"})
+	}
+
+	dbSongs, err := s.repo.LookupLyrics(ctx, mappers.MapToLookupFilter(filter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up lyrics: %w", err)
+	}
+
+	results := make([]models.LyricsLookupResult, 0, len(dbSongs))
+	for _, song := range dbSongs {
+		hits := lyrics.Find(song.Text, filter.Query)
+		if len(hits) == 0 {
+			continue
+		}
+
+		results = append(results, mappers.MapFromLookupResult(song, hits))
+	}
+
+	return results, nil
+}
+
+func (s *ImplMusic) GetSimilar(ctx utils.MyContext, filter models.SimilarFilter) ([]models.SimilarSong, error) {
+	ctx.Logger.Debugf("retrieving songs similar to id=%s, limit=%d", filter.SongId, filter.Limit)
+
+	if filter.Limit <= 0 {
+		filter.Limit = s.opts.SimilarLimit
+	}
+
+	matches, ok := s.index.Similar(filter.SongId, filter.Limit)
+	if !ok {
+		return nil, utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", filter.SongId)
+	}
+
+	return mappers.MapFromMatches(matches), nil
+}
+
+func (s *ImplMusic) CreateAnnotation(ctx utils.MyContext, songId string, req models.AddAnnotationRequest) (string, error) {
+	ctx.Logger.Debugf("creating annotation for song id=%s", songId)
+
+	if fields := utils.MissingFields(map[string]string{"author": req.Author, "body": req.Body}); len(fields) > 0 {
+		return "", utils.NewValidationError("missing required fields: author or body", fields...)
+	}
+
+	lyricsText, err := s.repo.GetLyrics(ctx, songId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get lyrics: %w", err)
+	}
+
+	quote, err := annotations.Quote(lyricsText, annotations.Anchor{Verse: req.Verse, Line: req.Line, Start: req.Start, End: req.End})
+	if err != nil {
+		return "", err
+	}
+
+	annotation := mappers.MapAddToAnnotation(songId, req, quote)
+	annotation.Id = uuid.New().String()
+
+	if err = s.repo.CreateAnnotation(ctx, annotation); err != nil {
+		return "", fmt.Errorf("failed to save annotation: %w", err)
+	}
+
+	return annotation.Id, nil
+}
+
+func (s *ImplMusic) GetAnnotations(ctx utils.MyContext, songId string) ([]models.Annotation, error) {
+	ctx.Logger.Debugf("retrieving annotations for song id=%s", songId)
+
+	if _, err := s.repo.GetLyrics(ctx, songId); err != nil {
+		return nil, fmt.Errorf("failed to get lyrics: %w", err)
+	}
+
+	dbAnnotations, err := s.repo.GetAnnotations(ctx, songId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get annotations: %w", err)
+	}
+
+	return mappers.MapFromAnnotations(dbAnnotations), nil
+}
+
+// GetAnnotationAnchors returns the anchors of annotations attached to the
+// verses on the requested lyrics page. Orphaned annotations are left out.
+func (s *ImplMusic) GetAnnotationAnchors(ctx utils.MyContext, filter models.LyricsFilter) ([]models.AnnotationAnchor, error) {
+	ctx.Logger.Debugf("retrieving annotation anchors for song id=%s with pagination page=%d, limit=%d", filter.SongId, filter.Page, filter.Limit)
+
+	dbAnnotations, err := s.repo.GetAnnotations(ctx, filter.SongId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get annotations: %w", err)
+	}
+
+	firstVerse := (filter.Page-1)*filter.Limit + 1
+	lastVerse := firstVerse + filter.Limit - 1
+
+	anchors := make([]models.AnnotationAnchor, 0, len(dbAnnotations))
+	for _, annotation := range dbAnnotations {
+		if annotation.Orphaned || annotation.Verse < firstVerse || annotation.Verse > lastVerse {
+			continue
+		}
+		anchors = append(anchors, mappers.MapFromAnchor(annotation))
+	}
+
+	return anchors, nil
+}
+
+func (s *ImplMusic) UpdateAnnotation(ctx utils.MyContext, songId, id string, input models.UpdateAnnotationRequest) error {
+	ctx.Logger.Debugf("updating annotation id=%s of song id=%s", id, songId)
+
+	if input.Author == "" && input.Body == "" {
+		return utils.NewValidationError("invalid or missing fields in the request body",
+			utils.FieldError{Field: "author", Message: "at least one of author or body is required"},
+			utils.FieldError{Field: "body", Message: "at least one of author or body is required"})
+	}
+
+	annotation, err := s.repo.GetAnnotation(ctx, songId, id)
+	if err != nil {
+		return fmt.Errorf("failed to get annotation: %w", err)
+	}
+
+	if input.Author != "" {
+		annotation.Author = input.Author
+	}
+	if input.Body != "" {
+		annotation.Body = input.Body
+	}
+
+	if err = s.repo.UpdateAnnotation(ctx, annotation); err != nil {
+		return fmt.Errorf("failed to update annotation: %w", err)
+	}
+
+	return nil
+}
+
+func (s *ImplMusic) DeleteAnnotation(ctx utils.MyContext, songId, id string) error {
+	ctx.Logger.Debugf("deleting annotation id=%s of song id=%s", id, songId)
+
+	if err := s.repo.DeleteAnnotation(ctx, songId, id); err != nil {
+		return fmt.Errorf("failed to delete annotation: %w", err)
+	}
+
 	return nil
 }
 
-func (s *ImplMusic) FetchSongDetails(group, song string) (models.SongDetails, error) {
-	encodedGroup := url.QueryEscape(group)
-	encodedSong := url.QueryEscape(song)
-	url := fmt.Sprintf("%s/info?group=%s&song=%s", s.songDetailsAPIUrl, encodedGroup, encodedSong)
+// reanchorAnnotations moves annotations to where their quotes are found in
+// the edited lyrics, taking the quote of the fragment they move to, and marks
+// those that cannot be found as orphaned. Orphaned annotations get re-attached
+// if their quote reappears.
+//
+// The fuzzy search is done here, before the song and its annotations are
+// locked for the update. Inside the transaction only annotations created or
+// edited in the meantime are searched again.
+func (s *ImplMusic) reanchorAnnotations(ctx utils.MyContext, songId, lyricsText string) repository.Reanchor {
+	type moved struct {
+		annotation dbmodels.Annotation
+		changed    bool
+	}
+	// Annotations are matched by their anchor as well as their id, so those
+	// edited after being read here are searched again.
+	type key struct {
+		id, quote               string
+		verse, line, start, end int
+		orphaned                bool
+	}
+	keyOf := func(annotation dbmodels.Annotation) key {
+		return key{id: annotation.Id, quote: annotation.Quote, verse: annotation.Verse, line: annotation.Line,
+			start: annotation.StartChar, end: annotation.EndChar, orphaned: annotation.Orphaned}
+	}
+
+	computed := make(map[key]moved)
+	current, err := s.repo.GetAnnotations(ctx, songId)
+	if err != nil {
+		ctx.Logger.Warnf("failed to get annotations of song id=%s before reanchoring them: %s", songId, err)
+	}
+	for _, annotation := range current {
+		result, changed := moveAnnotation(lyricsText, annotation)
+		computed[keyOf(annotation)] = moved{annotation: result, changed: changed}
+	}
+
+	return func(dbAnnotations []dbmodels.Annotation) []dbmodels.Annotation {
+		var changed []dbmodels.Annotation
+		for _, annotation := range dbAnnotations {
+			result, ok := computed[keyOf(annotation)]
+			if !ok {
+				result.annotation, result.changed = moveAnnotation(lyricsText, annotation)
+			}
+			if result.changed {
+				changed = append(changed, result.annotation)
+			}
+		}
+
+		return changed
+	}
+}
+
+// moveAnnotation re-anchors a single annotation in the edited lyrics. The
+// second result is false when the annotation stays as it is.
+func moveAnnotation(lyricsText string, annotation dbmodels.Annotation) (dbmodels.Annotation, bool) {
+	anchor, ok := annotations.Reanchor(lyricsText, annotation.Quote, mappers.MapToAnchor(annotation))
+	if !ok {
+		if annotation.Orphaned {
+			return annotation, false
+		}
+		annotation.Orphaned = true
+		return annotation, true
+	}
 
-	log.Printf("fetching song details: URL=%s", url)
+	if anchor == mappers.MapToAnchor(annotation) && !annotation.Orphaned {
+		return annotation, false
+	}
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	quote, err := annotations.Quote(lyricsText, anchor)
 	if err != nil {
-		return models.SongDetails{}, fmt.Errorf("failed to create request: %w", err)
+		// Reanchor only returns anchors inside the text
+		return annotation, false
 	}
 
-	resp, err := s.client.Do(req)
+	annotation.Verse, annotation.Line = anchor.Verse, anchor.Line
+	annotation.StartChar, annotation.EndChar = anchor.Start, anchor.End
+	annotation.Quote = quote
+	annotation.Orphaned = false
+	return annotation, true
+}
+
+// BuildSimilarityIndex loads every stored song into the similarity index.
+// Afterwards the index is kept up to date by Create, Update and Delete.
+func (s *ImplMusic) BuildSimilarityIndex(ctx utils.MyContext) error {
+	songs, err := s.repo.GetSongsForIndex(ctx)
 	if err != nil {
-		return models.SongDetails{}, err
+		return fmt.Errorf("failed to get songs for similarity index: %w", err)
+	}
+
+	for _, song := range songs {
+		s.index.Upsert(mappers.MapToDocument(song))
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return models.SongDetails{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	ctx.Logger.Debugf("similarity index built with %d songs", len(songs))
+
+	return nil
+}
+
+func (s *ImplMusic) reindex(ctx utils.MyContext, id string) {
+	song, err := s.repo.GetSong(ctx, id)
+	if err != nil {
+		ctx.Logger.Warnf("failed to reindex song id=%s: %v", id, err)
+		return
 	}
 
-	var details models.SongDetails
-	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
-		return models.SongDetails{}, fmt.Errorf("failed to decode response: %w", err)
+	s.index.Upsert(mappers.MapToDocument(song))
+}
+
+// RebuildSearchKeys fills in the transliterated search keys and the lyrics
+// lookup text of songs stored before they were introduced.
+func (s *ImplMusic) RebuildSearchKeys(ctx utils.MyContext) error {
+	songs, err := s.repo.GetSongsWithoutSearchKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get songs without search keys: %w", err)
+	}
+
+	for _, song := range songs {
+		song.GroupSearch = mappers.MapToSearchKeys(song.Group)
+		song.TitleSearch = mappers.MapToSearchKeys(song.Title)
+		song.TextSearch = lyrics.SearchText(song.Text)
+
+		if err = s.repo.UpdateSearchKeys(ctx, song); err != nil {
+			return fmt.Errorf("failed to rebuild search keys for song id=%s: %w", song.Id, err)
+		}
+	}
+
+	ctx.Logger.Debugf("search keys rebuilt for %d songs", len(songs))
+
+	return nil
+}
+
+// GetDetailsStatus reports the circuit breaker state of every details provider
+// and the details cache counters.
+func (s *ImplMusic) GetDetailsStatus(ctx utils.MyContext) models.DetailsStatus {
+	ctx.Logger.Debug("retrieving details providers status")
+
+	status := models.DetailsStatus{
+		Providers: []models.ProviderStatus{},
+		Cache: models.DetailsCacheStatus{
+			Enabled:      s.opts.DetailsCacheTTL > 0,
+			Hits:         s.cacheHits.Load(),
+			NegativeHits: s.cacheNegativeHits.Load(),
+			Misses:       s.cacheMisses.Load(),
+			Bypassed:     s.cacheBypassed.Load(),
+		},
+	}
+	if reporter, ok := s.details.(details.StatusReporter); ok {
+		status.Providers = append(status.Providers, reporter.Status()...)
+	}
+
+	return status
+}
+
+// GetSongStats counts the songs in the library and those waiting for
+// enrichment.
+func (s *ImplMusic) GetSongStats(ctx utils.MyContext) (models.SongStats, error) {
+	stats, err := s.repo.CountSongs(ctx)
+	if err != nil {
+		return models.SongStats{}, fmt.Errorf("failed to count songs: %w", err)
+	}
+
+	return models.SongStats{Total: stats.Total, Pending: stats.Pending}, nil
+}
+
+// CheckDetailsProviders fails when the circuit breaker of every details
+// provider is open, so that no song details can be fetched.
+func (s *ImplMusic) CheckDetailsProviders(ctx utils.MyContext) error {
+	providers := s.GetDetailsStatus(ctx).Providers
+	for _, provider := range providers {
+		if provider.Breaker.State != details.BreakerOpen {
+			return nil
+		}
+	}
+	if len(providers) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("circuit breakers of all %d details providers are open", len(providers))
+}
+
+// GetDetailsRepairs returns the latest song details fields repaired or
+// rejected during normalization, newest first.
+func (s *ImplMusic) GetDetailsRepairs(ctx utils.MyContext, filter models.DetailsRepairFilter) ([]models.DetailsRepair, error) {
+	ctx.Logger.Debugf("retrieving details repairs, provider=%q, limit=%d", filter.Provider, filter.Limit)
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultRepairsLimit
+	}
+	filter.Limit = min(filter.Limit, maxRepairsLimit)
+
+	repairs, err := s.repo.GetDetailsRepairs(ctx, mappers.MapToDetailsRepairFilter(filter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get details repairs: %w", err)
+	}
+
+	return mappers.MapFromDetailsRepairs(repairs), nil
+}
+
+// EnrichSong fetches the details of a song again. In async mode the song is
+// queued for the enrichment workers and reported as pending.
+func (s *ImplMusic) EnrichSong(ctx utils.MyContext, id string) (string, error) {
+	ctx.Logger.Debugf("enriching song with id=%s", id)
+
+	if s.opts.AsyncEnrichment {
+		if err := s.repo.QueueEnrichment(ctx, id); err != nil {
+			return "", fmt.Errorf("failed to queue enrichment: %w", err)
+		}
+
+		return models.EnrichmentPending, nil
+	}
+
+	song, err := s.repo.GetSong(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to get song: %w", err)
+	}
+
+	if err = s.enrich(ctx, song); err != nil {
+		// an enriched song keeps its details, and a failure that may pass on
+		// its own is not recorded
+		unfinished := song.EnrichmentStatus == models.EnrichmentPending || song.EnrichmentStatus == models.EnrichmentFailed
+		if unfinished && !transientEnrichmentError(err) {
+			if failErr := s.repo.FailEnrichment(ctx, id, enrichmentError(err)); failErr != nil {
+				ctx.Logger.Warnf("failed to mark enrichment of song id=%s as failed: %v", id, failErr)
+			}
+		}
+		return "", err
+	}
+
+	return models.EnrichmentEnriched, nil
+}
+
+// EnrichNext claims the next due enrichment job and fetches the details of its
+// song. A failed attempt is retried with a growing delay until the attempts run
+// out and the song is marked failed. A song or details that are not found fail
+// it at once. It reports false when no job was due.
+func (s *ImplMusic) EnrichNext(ctx utils.MyContext) (bool, error) {
+	job, ok, err := s.repo.ClaimEnrichmentJob(ctx, s.opts.EnrichmentLease)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	song, err := s.repo.GetSong(ctx, job.SongId)
+	if err != nil {
+		err = fmt.Errorf("failed to get song: %w", err)
+	} else if err = s.enrich(ctx, song); err == nil {
+		return true, nil
+	}
+
+	ctx.Logger.Warnf("enrichment attempt %d of song id=%s failed: %v", job.Attempts, job.SongId, err)
+
+	if job.Attempts >= s.opts.EnrichmentMaxAttempts || utils.KindOf(err) == utils.KindNotFound {
+		if err = s.repo.FailEnrichment(ctx, job.SongId, enrichmentError(err)); err != nil {
+			return true, fmt.Errorf("failed to mark enrichment as failed: %w", err)
+		}
+		return true, nil
+	}
+
+	delay := time.Duration(job.Attempts) * s.opts.EnrichmentRetryDelay
+	if err = s.repo.PostponeEnrichment(ctx, job.SongId, enrichmentError(err), delay); err != nil {
+		return true, fmt.Errorf("failed to postpone enrichment: %w", err)
+	}
+
+	return true, nil
+}
+
+// transientEnrichmentError reports whether a failed enrichment may succeed if
+// simply tried again: the providers were unavailable, overloaded or too slow,
+// or the song was edited while its details were fetched.
+func transientEnrichmentError(err error) bool {
+	switch utils.KindOf(err) {
+	case utils.KindUnavailable, utils.KindConflict:
+		return true
+	}
+
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// enrichmentError returns the message of a failed enrichment kept with the
+// song. Clients read it, so it never holds upstream error text.
+func enrichmentError(err error) string {
+	_, message := utils.PublicError(err)
+	return message
+}
+
+// RefreshSongs fetches the details of enriched songs again, bypassing the
+// details cache, and updates the fields that changed upstream. Fields edited
+// manually since the last enrichment are reported but never overwritten. In a
+// dry run nothing is saved.
+func (s *ImplMusic) RefreshSongs(ctx utils.MyContext, req models.RefreshSongsRequest) (models.RefreshSongsResponse, error) {
+	ctx.Logger.Debugf("refreshing song details with request: %+v", req)
+
+	if req.OlderThanDays < 0 {
+		return models.RefreshSongsResponse{}, utils.NewValidationError(fmt.Sprintf("invalid olderThanDays: %d", req.OlderThanDays),
+			utils.FieldError{Field: "olderThanDays", Message: "must not be negative"})
+	}
+
+	limit := max(s.opts.RefreshBatchSize, 1)
+	if req.Limit > 0 && req.Limit < limit {
+		limit = req.Limit
+	}
+
+	var enrichedBefore time.Time
+	if req.OlderThanDays > 0 {
+		enrichedBefore = time.Now().AddDate(0, 0, -req.OlderThanDays)
+	}
+
+	songs, err := s.repo.GetSongsForRefresh(ctx, mappers.MapToRefreshFilter(req, enrichedBefore, limit))
+	if err != nil {
+		return models.RefreshSongsResponse{}, fmt.Errorf("failed to get songs for refresh: %w", err)
+	}
+
+	response := models.RefreshSongsResponse{DryRun: req.DryRun, Songs: make([]models.SongRefresh, 0, len(songs))}
+	for _, song := range songs {
+		response.Songs = append(response.Songs, s.refreshSong(WithoutDetailsCache(ctx), song, req.DryRun))
+	}
+
+	return response, nil
+}
+
+// RefreshStale refreshes one batch of songs whose details are older than the
+// configured age. It is run periodically by the refresh scheduler.
+func (s *ImplMusic) RefreshStale(ctx utils.MyContext) error {
+	response, err := s.RefreshSongs(ctx, models.RefreshSongsRequest{
+		OlderThanDays: max(int(s.opts.RefreshStaleAfter/(24*time.Hour)), 1),
+	})
+	if err != nil {
+		return err
+	}
+
+	var changed, failed int
+	for _, song := range response.Songs {
+		if song.Error != "" {
+			failed++
+		} else if len(song.Changes) > 0 {
+			changed++
+		}
+	}
+
+	ctx.Logger.Infof("refreshed details of %d stale songs: %d changed, %d failed", len(response.Songs), changed, failed)
+
+	return nil
+}
+
+// refreshedFields are the song details fields compared on refresh, named as in
+// models.SongDetails.Sources.
+var refreshedFields = []struct {
+	name  string
+	field func(*dbmodels.EnrichedDetails) *string
+}{
+	{details.FieldReleaseDate, func(d *dbmodels.EnrichedDetails) *string { return &d.ReleaseDate }},
+	{details.FieldText, func(d *dbmodels.EnrichedDetails) *string { return &d.Text }},
+	{details.FieldLink, func(d *dbmodels.EnrichedDetails) *string { return &d.Link }},
+}
+
+func (s *ImplMusic) refreshSong(ctx utils.MyContext, song dbmodels.Song, dryRun bool) models.SongRefresh {
+	result := models.SongRefresh{Id: song.Id, Group: song.Group, Title: song.Title, Changes: []models.FieldChange{}}
+
+	songDetails, err := s.FetchSongDetails(ctx, song.Group, song.Title)
+	if err == nil {
+		var fetched dbmodels.Song
+		fetched, err = mappers.MapDetailsToSong(models.AddSongRequest{Group: song.Group, Title: song.Title}, songDetails)
+		if err == nil {
+			err = s.applyRefresh(ctx, song, fetched, dryRun, &result)
+		}
+	} else if details.IsNotFound(err) && !dryRun {
+		// keep songs unknown upstream from being picked again on every run
+		if touchErr := s.repo.RefreshSong(ctx, song, song, false, nil); touchErr != nil {
+			ctx.Logger.Warnf("failed to mark song id=%s as refreshed: %v", song.Id, touchErr)
+		}
+	}
+
+	if err != nil {
+		ctx.Logger.Warnf("failed to refresh details of song id=%s: %v", song.Id, err)
+		result.ErrorCode, result.Error = utils.PublicError(err)
+	}
+
+	return result
+}
+
+// applyRefresh compares the current, last fetched and newly fetched values of
+// every details field. A field is updated only if it changed upstream and
+// still holds the last fetched value.
+func (s *ImplMusic) applyRefresh(ctx utils.MyContext, song, fetched dbmodels.Song, dryRun bool, result *models.SongRefresh) error {
+	current := mappers.MapToEnrichedDetails(song)
+	updated := current
+	snapshot := song.EnrichedDetails
+
+	sources := make(dbmodels.DetailsSources, len(song.DetailsSources))
+	for field, provider := range song.DetailsSources {
+		sources[field] = provider
+	}
+
+	for _, f := range refreshedFields {
+		value, enriched, fresh := *f.field(&current), *f.field(&song.EnrichedDetails), *f.field(&fetched.EnrichedDetails)
+		if fresh == "" {
+			continue
+		}
+		if fresh == value {
+			*f.field(&snapshot) = fresh
+			continue
+		}
+
+		change := models.FieldChange{Field: f.name, Old: value, New: fresh}
+		if f.name == details.FieldText {
+			oldLines, newLines := splitLines(value), splitLines(fresh)
+			change.Diff = diff.Unified(oldLines, newLines, diff.Diff(oldLines, newLines), "current", "fetched", 3)
+		}
+
+		if value != enriched {
+			result.Skipped = append(result.Skipped, change)
+			continue
+		}
+
+		result.Changes = append(result.Changes, change)
+		*f.field(&updated) = fresh
+		*f.field(&snapshot) = fresh
+		sources[f.name] = fetched.DetailsSources[f.name]
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	refreshed, err := mappers.MapRefreshToSong(song, updated)
+	if err != nil {
+		return err
+	}
+	refreshed.DetailsSources = sources
+	refreshed.EnrichedDetails = snapshot
+
+	textChanged := refreshed.Text != song.Text
+	var reanchor repository.Reanchor
+	if textChanged {
+		reanchor = s.reanchorAnnotations(ctx, song.Id, refreshed.Text)
+	}
+	err = s.repo.RefreshSong(ctx, song, refreshed, textChanged, reanchor)
+	if utils.KindOf(err) == utils.KindConflict {
+		// the song was edited during the fetch, so none of the changes apply
+		ctx.Logger.Infof("skipping refresh of song id=%s changed while its details were fetched", song.Id)
+		result.Skipped = append(result.Skipped, result.Changes...)
+		result.Changes = []models.FieldChange{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save refreshed details: %w", err)
+	}
+
+	if len(result.Changes) == 0 {
+		return nil
+	}
+
+	s.reindex(ctx, song.Id)
+
+	return nil
+}
+
+// enrich fetches the details of a stored song and saves them, keeping the
+// fields supplied by the client.
+func (s *ImplMusic) enrich(ctx utils.MyContext, song dbmodels.Song) error {
+	enriched, err := s.fetchAndMerge(ctx, song)
+	if err != nil {
+		return err
+	}
+
+	if err = s.repo.CompleteEnrichment(ctx, song, enriched, s.reanchorAnnotations(ctx, song.Id, enriched.Text)); err != nil {
+		return fmt.Errorf("failed to save song details: %w", err)
+	}
+
+	s.reindex(ctx, song.Id)
+
+	return nil
+}
+
+// FetchSongDetails looks up the release date, lyrics and link of a song in the
+// configured details providers. Answers are cached by normalized group and
+// title, "not found" answers for a shorter time. Cache errors are logged and
+// the providers are asked directly.
+func (s *ImplMusic) FetchSongDetails(ctx utils.MyContext, group, song string) (songDetails models.SongDetails, err error) {
+	ctx, span := tracing.Start(ctx, "FetchSongDetails", trace.SpanKindInternal,
+		attribute.String("song.group", group), attribute.String("song.title", song))
+	defer func() {
+		if details.IsNotFound(err) {
+			span.End()
+			return
+		}
+		tracing.End(span, err)
+	}()
+
+	if s.opts.DetailsCacheTTL <= 0 {
+		return s.fetchFromProviders(ctx, group, song)
+	}
+
+	groupKey, titleKey := translit.Normalize(group), translit.Normalize(song)
+
+	if DetailsCacheBypassed(ctx) {
+		s.cacheBypassed.Add(1)
+	} else {
+		entry, found, err := s.repo.GetDetailsCache(ctx, groupKey, titleKey)
+		switch {
+		case err != nil:
+			ctx.Logger.Warnf("failed to read song details cache: %v", err)
+		case found && entry.NotFound:
+			s.cacheNegativeHits.Add(1)
+			return models.SongDetails{}, details.ErrNotFound
+		case found:
+			s.cacheHits.Add(1)
+			return mappers.MapFromDetailsCacheEntry(entry), nil
+		default:
+			s.cacheMisses.Add(1)
+		}
+	}
+
+	songDetails, err = s.fetchFromProviders(ctx, group, song)
+
+	var entry dbmodels.DetailsCacheEntry
+	ttl := s.opts.DetailsCacheTTL
+	switch {
+	case err == nil:
+		entry = mappers.MapToDetailsCacheEntry(groupKey, titleKey, songDetails)
+	case details.IsNotFound(err) && s.opts.DetailsCacheNegativeTTL > 0:
+		entry = dbmodels.DetailsCacheEntry{GroupKey: groupKey, TitleKey: titleKey, NotFound: true}
+		ttl = s.opts.DetailsCacheNegativeTTL
+	default:
+		return songDetails, err
+	}
+
+	if cacheErr := s.repo.PutDetailsCache(ctx, entry, ttl); cacheErr != nil {
+		ctx.Logger.Warnf("failed to write song details cache: %v", cacheErr)
+	}
+
+	return songDetails, err
+}
+
+// fetchFromProviders asks the details providers and records the fields they
+// returned invalid or in a non-canonical form, also when the lookup failed.
+func (s *ImplMusic) fetchFromProviders(ctx utils.MyContext, group, song string) (models.SongDetails, error) {
+	ctx.Logger.Debugf("fetching song details from provider %s", s.details.Name())
+
+	songDetails, err := s.details.FetchSongDetails(ctx, group, song)
+
+	if len(songDetails.Repairs) > 0 {
+		if repairErr := s.repo.CreateDetailsRepairs(ctx, mappers.MapToDetailsRepairs(songDetails.Repairs)); repairErr != nil {
+			ctx.Logger.Warnf("failed to record song details repairs: %v", repairErr)
+		}
+	}
+
+	return songDetails, err
+}
+
+// PurgeDetailsCache removes expired song details cache entries.
+func (s *ImplMusic) PurgeDetailsCache(ctx utils.MyContext) error {
+	deleted, err := s.repo.DeleteExpiredDetailsCache(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to purge details cache: %w", err)
+	}
+
+	ctx.Logger.Debugf("purged %d expired song details cache entries", deleted)
+
+	return nil
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(text, "\n")
+}
+
+// diffLines converts a line-level edit script into its JSON form. Deleted lines
+// directly followed by inserted ones are paired up as replacements and get a
+// word-level diff.
+func diffLines(oldLines, newLines []string, edits []diff.Edit) []models.LyricsDiffLine {
+	lines := make([]models.LyricsDiffLine, 0, len(edits))
+
+	for i := 0; i < len(edits); {
+		if edits[i].Op == diff.Equal {
+			lines = append(lines, models.LyricsDiffLine{
+				Op:      diff.Equal.String(),
+				OldLine: edits[i].OldIndex + 1,
+				NewLine: edits[i].NewIndex + 1,
+				Text:    oldLines[edits[i].OldIndex],
+			})
+			i++
+			continue
+		}
+
+		var deleted, inserted []diff.Edit
+		for ; i < len(edits) && edits[i].Op == diff.Delete; i++ {
+			deleted = append(deleted, edits[i])
+		}
+		for ; i < len(edits) && edits[i].Op == diff.Insert; i++ {
+			inserted = append(inserted, edits[i])
+		}
+
+		paired := min(len(deleted), len(inserted))
+		for j := 0; j < paired; j++ {
+			oldText, newText := oldLines[deleted[j].OldIndex], newLines[inserted[j].NewIndex]
+
+			var words []models.LyricsDiffWord
+			for _, segment := range diff.Words(oldText, newText) {
+				words = append(words, models.LyricsDiffWord{Op: segment.Op.String(), Text: segment.Text})
+			}
+
+			lines = append(lines, models.LyricsDiffLine{
+				Op:      "replace",
+				OldLine: deleted[j].OldIndex + 1,
+				NewLine: inserted[j].NewIndex + 1,
+				OldText: oldText,
+				Text:    newText,
+				Words:   words,
+			})
+		}
+		for _, edit := range deleted[paired:] {
+			lines = append(lines, models.LyricsDiffLine{
+				Op:      diff.Delete.String(),
+				OldLine: edit.OldIndex + 1,
+				Text:    oldLines[edit.OldIndex],
+			})
+		}
+		for _, edit := range inserted[paired:] {
+			lines = append(lines, models.LyricsDiffLine{
+				Op:      diff.Insert.String(),
+				NewLine: edit.NewIndex + 1,
+				Text:    newLines[edit.NewIndex],
+			})
+		}
 	}
 
-	return details, nil
+	return lines
 }
@@ -0,0 +1,373 @@
+package music
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"effectiveMobileTest/models"
+	"effectiveMobileTest/pkg/repository"
+	dbmodels "effectiveMobileTest/pkg/repository/models"
+	"effectiveMobileTest/pkg/service/details"
+	"effectiveMobileTest/pkg/service/similarity"
+	"effectiveMobileTest/pkg/service/translit"
+	"effectiveMobileTest/utils"
+)
+
+// fakeRepository keeps songs and the details cache in memory. Methods the
+// tests do not use are left to the embedded nil interface.
+type fakeRepository struct {
+	repository.Repository
+
+	songs  map[string]dbmodels.Song
+	cache  map[[2]string]dbmodels.DetailsCacheEntry
+	puts   []time.Duration
+	failed []string
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		songs: map[string]dbmodels.Song{},
+		cache: map[[2]string]dbmodels.DetailsCacheEntry{},
+	}
+}
+
+func (r *fakeRepository) Create(ctx utils.MyContext, song dbmodels.Song) error {
+	r.songs[song.Id] = song
+	return nil
+}
+
+func (r *fakeRepository) GetSong(ctx utils.MyContext, id string) (dbmodels.Song, error) {
+	song, ok := r.songs[id]
+	if !ok {
+		return dbmodels.Song{}, utils.NewNotFoundError(utils.CodeSongNotFound, "song with id %s not found", id)
+	}
+	return song, nil
+}
+
+func (r *fakeRepository) GetAnnotations(ctx utils.MyContext, songId string) ([]dbmodels.Annotation, error) {
+	return nil, nil
+}
+
+func (r *fakeRepository) CompleteEnrichment(ctx utils.MyContext, read, song dbmodels.Song, reanchor repository.Reanchor) error {
+	song.EnrichmentStatus = models.EnrichmentEnriched
+	r.songs[song.Id] = song
+	return nil
+}
+
+func (r *fakeRepository) FailEnrichment(ctx utils.MyContext, songId, lastError string) error {
+	r.failed = append(r.failed, songId)
+	if song, ok := r.songs[songId]; ok {
+		song.EnrichmentStatus, song.EnrichmentError = models.EnrichmentFailed, lastError
+		r.songs[songId] = song
+	}
+	return nil
+}
+
+func (r *fakeRepository) PostponeEnrichment(ctx utils.MyContext, songId, lastError string, delay time.Duration) error {
+	return nil
+}
+
+func (r *fakeRepository) GetDetailsCache(ctx utils.MyContext, groupKey, titleKey string) (dbmodels.DetailsCacheEntry, bool, error) {
+	entry, ok := r.cache[[2]string{groupKey, titleKey}]
+	if !ok || !time.Now().Before(entry.ExpiresAt) {
+		return dbmodels.DetailsCacheEntry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+func (r *fakeRepository) PutDetailsCache(ctx utils.MyContext, entry dbmodels.DetailsCacheEntry, ttl time.Duration) error {
+	entry.ExpiresAt = time.Now().Add(ttl)
+	r.cache[[2]string{entry.GroupKey, entry.TitleKey}] = entry
+	r.puts = append(r.puts, ttl)
+	return nil
+}
+
+func (r *fakeRepository) DeleteExpiredDetailsCache(ctx utils.MyContext) (int64, error) {
+	var deleted int64
+	for key, entry := range r.cache {
+		if !time.Now().Before(entry.ExpiresAt) {
+			delete(r.cache, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type fakeProvider struct {
+	details models.SongDetails
+	err     error
+	calls   int
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) FetchSongDetails(ctx utils.MyContext, group, song string) (models.SongDetails, error) {
+	p.calls++
+	return p.details, p.err
+}
+
+var fetchedDetails = models.SongDetails{
+	ReleaseDate: "16.07.2006",
+	Text:        "Ooh baby, don't you know I suffer?",
+	Link:        "https://example.com/supermassive",
+	Sources:     map[string]string{"releaseDate": "fake", "text": "fake", "link": "fake"},
+}
+
+func testContext() utils.MyContext {
+	return utils.NewMyContext(context.Background(), zap.NewNop().Sugar())
+}
+
+func TestFetchSongDetailsCache(t *testing.T) {
+	const (
+		ttl         = time.Hour
+		negativeTTL = time.Minute
+	)
+
+	tests := []struct {
+		name string
+		// cached is stored under the song before the lookup, expiring after
+		// cachedTTL.
+		cached    *dbmodels.DetailsCacheEntry
+		cachedTTL time.Duration
+		bypass    bool
+		fetchErr  error
+
+		wantErr   bool
+		wantKind  utils.ErrorKind
+		wantCalls int
+		wantPut   time.Duration
+		wantStats models.DetailsCacheStatus
+	}{
+		{
+			name:      "miss fetches and caches",
+			wantCalls: 1,
+			wantPut:   ttl,
+			wantStats: models.DetailsCacheStatus{Enabled: true, Misses: 1},
+		},
+		{
+			name:      "hit skips the providers",
+			cached:    &dbmodels.DetailsCacheEntry{Text: "cached lyrics"},
+			cachedTTL: ttl,
+			wantStats: models.DetailsCacheStatus{Enabled: true, Hits: 1},
+		},
+		{
+			name:      "negative hit answers not found",
+			cached:    &dbmodels.DetailsCacheEntry{NotFound: true},
+			cachedTTL: negativeTTL,
+			wantErr:   true,
+			wantKind:  utils.KindNotFound,
+			wantStats: models.DetailsCacheStatus{Enabled: true, NegativeHits: 1},
+		},
+		{
+			name:      "not found is cached for the negative TTL",
+			fetchErr:  details.ErrNotFound,
+			wantErr:   true,
+			wantKind:  utils.KindNotFound,
+			wantCalls: 1,
+			wantPut:   negativeTTL,
+			wantStats: models.DetailsCacheStatus{Enabled: true, Misses: 1},
+		},
+		{
+			name:      "provider errors are not cached",
+			fetchErr:  utils.NewUpstreamError(utils.CodeDetailsUpstream, "song details providers failed", errors.New("boom")),
+			wantErr:   true,
+			wantKind:  utils.KindUpstream,
+			wantCalls: 1,
+			wantStats: models.DetailsCacheStatus{Enabled: true, Misses: 1},
+		},
+		{
+			name:      "expired entry is fetched again",
+			cached:    &dbmodels.DetailsCacheEntry{Text: "stale lyrics"},
+			cachedTTL: -time.Second,
+			wantCalls: 1,
+			wantPut:   ttl,
+			wantStats: models.DetailsCacheStatus{Enabled: true, Misses: 1},
+		},
+		{
+			name:      "bypass refreshes a cached entry",
+			cached:    &dbmodels.DetailsCacheEntry{Text: "cached lyrics"},
+			cachedTTL: ttl,
+			bypass:    true,
+			wantCalls: 1,
+			wantPut:   ttl,
+			wantStats: models.DetailsCacheStatus{Enabled: true, Bypassed: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepository()
+			provider := &fakeProvider{details: fetchedDetails, err: tt.fetchErr}
+			service := NewMusicService(repo, provider, similarity.NewIndex(similarity.Weights{}),
+				Options{DetailsCacheTTL: ttl, DetailsCacheNegativeTTL: negativeTTL})
+
+			ctx := testContext()
+			if tt.cached != nil {
+				entry := *tt.cached
+				entry.GroupKey, entry.TitleKey = translit.Normalize("Muse"), translit.Normalize("Supermassive Black Hole")
+				if err := repo.PutDetailsCache(ctx, entry, tt.cachedTTL); err != nil {
+					t.Fatal(err)
+				}
+				repo.puts = nil
+			}
+			if tt.bypass {
+				ctx = WithoutDetailsCache(ctx)
+			}
+
+			got, err := service.FetchSongDetails(ctx, "Muse", "Supermassive Black Hole")
+			switch {
+			case !tt.wantErr && err != nil:
+				t.Fatalf("FetchSongDetails() error = %v", err)
+			case tt.wantErr && (err == nil || utils.KindOf(err) != tt.wantKind):
+				t.Fatalf("FetchSongDetails() error = %v, want kind %v", err, tt.wantKind)
+			}
+
+			if provider.calls != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", provider.calls, tt.wantCalls)
+			}
+			switch {
+			case tt.wantPut == 0 && len(repo.puts) > 0:
+				t.Errorf("cache written with TTL %v, want no write", repo.puts)
+			case tt.wantPut != 0 && (len(repo.puts) != 1 || repo.puts[0] != tt.wantPut):
+				t.Errorf("cache written with TTLs %v, want %v", repo.puts, tt.wantPut)
+			}
+			if !tt.wantErr && tt.wantCalls == 0 && got.Text != tt.cached.Text {
+				t.Errorf("FetchSongDetails() text = %q, want the cached %q", got.Text, tt.cached.Text)
+			}
+			if !tt.wantErr && tt.wantCalls > 0 && got.Text != fetchedDetails.Text {
+				t.Errorf("FetchSongDetails() text = %q, want the fetched %q", got.Text, fetchedDetails.Text)
+			}
+
+			if stats := service.GetDetailsStatus(ctx).Cache; stats != tt.wantStats {
+				t.Errorf("cache stats = %+v, want %+v", stats, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestPurgeDetailsCache(t *testing.T) {
+	ctx := testContext()
+	repo := newFakeRepository()
+	service := NewMusicService(repo, &fakeProvider{}, nil, Options{DetailsCacheTTL: time.Hour})
+
+	repo.PutDetailsCache(ctx, dbmodels.DetailsCacheEntry{GroupKey: "muse", TitleKey: "uprising"}, time.Hour)
+	repo.PutDetailsCache(ctx, dbmodels.DetailsCacheEntry{GroupKey: "muse", TitleKey: "starlight"}, -time.Second)
+
+	if err := service.PurgeDetailsCache(ctx); err != nil {
+		t.Fatalf("PurgeDetailsCache() error = %v", err)
+	}
+
+	if _, ok := repo.cache[[2]string{"muse", "uprising"}]; !ok || len(repo.cache) != 1 {
+		t.Errorf("cache = %v, want only the live entry kept", repo.cache)
+	}
+}
+
+func TestCreatePolicies(t *testing.T) {
+	complete := models.AddSongRequest{
+		Group:       "Muse",
+		Title:       "Supermassive Black Hole",
+		ReleaseDate: "2006-06-19",
+		Text:        "Own lyrics",
+		Link:        "https://example.com/own",
+	}
+	partial := models.AddSongRequest{Group: "Muse", Title: "Supermassive Black Hole"}
+	upstreamErr := utils.NewUpstreamError(utils.CodeDetailsUpstream, "song details providers failed",
+		errors.New("GET http://details.internal/info: connection refused"))
+
+	tests := []struct {
+		name     string
+		policy   string
+		async    bool
+		req      models.AddSongRequest
+		fetchErr error
+
+		wantErr    bool
+		wantStatus string
+		wantCode   string
+		wantCalls  int
+	}{
+		{name: "required fetches", policy: PolicyRequired, req: partial, wantStatus: models.EnrichmentEnriched, wantCalls: 1},
+		{name: "required fails without details", policy: PolicyRequired, req: partial, fetchErr: upstreamErr, wantErr: true, wantCalls: 1},
+		{name: "best effort stores failed songs", policy: PolicyBestEffort, req: partial, fetchErr: upstreamErr,
+			wantStatus: models.EnrichmentFailed, wantCode: utils.CodeDetailsUpstream, wantCalls: 1},
+		{name: "disabled never fetches", policy: PolicyDisabled, req: partial, wantStatus: models.EnrichmentSkipped},
+		{name: "fill missing only skips complete songs", policy: PolicyFillMissingOnly, req: complete, wantStatus: models.EnrichmentSkipped},
+		{name: "fill missing only fetches missing fields", policy: PolicyFillMissingOnly, req: partial, wantStatus: models.EnrichmentEnriched, wantCalls: 1},
+		{name: "async queues the song", policy: PolicyBestEffort, async: true, req: partial, wantStatus: models.EnrichmentPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepository()
+			provider := &fakeProvider{details: fetchedDetails, err: tt.fetchErr}
+			service := NewMusicService(repo, provider, similarity.NewIndex(similarity.Weights{}),
+				Options{EnrichmentPolicy: tt.policy, AsyncEnrichment: tt.async})
+
+			response, err := service.Create(testContext(), tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Create() = %+v, want an error", response)
+				}
+				if len(repo.songs) != 0 {
+					t.Errorf("song stored although Create() failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			if response.EnrichmentStatus != tt.wantStatus || response.EnrichmentErrorCode != tt.wantCode {
+				t.Errorf("Create() = %+v, want status %s and error code %q", response, tt.wantStatus, tt.wantCode)
+			}
+			if tt.wantCode != "" && response.EnrichmentError != "song details providers failed" {
+				t.Errorf("enrichment error = %q, want the public message only", response.EnrichmentError)
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", provider.calls, tt.wantCalls)
+			}
+			if song := repo.songs[response.Id]; song.EnrichmentStatus != tt.wantStatus {
+				t.Errorf("stored status = %s, want %s", song.EnrichmentStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestEnrichSongFailures(t *testing.T) {
+	unavailable := utils.NewUnavailableError(utils.CodeDetailsUnavailable, "song details providers are unavailable", 0, details.ErrCircuitOpen)
+
+	tests := []struct {
+		name       string
+		status     string
+		fetchErr   error
+		wantFailed bool
+	}{
+		{name: "pending song fails on not found", status: models.EnrichmentPending, fetchErr: details.ErrNotFound, wantFailed: true},
+		{name: "failed song keeps failing on not found", status: models.EnrichmentFailed, fetchErr: details.ErrNotFound, wantFailed: true},
+		{name: "enriched song keeps its status", status: models.EnrichmentEnriched, fetchErr: details.ErrNotFound},
+		{name: "unavailable providers are not recorded", status: models.EnrichmentPending, fetchErr: unavailable},
+		{name: "timeouts are not recorded", status: models.EnrichmentFailed, fetchErr: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepository()
+			repo.songs["1"] = dbmodels.Song{Id: "1", Group: "Muse", Title: "Uprising", EnrichmentStatus: tt.status}
+			service := NewMusicService(repo, &fakeProvider{err: tt.fetchErr}, similarity.NewIndex(similarity.Weights{}), Options{})
+
+			if _, err := service.EnrichSong(testContext(), "1"); err == nil {
+				t.Fatalf("EnrichSong() succeeded, want an error")
+			}
+
+			if failed := len(repo.failed) > 0; failed != tt.wantFailed {
+				t.Errorf("song marked failed = %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
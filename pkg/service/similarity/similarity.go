@@ -0,0 +1,213 @@
+package similarity
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"effectiveMobileTest/pkg/service/lyrics"
+	"effectiveMobileTest/pkg/service/translit"
+)
+
+// Weights control how lyrics, group and era similarity add up to a score.
+// EraWindow is the distance in years at which era proximity drops to zero.
+type Weights struct {
+	Text      float64
+	Group     float64
+	Era       float64
+	EraWindow float64
+}
+
+type Document struct {
+	Id          string
+	Group       string
+	Title       string
+	ReleaseDate time.Time
+	Text        string
+}
+
+type Match struct {
+	Document Document
+	Score    float64
+}
+
+// Index keeps TF-IDF term statistics of song lyrics in memory and ranks songs
+// by cosine similarity combined with group and era proximity. It is safe for
+// concurrent use and is updated one document at a time.
+type Index struct {
+	mu       sync.Mutex
+	weights  Weights
+	entries  map[string]*entry
+	postings map[string]map[string]int
+	norms    map[string]float64
+}
+
+type entry struct {
+	doc       Document
+	groupKeys []string
+	terms     map[string]int
+}
+
+func NewIndex(weights Weights) *Index {
+	return &Index{
+		weights:  weights,
+		entries:  make(map[string]*entry),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// Upsert adds a document to the index or replaces the stored one with the same id.
+func (i *Index) Upsert(doc Document) {
+	terms := make(map[string]int)
+	for _, word := range lyrics.Words(doc.Text) {
+		terms[word]++
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(doc.Id)
+
+	for term, tf := range terms {
+		if i.postings[term] == nil {
+			i.postings[term] = make(map[string]int)
+		}
+		i.postings[term][doc.Id] = tf
+	}
+
+	doc.Text = ""
+	i.entries[doc.Id] = &entry{doc: doc, groupKeys: translit.Keys(doc.Group), terms: terms}
+	i.norms = nil
+}
+
+func (i *Index) Remove(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+}
+
+func (i *Index) remove(id string) {
+	old, ok := i.entries[id]
+	if !ok {
+		return
+	}
+
+	for term := range old.terms {
+		delete(i.postings[term], id)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+	delete(i.entries, id)
+	i.norms = nil
+}
+
+func (i *Index) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return len(i.entries)
+}
+
+// Similar returns up to limit documents most similar to the one with the given
+// id, best first. The second result is false when the id is not indexed.
+func (i *Index) Similar(id string, limit int) ([]Match, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	target, ok := i.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	if i.norms == nil {
+		i.norms = make(map[string]float64, len(i.entries))
+		for docId, e := range i.entries {
+			var sum float64
+			for term, tf := range e.terms {
+				w := i.weight(term, tf)
+				sum += w * w
+			}
+			i.norms[docId] = math.Sqrt(sum)
+		}
+	}
+
+	dots := make(map[string]float64)
+	for term, tf := range target.terms {
+		w := i.weight(term, tf)
+		for docId, docTf := range i.postings[term] {
+			if docId != id {
+				dots[docId] += w * i.weight(term, docTf)
+			}
+		}
+	}
+
+	var matches []Match
+	for docId, e := range i.entries {
+		if docId == id {
+			continue
+		}
+
+		var cosine float64
+		if norm := i.norms[id] * i.norms[docId]; norm > 0 {
+			cosine = dots[docId] / norm
+		}
+
+		score := i.weights.Text*cosine +
+			i.weights.Group*groupProximity(target.groupKeys, e.groupKeys) +
+			i.weights.Era*eraProximity(target.doc.ReleaseDate, e.doc.ReleaseDate, i.weights.EraWindow)
+		if score <= 0 {
+			continue
+		}
+
+		matches = append(matches, Match{Document: e.doc, Score: score})
+	}
+
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].Score != matches[b].Score {
+			return matches[a].Score > matches[b].Score
+		}
+		return matches[a].Document.Id < matches[b].Document.Id
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches, true
+}
+
+// weight is the sublinear TF-IDF weight of a term occurring tf times in a document.
+func (i *Index) weight(term string, tf int) float64 {
+	df := len(i.postings[term])
+	idf := math.Log(float64(1+len(i.entries))/float64(1+df)) + 1
+
+	return (1 + math.Log(float64(tf))) * idf
+}
+
+// groupProximity is 1 for songs of the same group, also when it is spelled in
+// another script, and 0 otherwise.
+func groupProximity(a, b []string) float64 {
+	for _, keyA := range a {
+		for _, keyB := range b {
+			if keyA == keyB {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// eraProximity falls linearly from 1 for songs released at the same time to 0
+// for songs released window years or more apart.
+func eraProximity(a, b time.Time, window float64) float64 {
+	if a.IsZero() || b.IsZero() || window <= 0 {
+		return 0
+	}
+
+	years := math.Abs(a.Sub(b).Hours()) / (24 * 365.25)
+
+	return math.Max(0, 1-years/window)
+}
@@ -0,0 +1,60 @@
+package similarity
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int) time.Time {
+	return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestSimilarByText(t *testing.T) {
+	index := NewIndex(Weights{Text: 1})
+	index.Upsert(Document{Id: "1", Group: "A", Text: "группа крови на рукаве"})
+	index.Upsert(Document{Id: "2", Group: "B", Text: "группа крови"})
+	index.Upsert(Document{Id: "3", Group: "C", Text: "звезда по имени солнце"})
+
+	matches, ok := index.Similar("1", 10)
+	if !ok {
+		t.Fatal("expected song 1 to be indexed")
+	}
+	if len(matches) != 1 || matches[0].Document.Id != "2" {
+		t.Errorf("Similar() = %+v, want only song 2", matches)
+	}
+}
+
+func TestSimilarWeights(t *testing.T) {
+	index := NewIndex(Weights{Text: 0.5, Group: 0.3, Era: 0.2, EraWindow: 10})
+	index.Upsert(Document{Id: "1", Group: "Кино", ReleaseDate: date(1988), Text: "группа крови"})
+	index.Upsert(Document{Id: "2", Group: "Kino", ReleaseDate: date(1989), Text: "звезда"})
+	index.Upsert(Document{Id: "3", Group: "ДДТ", ReleaseDate: date(2020), Text: "осень"})
+	index.Upsert(Document{Id: "4", Group: "Ария", ReleaseDate: date(1987), Text: "группа крови"})
+
+	matches, _ := index.Similar("1", 10)
+	if len(matches) != 2 {
+		t.Fatalf("Similar() = %+v, want 2 matches", matches)
+	}
+	if matches[0].Document.Id != "4" || matches[1].Document.Id != "2" {
+		t.Errorf("Similar() = %+v, want songs 4 and 2", matches)
+	}
+}
+
+func TestUpsertAndRemove(t *testing.T) {
+	index := NewIndex(Weights{Text: 1})
+	index.Upsert(Document{Id: "1", Text: "группа крови"})
+	index.Upsert(Document{Id: "2", Text: "группа крови"})
+	index.Upsert(Document{Id: "2", Text: "звезда по имени солнце"})
+
+	if matches, _ := index.Similar("1", 10); len(matches) != 0 {
+		t.Errorf("Similar() after update = %+v, want no matches", matches)
+	}
+
+	index.Remove("2")
+	if index.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", index.Len())
+	}
+	if _, ok := index.Similar("2", 10); ok {
+		t.Error("expected song 2 to be removed")
+	}
+}
@@ -0,0 +1,109 @@
+package translit
+
+import (
+	"strings"
+	"unicode"
+)
+
+// scheme maps lowercase Cyrillic letters to their Latin spelling.
+type scheme map[rune]string
+
+var common = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'ч': "ch", 'ш': "sh", 'ъ': "", 'ы': "y",
+	'ь': "", 'э': "e", 'і': "i", 'ґ': "g",
+}
+
+// schemes lists the supported transliteration systems: GOST 7.79-2000 (system B),
+// the ICAO scheme used in Russian passports, and two common informal spellings.
+var schemes = []scheme{
+	newScheme(map[rune]string{
+		'ё': "yo", 'й': "j", 'х': "x", 'ц': "cz", 'щ': "shh", 'ю': "yu", 'я': "ya",
+		'ї': "yi", 'є': "ye", 'ў': "u",
+	}),
+	newScheme(map[rune]string{
+		'ё': "e", 'й': "i", 'х': "kh", 'ц': "ts", 'щ': "shch", 'ъ': "ie", 'ю': "iu", 'я': "ia",
+		'ї': "i", 'є': "ie", 'ў': "u",
+	}),
+	newScheme(map[rune]string{
+		'ё': "yo", 'й': "y", 'х': "kh", 'ц': "ts", 'щ': "shch", 'ю': "yu", 'я': "ya",
+		'ї': "yi", 'є': "ye", 'ў': "w",
+	}),
+	newScheme(map[rune]string{
+		'ё': "e", 'й': "j", 'х': "h", 'ц': "c", 'щ': "sch", 'ю': "ju", 'я': "ja",
+		'ї': "ji", 'є': "je", 'ў': "w",
+	}),
+}
+
+func newScheme(overrides map[rune]string) scheme {
+	s := make(scheme, len(common)+len(overrides))
+	for r, latin := range common {
+		s[r] = latin
+	}
+	for r, latin := range overrides {
+		s[r] = latin
+	}
+	return s
+}
+
+func (s scheme) apply(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if latin, ok := s[r]; ok {
+			b.WriteString(latin)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Normalize lowercases text, folds ё into е, drops apostrophes and collapses whitespace,
+// so that spelling variants of the same name compare equal.
+func Normalize(text string) string {
+	text = strings.Map(func(r rune) rune {
+		switch r {
+		case 'ё':
+			return 'е'
+		case '\'', '`', '’', 'ʼ':
+			return -1
+		}
+		return r
+	}, strings.ToLower(text))
+
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Keys returns the search keys for text: its normalized spelling followed by the
+// Latin transliteration under every supported scheme. Duplicates are removed, and
+// Latin-only input yields a single key.
+func Keys(text string) []string {
+	lower := strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	normalized := Normalize(text)
+
+	keys := []string{normalized}
+	if !hasCyrillic(lower) {
+		return keys
+	}
+
+	seen := map[string]bool{normalized: true}
+	for _, s := range schemes {
+		key := Normalize(s.apply(lower))
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func hasCyrillic(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return true
+		}
+	}
+	return false
+}
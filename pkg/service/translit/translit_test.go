@@ -0,0 +1,63 @@
+package translit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"  Кино ":       "кино",
+		"Ёлка":          "елка",
+		"Guns N' Roses": "guns n roses",
+		"Ария   Live":   "ария live",
+	}
+
+	for input, expected := range tests {
+		if result := Normalize(input); result != expected {
+			t.Errorf("Normalize(%q) = %q, want %q", input, result, expected)
+		}
+	}
+}
+
+func TestKeysLatin(t *testing.T) {
+	result := Keys("Zemfira")
+	expected := []string{"zemfira"}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Keys() = %v, want %v", result, expected)
+	}
+}
+
+func TestKeysCyrillic(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains []string
+	}{
+		{input: "Кино", contains: []string{"кино", "kino"}},
+		{input: "Земфира", contains: []string{"земфира", "zemfira"}},
+		{input: "Виктор Цой", contains: []string{"viktor czoj", "viktor tsoi", "viktor tsoy", "viktor coj"}},
+		{input: "Ёжик", contains: []string{"ежик", "yozhik", "ezhik"}},
+		{input: "Щелкунчик", contains: []string{"shhelkunchik", "shchelkunchik", "schelkunchik"}},
+	}
+
+	for _, tt := range tests {
+		keys := Keys(tt.input)
+		if keys[0] != Normalize(tt.input) {
+			t.Errorf("Keys(%q)[0] = %q, want the normalized original first", tt.input, keys[0])
+		}
+
+		for _, key := range tt.contains {
+			found := false
+			for _, k := range keys {
+				if k == key {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("Keys(%q) = %v, missing %q", tt.input, keys, key)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"net/http"
 
 	"go.uber.org/zap"
 )
@@ -17,3 +18,36 @@ func NewMyContext(ctx context.Context, logger *zap.SugaredLogger) MyContext {
 		Logger: logger,
 	}
 }
+
+type requestIdKey struct{}
+
+// WithRequestId returns a copy of ctx carrying the id of the request it serves.
+func WithRequestId(ctx MyContext, id string) MyContext {
+	return NewMyContext(context.WithValue(ctx.Ctx, requestIdKey{}, id), ctx.Logger)
+}
+
+// RequestId returns the id of the request served with ctx, or an empty string.
+func RequestId(ctx MyContext) string {
+	id, _ := ctx.Ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+type loggerKey struct{}
+
+// WithLogger stores the logger of the request served with ctx in its
+// context.Context, so that handlers can get it back with RequestContext.
+func WithLogger(ctx MyContext) MyContext {
+	return NewMyContext(context.WithValue(ctx.Ctx, loggerKey{}, ctx.Logger), ctx.Logger)
+}
+
+// RequestContext derives the MyContext of a request: r.Context(), which is
+// canceled when the client goes away, with the request logger set by the
+// request middleware, or the logger of base when there is none.
+func RequestContext(base MyContext, r *http.Request) MyContext {
+	logger, ok := r.Context().Value(loggerKey{}).(*zap.SugaredLogger)
+	if !ok {
+		logger = base.Logger
+	}
+
+	return NewMyContext(r.Context(), logger)
+}
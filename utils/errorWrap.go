@@ -2,35 +2,83 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
 )
 
+const ApplicationProblemJSON = "application/problem+json"
+
+// ErrorResponse is an RFC 7807 problem details object.
 type ErrorResponse struct {
-	Message string `json:"message"`
+	Type      string       `json:"type" example:"about:blank"`
+	Title     string       `json:"title" example:"Not Found"`
+	Status    int          `json:"status" example:"404"`
+	Detail    string       `json:"detail" example:"song with id 8c5b4a1e-0f0b-4a0e-9a3c-2f6f7c1d2e3f not found"`
+	Code      string       `json:"code" example:"song_not_found"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestId string       `json:"requestId,omitempty"`
 }
 
-func NewErrorResponse(ctx MyContext, w http.ResponseWriter, message string) {
-	ctx.Logger.Error(message)
+var kindStatuses = map[ErrorKind]int{
+	KindInternal:     http.StatusInternalServerError,
+	KindNotFound:     http.StatusNotFound,
+	KindValidation:   http.StatusBadRequest,
+	KindConflict:     http.StatusConflict,
+	KindUpstream:     http.StatusBadGateway,
+	KindUnavailable:  http.StatusServiceUnavailable,
+	KindUnauthorized: http.StatusUnauthorized,
+	KindForbidden:    http.StatusForbidden,
+	KindRateLimited:  http.StatusTooManyRequests,
+	KindUnsupported:  http.StatusUnsupportedMediaType,
+	KindTooLarge:     http.StatusRequestEntityTooLarge,
+}
 
-	var statusCode int
-	if strings.Contains(message, "not found") {
-		statusCode = http.StatusNotFound
-	} else if strings.Contains(message, "missing") || strings.Contains(message, "invalid") {
-		statusCode = http.StatusBadRequest
-	} else {
-		statusCode = http.StatusInternalServerError
+// NewErrorResponse answers with an application/problem+json body. The status,
+// code and detail come from the domain error wrapped by err; any other error is
+// an internal one. The full text of err, which may hold upstream URLs or
+// database messages, is logged but never sent to the client.
+func NewErrorResponse(ctx MyContext, w http.ResponseWriter, err error) {
+	problem := ErrorResponse{
+		Type:      "about:blank",
+		Code:      CodeInternal,
+		Detail:    "internal server error",
+		RequestId: RequestId(ctx),
+	}
+
+	kind := KindInternal
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		kind = domainErr.Kind
+		problem.Code = domainErr.Code
+		problem.Detail = domainErr.Message
+		problem.Errors = domainErr.Fields
 	}
 
-	errRes := ErrorResponse{Message: message}
+	problem.Status = kindStatuses[kind]
+	problem.Title = http.StatusText(problem.Status)
 
-	jsonErrRes, err := json.Marshal(errRes)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if problem.Status >= http.StatusInternalServerError {
+		ctx.Logger.Error(err.Error())
+	} else {
+		ctx.Logger.Warn(err.Error())
+	}
+
+	jsonErrRes, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		http.Error(w, marshalErr.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set(ContentType, ApplicationJSON)
-	w.WriteHeader(statusCode)
+	if domainErr != nil && domainErr.RetryAfter > 0 {
+		seconds := int(math.Ceil(domainErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	}
+	if kind == KindUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.Header().Set(ContentType, ApplicationProblemJSON)
+	w.WriteHeader(problem.Status)
 	w.Write(jsonErrRes)
 }
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestNewErrorResponse(t *testing.T) {
+	ctx := WithRequestId(NewMyContext(context.Background(), zap.NewNop().Sugar()), "req-1")
+
+	tests := []struct {
+		err        error
+		status     int
+		code       string
+		retryAfter string
+	}{
+		{fmt.Errorf("failed to get song: %w", NewNotFoundError(CodeSongNotFound, "song with id %s not found", "1")), http.StatusNotFound, CodeSongNotFound, ""},
+		{NewValidationError("missing required fields", FieldError{Field: "group", Message: "is required"}), http.StatusBadRequest, CodeValidation, ""},
+		{NewConflictError(CodeConflict, "failed to insert lyrics revision", errors.New("duplicate key")), http.StatusConflict, CodeConflict, ""},
+		{NewUpstreamError(CodeDetailsUpstream, "song details providers failed", errors.New(`Get "http://lyrics.internal/info": timeout`)), http.StatusBadGateway, CodeDetailsUpstream, ""},
+		{NewUnavailableError(CodeDetailsUnavailable, "song details providers are overloaded", 1500*time.Millisecond, nil), http.StatusServiceUnavailable, CodeDetailsUnavailable, "2"},
+		{NewUnauthorizedError("invalid API key"), http.StatusUnauthorized, CodeUnauthorized, ""},
+		{NewForbiddenError("scope %s required", "songs:delete"), http.StatusForbidden, CodeForbidden, ""},
+		{NewRateLimitedError(30*time.Second, "rate limit of %d requests exceeded", 60), http.StatusTooManyRequests, CodeRateLimited, "30"},
+		{NewUnsupportedMediaTypeError(CodeUnknownEncoding, "unsupported content encoding %s", "br"), http.StatusUnsupportedMediaType, CodeUnknownEncoding, ""},
+		{NewTooLargeError("request body is larger than %d bytes", 1024), http.StatusRequestEntityTooLarge, CodeBodyTooLarge, ""},
+		{errors.New("song with id 1 not found in a pq error"), http.StatusInternalServerError, CodeInternal, ""},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		NewErrorResponse(ctx, recorder, test.err)
+
+		if recorder.Code != test.status {
+			t.Errorf("%v: status = %d, want %d", test.err, recorder.Code, test.status)
+		}
+		if contentType := recorder.Header().Get(ContentType); contentType != ApplicationProblemJSON {
+			t.Errorf("%v: Content-Type = %q", test.err, contentType)
+		}
+		if challenge := recorder.Header().Get("WWW-Authenticate"); (challenge != "") != (test.status == http.StatusUnauthorized) {
+			t.Errorf("%v: WWW-Authenticate = %q", test.err, challenge)
+		}
+		if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != test.retryAfter {
+			t.Errorf("%v: Retry-After = %q, want %q", test.err, retryAfter, test.retryAfter)
+		}
+
+		var problem ErrorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("%v: invalid body: %v", test.err, err)
+		}
+		if problem.Code != test.code || problem.Status != test.status || problem.RequestId != "req-1" {
+			t.Errorf("%v: problem = %+v", test.err, problem)
+		}
+		if test.code == CodeValidation && len(problem.Errors) != 1 {
+			t.Errorf("%v: expected field errors, got %+v", test.err, problem.Errors)
+		}
+		var domainErr *Error
+		if errors.As(test.err, &domainErr) && problem.Detail != domainErr.Message {
+			t.Errorf("%v: detail = %q, want only the message %q", test.err, problem.Detail, domainErr.Message)
+		}
+		if test.code == CodeInternal && problem.Detail != "internal server error" {
+			t.Errorf("internal error details leaked: %q", problem.Detail)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrorKind classifies domain errors. Each kind is answered with its own HTTP
+// status, see NewErrorResponse.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindValidation
+	KindConflict
+	KindUpstream
+	KindUnavailable
+	KindUnauthorized
+	KindForbidden
+	KindRateLimited
+	KindUnsupported
+	KindTooLarge
+)
+
+// Stable error codes returned to clients in the code field of error responses.
+const (
+	CodeInternal           = "internal_error"
+	CodeValidation         = "validation_failed"
+	CodeSongNotFound       = "song_not_found"
+	CodeRevisionNotFound   = "revision_not_found"
+	CodeAnnotationNotFound = "annotation_not_found"
+	CodeDetailsNotFound    = "song_details_not_found"
+	CodeConflict           = "conflict"
+	CodeDetailsUpstream    = "details_upstream_error"
+	CodeDetailsUnavailable = "details_unavailable"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeAPIKeyNotFound     = "api_key_not_found"
+	CodeRateLimited        = "rate_limited"
+	CodeUnknownEncoding    = "unsupported_content_encoding"
+	CodeBodyTooLarge       = "request_body_too_large"
+)
+
+// FieldError describes an invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field" example:"releaseDate"`
+	Message string `json:"message" example:"must be in yyyy-mm-dd format"`
+}
+
+// Error is a domain error. It keeps its kind when wrapped with fmt.Errorf and
+// %w on its way from the repository through the service to the handler.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	// Fields lists the invalid fields of a validation error.
+	Fields []FieldError
+	// RetryAfter tells clients when to retry an unavailable dependency.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NewNotFoundError(code, format string, args ...any) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// NewValidationError reports invalid input. The message summarizes the
+// problem, fields point at the offending fields.
+func NewValidationError(message string, fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: CodeValidation, Message: message, Fields: fields}
+}
+
+// MissingFields returns a field error for every empty value, keyed by field
+// name, in name order.
+func MissingFields(values map[string]string) []FieldError {
+	var fields []FieldError
+	for field, value := range values {
+		if value == "" {
+			fields = append(fields, FieldError{Field: field, Message: "is required"})
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+
+	return fields
+}
+
+func NewConflictError(code, message string, err error) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message, Err: err}
+}
+
+// NewUpstreamError reports that an external API answered with an error.
+func NewUpstreamError(code, message string, err error) *Error {
+	return &Error{Kind: KindUpstream, Code: code, Message: message, Err: err}
+}
+
+// NewUnavailableError reports that a dependency cannot take requests right
+// now. A positive retryAfter is sent to clients in the Retry-After header.
+func NewUnavailableError(code, message string, retryAfter time.Duration, err error) *Error {
+	return &Error{Kind: KindUnavailable, Code: code, Message: message, RetryAfter: retryAfter, Err: err}
+}
+
+// NewUnauthorizedError reports missing or invalid credentials.
+func NewUnauthorizedError(format string, args ...any) *Error {
+	return &Error{Kind: KindUnauthorized, Code: CodeUnauthorized, Message: fmt.Sprintf(format, args...)}
+}
+
+// NewForbiddenError reports credentials that lack the permission a request
+// needs.
+func NewForbiddenError(format string, args ...any) *Error {
+	return &Error{Kind: KindForbidden, Code: CodeForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+// NewRateLimitedError reports that a client sent too many requests. A
+// positive retryAfter is sent to clients in the Retry-After header.
+func NewRateLimitedError(retryAfter time.Duration, format string, args ...any) *Error {
+	return &Error{Kind: KindRateLimited, Code: CodeRateLimited, Message: fmt.Sprintf(format, args...), RetryAfter: retryAfter}
+}
+
+// NewUnsupportedMediaTypeError reports a request body in a format or encoding
+// the server cannot read.
+func NewUnsupportedMediaTypeError(code, format string, args ...any) *Error {
+	return &Error{Kind: KindUnsupported, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// NewTooLargeError reports a request body over the size the server accepts.
+func NewTooLargeError(format string, args ...any) *Error {
+	return &Error{Kind: KindTooLarge, Code: CodeBodyTooLarge, Message: fmt.Sprintf(format, args...)}
+}
+
+// KindOf returns the kind of the first domain error wrapped by err, or
+// KindInternal when there is none.
+func KindOf(err error) ErrorKind {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr.Kind
+	}
+	return KindInternal
+}
+
+// PublicError returns the code and message of the first domain error wrapped
+// by err, which unlike its full text are safe to show to clients, or those of
+// an internal error when there is none.
+func PublicError(err error) (code, message string) {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr.Code, domainErr.Message
+	}
+	return CodeInternal, "internal server error"
+}
@@ -8,6 +8,7 @@ import (
 const (
 	ContentType     = "Content-Type"
 	ApplicationJSON = "application/json"
+	TextPlain       = "text/plain; charset=utf-8"
 )
 
 type StatusResponse struct {